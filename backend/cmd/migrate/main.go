@@ -0,0 +1,118 @@
+// Command migrate manages the database schema.
+//
+//	migrate up
+//	migrate down [-steps n]
+//	migrate to <version>
+//	migrate status
+//	migrate force <version>
+//
+// Migrations come from the binary unless DB_MIGRATION_DIR is set. After a migration fails
+// half way, fix the schema by hand and record where it ended up with force. A database
+// created before migrations were tracked is adopted the same way.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/database/migrate"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate <up|down|to|status|force> [flags] [version]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command, args := os.Args[1], os.Args[2:]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	steps := flags.Int("steps", 1, "number of migrations to revert")
+	flags.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	source, err := migrate.Source(db.Dialect, cfg.Database.Migration.Directory)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	migrator, err := migrate.New(db.Primary, db.Dialect, source, cfg.Database.Migration.LockTimeout)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	ctx := context.Background()
+
+	var result *migrate.Result
+	switch command {
+	case "up":
+		result, err = migrator.Up(ctx)
+
+	case "down":
+		result, err = migrator.Down(ctx, *steps)
+
+	case "to":
+		result, err = migrator.To(ctx, version(flags))
+
+	case "force":
+		if err := migrator.Force(ctx, version(flags)); err != nil {
+			log.Fatalf("Failed to force migration: %v", err)
+		}
+		return
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		printJSON(statuses)
+		return
+
+	default:
+		usage()
+	}
+
+	// Print what ran before failing, the schema_migrations row of the failed one is dirty
+	printJSON(result)
+	if err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+}
+
+func version(flags *flag.FlagSet) int64 {
+	if flags.NArg() != 1 {
+		usage()
+	}
+	v, err := strconv.ParseInt(flags.Arg(0), 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid version %q: %v", flags.Arg(0), err)
+	}
+	return v
+}
+
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatalf("Failed to write output: %v", err)
+	}
+}
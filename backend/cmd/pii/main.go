@@ -0,0 +1,103 @@
+// Command pii manages encryption of emails and usernames at rest.
+//
+//	pii reencrypt
+//	pii keygen [-id key-id]
+//
+// To rotate the master key, append the line printed by keygen to PII_MASTER_KEY_FILE,
+// restart the servers and run reencrypt. Keep the old line until reencrypt reports no
+// failures, rows wrapped by it can't be read without it.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/repository"
+	"github.com/imnzr/user-authentication-go/internal/service"
+	"github.com/imnzr/user-authentication-go/pkg/logger"
+	"github.com/imnzr/user-authentication-go/pkg/pii"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: pii <reencrypt|keygen> [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command, args := os.Args[1], os.Args[2:]
+
+	switch command {
+	case "keygen":
+		flags := flag.NewFlagSet(command, flag.ExitOnError)
+		id := flags.String("id", time.Now().UTC().Format("20060102"), "id of the new master key")
+		flags.Parse(args)
+		keygen(*id)
+
+	case "reencrypt":
+		reencrypt()
+
+	default:
+		usage()
+	}
+}
+
+func reencrypt() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	keyring, err := pii.LoadKeyring(cfg.PII.MasterKeyFile, cfg.PII.BlindIndexKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load pii keys: %v", err)
+	}
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	userRepo := repository.NewUserRepository(db, keyring)
+	result, err := service.NewPIIReencryptor(userRepo, cfg.PII, logger.New()).Run(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to re-encrypt users: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatalf("Failed to write output: %v", err)
+	}
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// keygen prints a master key line and a blind index key. The blind index key is only
+// generated once, changing it breaks every email lookup.
+func keygen(id string) {
+	masterKey, err := pii.GenerateKey()
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+	indexKey, err := pii.GenerateKey()
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+
+	fmt.Println("# append to PII_MASTER_KEY_FILE")
+	fmt.Printf("%s:%s\n", id, masterKey)
+	fmt.Println("# PII_BLIND_INDEX_KEY_FILE, new installs only")
+	fmt.Println(indexKey)
+}
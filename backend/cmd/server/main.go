@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -13,23 +14,39 @@ import (
 	"github.com/imnzr/user-authentication-go/internal/api/router"
 	"github.com/imnzr/user-authentication-go/internal/config"
 	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/database/migrate"
 	"github.com/imnzr/user-authentication-go/internal/repository/redis"
 	"github.com/imnzr/user-authentication-go/pkg/logger"
 	"go.uber.org/zap"
 )
 
+// Where --dev keeps the SQLite database and the generated keys
+const devDir = ".dev"
+
 func main() {
+	dev := flag.Bool("dev", false, "run without external services: SQLite in "+devDir+", Redis in memory, generated keys")
+	flag.Parse()
+
 	// Initialize Logger
 	logger := logger.New()
 	defer logger.Sync()
 
 	logger.Info("Starting application...")
 
+	if *dev {
+		if err := config.UseDevDefaults(devDir); err != nil {
+			log.Fatalf("Failed to set up dev mode: %v", err)
+		}
+		logger.Warn("running in dev mode, data is kept in " + devDir)
+	}
+
 	// Load Configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load configuratio: %v", err)
 	}
+	// Secrets marshal as a placeholder, the dump is safe to log
+	logger.Info("configuration loaded", zap.Any("config", cfg))
 
 	// Initialize Database
 	db, err := database.New(&cfg.Database)
@@ -38,19 +55,40 @@ func main() {
 	}
 	defer db.Close()
 
-	// Initialize Redis
-	redisClient := redis.NewRedisClient(cfg.RedisCfg.RedisAddr, cfg.RedisCfg.RedisPass, cfg.RedisCfg.RedisDB)
-	if err := redisClient.Ping(context.Background()); err != nil {
-		logger.Fatal("failed to connect redis", zap.Error(err))
+	// Initialize Redis, one client shared by everything
+	redisClient, err := redis.New(cfg.RedisCfg)
+	if err != nil {
+		logger.Fatal("failed to initialize redis", zap.Error(err))
+	}
+	defer redisClient.Close()
+
+	// Redis may come up later, until then every check follows its failure policy
+	if err := redis.Connect(context.Background(), redisClient, cfg.RedisCfg.ConnectAttempts, cfg.RedisCfg.ConnectBackoff); err != nil {
+		logger.Warn("redis is unreachable, starting degraded", zap.Error(err))
 	}
 
 	// Logger info database connected successfully
 	logger.Info("Database connected successfully")
 
 	// Run migration if enabled
+	if cfg.Database.Migration.Enabled {
+		source, err := migrate.Source(db.Dialect, cfg.Database.Migration.Directory)
+		if err != nil {
+			logger.Fatal("failed to load migrations", zap.Error(err))
+		}
+		migrator, err := migrate.New(db.Primary, db.Dialect, source, cfg.Database.Migration.LockTimeout)
+		if err != nil {
+			logger.Fatal("failed to load migrations", zap.Error(err))
+		}
+		result, err := migrator.Up(context.Background())
+		if err != nil {
+			logger.Fatal("failed to run migrations", zap.Strings("applied", result.Applied), zap.Error(err))
+		}
+		logger.Info("migrations are up to date", zap.Strings("applied", result.Applied))
+	}
 
 	// Build router (Fiber App)
-	app := router.New(cfg, db, logger)
+	app := router.New(cfg, db, redisClient, logger)
 
 	// Start server in goroutine
 	go func() {
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"go.uber.org/zap"
+)
+
+type AuditHandler struct {
+	*BaseHandler
+	auditService audit.Service
+}
+
+func NewAuditHandler(auditService audit.Service, logger *zap.Logger) *AuditHandler {
+	return &AuditHandler{
+		BaseHandler:  NewBaseHandler(logger),
+		auditService: auditService,
+	}
+}
+
+// parseAuditFilter reads the filters shared by both endpoints, since and until are RFC 3339
+func parseAuditFilter(c *fiber.Ctx) (audit.Filter, error) {
+	filter := audit.Filter{
+		Action:  c.Query("action"),
+		Outcome: c.Query("outcome"),
+		Limit:   c.QueryInt("limit"),
+	}
+
+	var err error
+	if filter.Since, err = queryTime(c, "since"); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = queryTime(c, "until"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func queryTime(c *fiber.Ctx, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.New("invalid " + name + ", expected RFC 3339 time")
+	}
+	return &t, nil
+}
+
+func queryId(c *fiber.Ctx, name string) (*int, error) {
+	if c.Query(name) == "" {
+		return nil, nil
+	}
+	id := c.QueryInt(name)
+	if id <= 0 {
+		return nil, errors.New("invalid " + name)
+	}
+	return &id, nil
+}
+
+func (h *AuditHandler) listPage(c *fiber.Ctx, filter audit.Filter) error {
+	page, err := h.auditService.List(c.Context(), filter, c.Query("cursor"))
+	if err != nil {
+		if errors.Is(err, errorpkg.ErrInvalidAuditCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"Error": err.Error(),
+			})
+		}
+		h.logger.Error("failed to list audit events", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"Error": "Failed to list audit events",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(page)
+}
+
+// ListEvents lets admins search the whole audit trail
+func (h *AuditHandler) ListEvents(c *fiber.Ctx) error {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": err.Error(),
+		})
+	}
+
+	if filter.ActorId, err = queryId(c, "actor_id"); err == nil {
+		filter.TargetId, err = queryId(c, "target_id")
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": err.Error(),
+		})
+	}
+
+	return h.listPage(c, filter)
+}
+
+// MyActivity shows users the security history of their own account
+func (h *AuditHandler) MyActivity(c *fiber.Ctx) error {
+	userId, ok := c.Locals("userId").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"Error": "user id not found in context",
+		})
+	}
+
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": err.Error(),
+		})
+	}
+	filter.TargetId = &userId
+
+	return h.listPage(c, filter)
+}
+
+// queryDays reads the optional from and to days, as YYYY-MM-DD
+func queryDays(c *fiber.Ctx) (string, string, error) {
+	from, to := c.Query("from"), c.Query("to")
+	for _, day := range []string{from, to} {
+		if day == "" {
+			continue
+		}
+		if _, err := time.Parse(audit.ChainDayLayout, day); err != nil {
+			return "", "", errors.New("invalid day, expected YYYY-MM-DD")
+		}
+	}
+	return from, to, nil
+}
+
+func (h *AuditHandler) checkpointError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errorpkg.ErrCheckpointsDisabled) {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"Error": err.Error(),
+		})
+	}
+	h.logger.Error("failed to handle audit checkpoints", zap.Error(err))
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"Error": "Failed to handle audit checkpoints",
+	})
+}
+
+// VerifyChain recomputes the hash chains and reports the first broken link
+func (h *AuditHandler) VerifyChain(c *fiber.Ctx) error {
+	from, to, err := queryDays(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": err.Error(),
+		})
+	}
+
+	result, err := h.auditService.VerifyChain(c.Context(), from, to)
+	if err != nil {
+		h.logger.Error("failed to verify audit chain", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"Error": "Failed to verify audit chain",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// ExportCheckpoints returns signed checkpoints and the public key to check them with
+func (h *AuditHandler) ExportCheckpoints(c *fiber.Ctx) error {
+	from, to, err := queryDays(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": err.Error(),
+		})
+	}
+
+	export, err := h.auditService.ExportCheckpoints(c.Context(), from, to)
+	if err != nil {
+		return h.checkpointError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(export)
+}
+
+// CreateCheckpoints signs the current chain heads without waiting for the next interval
+func (h *AuditHandler) CreateCheckpoints(c *fiber.Ctx) error {
+	created, err := h.auditService.CreateCheckpoints(c.Context())
+	if err != nil {
+		return h.checkpointError(c, err)
+	}
+	if created == nil {
+		created = []*audit.Checkpoint{}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+	"github.com/imnzr/user-authentication-go/pkg/breaker"
+	"go.uber.org/zap"
+)
+
+// Health statuses
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthDown     = "down"
+)
+
+const redisHealthTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	*BaseHandler
+	db           *database.DB
+	redisRepo    redis.Client
+	redisBreaker *breaker.Breaker
+}
+
+func NewHealthHandler(db *database.DB, redisRepo redis.Client, redisBreaker *breaker.Breaker, logger *zap.Logger) *HealthHandler {
+	return &HealthHandler{
+		BaseHandler:  NewBaseHandler(logger),
+		db:           db,
+		redisRepo:    redisRepo,
+		redisBreaker: redisBreaker,
+	}
+}
+
+// Health answers 503 only when the database is down. Redis being down degrades the service,
+// each check then follows its failure policy.
+func (h *HealthHandler) Health(c *fiber.Ctx) error {
+	status := healthOK
+	code := fiber.StatusOK
+
+	dbStatus := healthOK
+	if err := h.db.Health(); err != nil {
+		h.logger.Warn("database health check failed", zap.Error(err))
+		dbStatus = healthDown
+		status = healthDown
+		code = fiber.StatusServiceUnavailable
+	}
+
+	// A replica down only costs read capacity, the primary takes its reads
+	replicas := h.db.ReplicaHealth()
+	for _, replica := range replicas {
+		if !replica.Healthy && status == healthOK {
+			status = healthDegraded
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), redisHealthTimeout)
+	defer cancel()
+
+	redisStatus := healthOK
+	if err := h.redisRepo.Ping(ctx); err != nil {
+		redisStatus = healthDown
+		if status == healthOK {
+			status = healthDegraded
+		}
+	}
+
+	return c.Status(code).JSON(fiber.Map{
+		"status":   status,
+		"database": dbStatus,
+		"replicas": replicas,
+		"redis": fiber.Map{
+			"status":  redisStatus,
+			"breaker": h.redisBreaker.Snapshot(),
+		},
+	})
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/imnzr/user-authentication-go/internal/domain/session"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/pkg/response"
+	"go.uber.org/zap"
+)
+
+type SessionHandler struct {
+	*BaseHandler
+	sessionService session.Service
+}
+
+func NewSessionHandler(sessionService session.Service, logger *zap.Logger) *SessionHandler {
+	return &SessionHandler{
+		BaseHandler:    NewBaseHandler(logger),
+		sessionService: sessionService,
+	}
+}
+
+func (h *SessionHandler) ListSessions(c *fiber.Ctx) error {
+	userId, ok := c.Locals("userId").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"Error": "user id not found in context",
+		})
+	}
+	currentId, _ := c.Locals("sessionId").(string)
+
+	sessions, err := h.sessionService.List(c.Context(), userId)
+	if err != nil {
+		h.logger.Error("failed to list sessions", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"Error": "Failed to list sessions",
+		})
+	}
+
+	result := make([]response.SessionResponse, 0, len(sessions))
+	for _, sess := range sessions {
+		result = append(result, response.SessionResponse{
+			Id:         sess.Id,
+			IPAddress:  sess.IPAddress,
+			UserAgent:  sess.UserAgent,
+			CreatedAt:  sess.CreatedAt,
+			LastSeenAt: sess.LastSeenAt,
+			Current:    sess.Id == currentId,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
+	userId, ok := c.Locals("userId").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"Error": "user id not found in context",
+		})
+	}
+
+	sessionId := c.Params("id")
+	if sessionId == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "session id required",
+		})
+	}
+
+	if err := h.sessionService.Revoke(c.Context(), userId, sessionId); err != nil {
+		if errors.Is(err, errorpkg.ErrSessionNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"Error": err.Error(),
+			})
+		}
+		h.logger.Error("failed to revoke session", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"Error": "Failed to revoke session",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -2,13 +2,15 @@ package handler
 
 import (
 	"errors"
-	"fmt"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/imnzr/user-authentication-go/internal/domain/user"
 	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
 	"github.com/imnzr/user-authentication-go/pkg/auth"
+	"github.com/imnzr/user-authentication-go/pkg/password"
 	"github.com/imnzr/user-authentication-go/pkg/request"
 	"go.uber.org/zap"
 )
@@ -27,6 +29,59 @@ func NewUserHandler(userService user.Service, logger *zap.Logger, jwtManager aut
 	}
 }
 
+func isPasswordPolicyError(err error) bool {
+	var policyErr *password.PolicyError
+	return errors.As(err, &policyErr)
+}
+
+// passwordPolicyError reports every failed password rule so the client can show them all at once
+func passwordPolicyError(c *fiber.Ctx, err error) error {
+	var policyErr *password.PolicyError
+	errors.As(err, &policyErr)
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"Error":      "password does not meet policy",
+		"Violations": policyErr.Violations,
+	})
+}
+
+func isHasherBusy(err error) bool {
+	return errors.Is(err, password.ErrHasherBusy)
+}
+
+// hasherBusyError sheds load when the password hash pool is saturated
+func hasherBusyError(c *fiber.Ctx, err error) error {
+	var retryErr *errorpkg.RetryAfterError
+	if errors.As(err, &retryErr) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryErr.RetryAfter.Seconds()))))
+	}
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"Error": "server is busy, try again later",
+	})
+}
+
+func isLoginThrottled(err error) bool {
+	return errors.Is(err, errorpkg.ErrAccountLocked) || errors.Is(err, errorpkg.ErrLoginThrottled)
+}
+
+// loginThrottledError answers a lock and a delay alike, and the same for an email without
+// an account, so the response doesn't tell whether the email is registered
+func loginThrottledError(c *fiber.Ctx, err error) error {
+	var retryErr *errorpkg.RetryAfterError
+	if errors.As(err, &retryErr) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryErr.RetryAfter.Seconds()))))
+	}
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"Error": "too many failed sign-in attempts, try again later",
+	})
+}
+
+// serviceUnavailable answers a check that fails closed while a dependency is down
+func serviceUnavailable(c *fiber.Ctx, err error) error {
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"Error": err.Error(),
+	})
+}
+
 func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 	var req *request.UserCreateRequest
 
@@ -36,14 +91,22 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 		})
 	}
 
-	result, err := h.userService.Create(c.Context(), req)
-	if err != nil {
+	if _, err := h.userService.Create(c.Context(), req); err != nil {
+		if isPasswordPolicyError(err) {
+			return passwordPolicyError(c, err)
+		}
+		if isHasherBusy(err) {
+			return hasherBusyError(c, err)
+		}
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"Error": err.Error(),
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(result)
+	// Same answer whether or not the email was already registered
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"Message": "check your email to finish signing up",
+	})
 }
 
 func (h *UserHandler) VerifyEmail(c *fiber.Ctx) error {
@@ -84,6 +147,11 @@ func (h *UserHandler) GetById(c *fiber.Ctx) error {
 		})
 	}
 	userProfile, err := h.userService.GetById(c.Context(), id)
+	if errors.Is(err, errorpkg.ErrUserNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"Error": err.Error(),
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"Error": err.Error(),
@@ -107,6 +175,8 @@ func (h *UserHandler) LoginUser(c *fiber.Ctx) error {
 			"error": "validation error",
 		})
 	}
+	req.IPAddress = c.IP()
+	req.UserAgent = c.Get(fiber.HeaderUserAgent)
 
 	resp, err := h.userService.LoginUser(c.Context(), &req)
 	if err != nil {
@@ -115,6 +185,22 @@ func (h *UserHandler) LoginUser(c *fiber.Ctx) error {
 				"Error": "Invalid email or password",
 			})
 		}
+		if isLoginThrottled(err) {
+			return loginThrottledError(c, err)
+		}
+		if isHasherBusy(err) {
+			return hasherBusyError(c, err)
+		}
+		if errors.Is(err, errorpkg.ErrAccountSuspended) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"Error": "Account suspended",
+			})
+		}
+		if errors.Is(err, errorpkg.ErrPasswordResetRequired) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"Error": "Password reset required, check your email for a reset code",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"Error": err.Error(),
 		})
@@ -138,6 +224,11 @@ func (h *UserHandler) GetProfile(c *fiber.Ctx) error {
 	}
 
 	userProfile, err := h.userService.GetUserProfile(c.Context(), id)
+	if errors.Is(err, errorpkg.ErrUserNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"Error": err.Error(),
+		})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"Error": "Failed get user profile",
@@ -164,23 +255,237 @@ func (h *UserHandler) LogoutUser(c *fiber.Ctx) error {
 		})
 	}
 
-	exp, ok := claims["expired"].(float64)
-	fmt.Printf("Claims saat logout: %+v\n", claims)
+	userId, _ := c.Locals("userId").(int)
+	sessionId, _ := c.Locals("sessionId").(string)
 
-	if !ok {
+	if err := h.userService.LogoutUser(c.Context(), userId, sessionId, token, claims); err != nil {
+		h.logger.Error("failed to logout user", zap.Error(err))
 		return c.Status(500).JSON(fiber.Map{
 			"Error": "Failed to logout",
 		})
 	}
 
-	if err := h.userService.LogoutUser(c.Context(), token, int64(exp)); err != nil {
-		h.logger.Error("failed to logout user", zap.Error(err))
+	return c.Status(200).JSON(fiber.Map{
+		"Success": "Logout successfully",
+	})
+}
+
+func (h *UserHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req request.ForgotPasswordRequest
+
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "invalid request",
+		})
+	}
+
+	if err := h.userService.ForgotPassword(c.Context(), req.Email); err != nil {
+		if errors.Is(err, errorpkg.ErrServiceUnavailable) {
+			return serviceUnavailable(c, err)
+		}
+		h.logger.Error("failed to send reset code", zap.Error(err))
+		return c.Status(500).JSON(fiber.Map{
+			"Error": "Failed to send reset code",
+		})
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"Message": "if an account exists for this email, a reset code has been sent",
+	})
+}
+
+func (h *UserHandler) ResendVerification(c *fiber.Ctx) error {
+	var req request.ResendVerificationRequest
+
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "invalid request",
+		})
+	}
+
+	if err := h.userService.ResendVerification(c.Context(), req.Email); err != nil {
+		h.logger.Error("failed to resend verification email", zap.Error(err))
+		return c.Status(500).JSON(fiber.Map{
+			"Error": "Failed to resend verification email",
+		})
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"Message": "if an unverified account exists for this email, a verification link has been sent",
+	})
+}
+
+func (h *UserHandler) ResetPassword(c *fiber.Ctx) error {
+	var req request.ResetPasswordRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "invalid request",
+		})
+	}
+
+	if err := h.userService.ResetPassword(c.Context(), &req); err != nil {
+		if isPasswordPolicyError(err) {
+			return passwordPolicyError(c, err)
+		}
+		if isHasherBusy(err) {
+			return hasherBusyError(c, err)
+		}
+		if errors.Is(err, errorpkg.ErrServiceUnavailable) {
+			return serviceUnavailable(c, err)
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": err.Error(),
+		})
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"Message": "password has been reset",
+	})
+}
+
+// confirmUnrecognizedLoginPage posts back to the URL it was opened from, the link itself
+// changes nothing, so mail scanners and link previews that fetch it are harmless
+const confirmUnrecognizedLoginPage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Secure your account</title></head>
+<body>
+<p>If you don't recognize the new sign-in, confirm below. Every session is signed out and you must reset your password.</p>
+<form method="post"><button type="submit">This wasn't me, secure my account</button></form>
+</body>
+</html>
+`
+
+func (h *UserHandler) ConfirmUnrecognizedLogin(c *fiber.Ctx) error {
+	token := c.Params("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "token required",
+		})
+	}
+
+	if err := h.userService.CheckUnrecognizedLogin(c.Context(), token); err != nil {
+		if errors.Is(err, errorpkg.ErrInvalidLink) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"Error": err.Error(),
+			})
+		}
+		return serviceUnavailable(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Type("html", "utf-8")
+	return c.SendString(confirmUnrecognizedLoginPage)
+}
+
+func (h *UserHandler) ReportUnrecognizedLogin(c *fiber.Ctx) error {
+	token := c.Params("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "token required",
+		})
+	}
+
+	if err := h.userService.ReportUnrecognizedLogin(c.Context(), token); err != nil {
+		if errors.Is(err, errorpkg.ErrInvalidLink) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"Error": err.Error(),
+			})
+		}
+		if errors.Is(err, errorpkg.ErrServiceUnavailable) {
+			return serviceUnavailable(c, err)
+		}
+		h.logger.Error("failed to handle unrecognized login report", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"Error": "Failed to secure account",
+		})
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"Message": "all sessions signed out, check your email to reset your password",
+	})
+}
+
+func (h *UserHandler) LogoutAll(c *fiber.Ctx) error {
+	userId, ok := c.Locals("userId").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"Error": "user id not found in context",
+		})
+	}
+
+	if err := h.userService.LogoutAll(c.Context(), userId); err != nil {
+		h.logger.Error("failed to logout from all devices", zap.Error(err))
 		return c.Status(500).JSON(fiber.Map{
 			"Error": "Failed to logout",
 		})
 	}
 
 	return c.Status(200).JSON(fiber.Map{
-		"Success": "Logout successfully",
+		"Success": "Logged out from all devices",
+	})
+}
+
+func (h *UserHandler) SuspendUser(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "invalid user id",
+		})
+	}
+	adminId, _ := c.Locals("userId").(int)
+
+	if err := h.userService.SuspendUser(c.Context(), id, adminId); err != nil {
+		if errors.Is(err, errorpkg.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"Error": err.Error(),
+			})
+		}
+		h.logger.Error("failed to suspend user", zap.Int("user_id", id), zap.Error(err))
+		return c.Status(500).JSON(fiber.Map{
+			"Error": "Failed to suspend user",
+		})
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"Success": "User suspended",
+	})
+}
+
+func (h *UserHandler) ChangePassword(c *fiber.Ctx) error {
+	userId, ok := c.Locals("userId").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"Error": "user id not found in context",
+		})
+	}
+
+	var req request.ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "invalid request",
+		})
+	}
+
+	if err := h.userService.ChangePassword(c.Context(), userId, &req); err != nil {
+		if isPasswordPolicyError(err) {
+			return passwordPolicyError(c, err)
+		}
+		if isHasherBusy(err) {
+			return hasherBusyError(c, err)
+		}
+		if errors.Is(err, errorpkg.ErrInvalidCredentials) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"Error": "Current password is incorrect",
+			})
+		}
+		h.logger.Error("failed to change password", zap.Error(err))
+		return c.Status(500).JSON(fiber.Map{
+			"Error": "Failed to change password",
+		})
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"Message": "password changed, please sign in again",
 	})
 }
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/imnzr/user-authentication-go/internal/domain/webhook"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/pkg/request"
+	"github.com/imnzr/user-authentication-go/pkg/response"
+	"go.uber.org/zap"
+)
+
+type WebhookHandler struct {
+	*BaseHandler
+	webhookService webhook.Service
+}
+
+func NewWebhookHandler(webhookService webhook.Service, logger *zap.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		BaseHandler:    NewBaseHandler(logger),
+		webhookService: webhookService,
+	}
+}
+
+func toWebhookResponse(sub *webhook.Subscription, secret string) response.WebhookSubscriptionResponse {
+	events := make([]string, len(sub.Events))
+	for i, e := range sub.Events {
+		events[i] = string(e)
+	}
+	return response.WebhookSubscriptionResponse{
+		Id:     sub.Id,
+		URL:    sub.URL,
+		Events: events,
+		Secret: secret,
+	}
+}
+
+func (h *WebhookHandler) webhookError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errorpkg.ErrWebhookNotFound), errors.Is(err, errorpkg.ErrWebhookDeliveryNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"Error": err.Error(),
+		})
+	case errors.Is(err, errorpkg.ErrWebhookInvalidURL), errors.Is(err, errorpkg.ErrWebhookInvalidEvent):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": err.Error(),
+		})
+	}
+
+	h.logger.Error("webhook request failed", zap.Error(err))
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"Error": "internal server error",
+	})
+}
+
+func (h *WebhookHandler) CreateSubscription(c *fiber.Ctx) error {
+	var req request.WebhookSubscriptionRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "invalid request",
+		})
+	}
+	adminId, _ := c.Locals("userId").(int)
+
+	sub, secret, err := h.webhookService.CreateSubscription(c.Context(), &req, adminId)
+	if err != nil {
+		return h.webhookError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(toWebhookResponse(sub, secret))
+}
+
+func (h *WebhookHandler) ListSubscriptions(c *fiber.Ctx) error {
+	subs, err := h.webhookService.ListSubscriptions(c.Context())
+	if err != nil {
+		return h.webhookError(c, err)
+	}
+
+	result := make([]response.WebhookSubscriptionResponse, 0, len(subs))
+	for _, sub := range subs {
+		result = append(result, toWebhookResponse(sub, ""))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *WebhookHandler) DeleteSubscription(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "invalid subscription id",
+		})
+	}
+	adminId, _ := c.Locals("userId").(int)
+
+	if err := h.webhookService.DeleteSubscription(c.Context(), id, adminId); err != nil {
+		return h.webhookError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *WebhookHandler) RotateSecret(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "invalid subscription id",
+		})
+	}
+	adminId, _ := c.Locals("userId").(int)
+
+	secret, err := h.webhookService.RotateSecret(c.Context(), id, adminId)
+	if err != nil {
+		return h.webhookError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"secret": secret,
+	})
+}
+
+func (h *WebhookHandler) ListDeliveries(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "invalid subscription id",
+		})
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(c.Context(), id, c.QueryInt("limit", 50))
+	if err != nil {
+		return h.webhookError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(deliveries)
+}
+
+func (h *WebhookHandler) ReplayDelivery(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"Error": "invalid delivery id",
+		})
+	}
+	adminId, _ := c.Locals("userId").(int)
+
+	delivery, err := h.webhookService.ReplayDelivery(c.Context(), id, adminId)
+	if err != nil {
+		return h.webhookError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(delivery)
+}
@@ -2,17 +2,24 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/imnzr/user-authentication-go/internal/config"
-	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	"github.com/imnzr/user-authentication-go/internal/domain/revocation"
+	"github.com/imnzr/user-authentication-go/internal/domain/session"
+	"github.com/imnzr/user-authentication-go/internal/domain/user"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
 	"github.com/imnzr/user-authentication-go/pkg/auth"
 )
 
-func AuthMiddleware(ctx context.Context, jwtManager auth.AuthManager, cfg config.Config, redis *redis.RedisClient) fiber.Handler {
+func AuthMiddleware(ctx context.Context, jwtManager auth.AuthManager, cfg config.Config, revocations revocation.Store, sessions session.Service, epochs user.TokenEpochStore) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -20,13 +27,6 @@ func AuthMiddleware(ctx context.Context, jwtManager auth.AuthManager, cfg config
 				"Error": "authorization header is missing",
 			})
 		}
-		// Check redis blacklist
-		if val, _ := redis.Client.Get(c.Context(), authHeader).Result(); val == "blacklisted" {
-			return c.Status(500).JSON(fiber.Map{
-				"Error": "Token revoked",
-			})
-		}
-
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -42,6 +42,27 @@ func AuthMiddleware(ctx context.Context, jwtManager auth.AuthManager, cfg config
 			})
 		}
 
+		// Refresh and emailed action tokens are signed with the same key but only access
+		// tokens open protected routes
+		if tokenType, _ := claims["type"].(string); tokenType != "access" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"Error": "invalid token type",
+			})
+		}
+
+		// Tokens signed out with logout, the store applies the Redis failure policy
+		revoked, err := revocations.IsRevoked(c.Context(), tokenString, claims)
+		if err != nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"Error": "failed to validate token",
+			})
+		}
+		if revoked {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"Error": errorpkg.ErrTokenRevoked.Error(),
+			})
+		}
+
 		userIdFloat, ok := claims["user_id"].(float64)
 		if !ok {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -50,7 +71,77 @@ func AuthMiddleware(ctx context.Context, jwtManager auth.AuthManager, cfg config
 		}
 		userID := int(userIdFloat)
 
+		// Tokens from before a "sign out everywhere" carry an older epoch
+		tokenEpoch, ok := claims["epoch"].(float64)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"Error": "invalid epoch in token claims",
+			})
+		}
+		currentEpoch, err := epochs.Current(c.Context(), userID)
+		if err != nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"Error": "failed to validate token",
+			})
+		}
+		if int(tokenEpoch) < currentEpoch {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"Error": errorpkg.ErrTokenRevoked.Error(),
+			})
+		}
+
+		sessionId, ok := claims["sid"].(string)
+		if !ok || sessionId == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"Error": "invalid session in token claims",
+			})
+		}
+		revoked, err = sessions.IsRevoked(c.Context(), sessionId)
+		if err != nil && cfg.RedisFailure.Revocation == config.FailClosed {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"Error": "failed to validate token",
+			})
+		}
+		if revoked {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"Error": "Session revoked",
+			})
+		}
+		sessions.Touch(c.Context(), sessionId)
+
 		c.Locals("userId", userID)
+		c.Locals("sessionId", sessionId)
+
+		return c.Next()
+	}
+}
+
+// AdminMiddleware must run after AuthMiddleware, it only lets admin users through
+func AdminMiddleware(userService user.Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userId, ok := c.Locals("userId").(int)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"Error": "user id not found in context",
+			})
+		}
+
+		u, err := userService.GetById(c.Context(), userId)
+		if errors.Is(err, errorpkg.ErrUserNotFound) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"Error": "user not found",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"Error": "failed to load user",
+			})
+		}
+		if u.Role != user.RoleAdmin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"Error": "admin access required",
+			})
+		}
 
 		return c.Next()
 	}
@@ -64,3 +155,46 @@ func CORS() fiber.Handler {
 		AllowCredentials: true,
 	})
 }
+
+// Longest values kept, they match the audit_events columns
+const (
+	maxRequestIdLength = 64
+	maxUserAgentLength = 512
+)
+
+// RequestID keeps the caller's X-Request-ID or generates one, and echoes it back
+func RequestID() fiber.Handler {
+	return requestid.New()
+}
+
+// ReadYourWrites sends the reads of a request to the primary once it has written,
+// so users see their own changes while replicas catch up
+func ReadYourWrites() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Context().SetUserValue(database.WriteTrackerKey, database.NewWriteTracker())
+		return c.Next()
+	}
+}
+
+// RequestInfo makes the client IP, user agent and request id available to services
+// through the request context, for the audit trail
+func RequestInfo() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestId, _ := c.Locals("requestid").(string)
+		if len(requestId) > maxRequestIdLength {
+			requestId = requestId[:maxRequestIdLength]
+		}
+
+		userAgent := c.Get(fiber.HeaderUserAgent)
+		if len(userAgent) > maxUserAgentLength {
+			userAgent = userAgent[:maxUserAgentLength]
+		}
+
+		c.Context().SetUserValue(audit.RequestInfoKey, audit.RequestInfo{
+			IPAddress: c.IP(),
+			UserAgent: userAgent,
+			RequestId: requestId,
+		})
+		return c.Next()
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/ratelimit"
+)
+
+// Requests without a value to key on, like a body with no email, share one bucket per policy
+// so leaving the value out can't get around the limit
+const sharedRateLimitKey = "-"
+
+// RateLimit throttles a route with the named policies, every policy must allow the request
+// failurePolicy decides whether requests go through (config.FailOpen) or get a 503
+// (config.FailClosed) while the limiter can't reach Redis. An unknown policy name is an error,
+// a typo would otherwise leave the route unthrottled. Emails are keyed by emailIndex, their
+// blind index, so Redis never holds them in the clear.
+func RateLimit(limiter ratelimit.Limiter, emailIndex func(email string) string, cfg config.RateLimitConfig, failurePolicy string, names ...string) (fiber.Handler, error) {
+	policies := make([]config.RateLimitPolicy, 0, len(names))
+	for _, name := range names {
+		policy, ok := cfg.Policies[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown rate limit policy %q", name)
+		}
+		policies = append(policies, policy)
+	}
+
+	return func(c *fiber.Ctx) error {
+		if !cfg.Enabled {
+			return c.Next()
+		}
+
+		// Headers describe the most restrictive policy
+		var reported *ratelimit.Result
+
+		for _, policy := range policies {
+			key := rateLimitKey(c, policy.KeyBy, emailIndex)
+			if key == "" {
+				key = sharedRateLimitKey
+			}
+
+			result, err := limiter.Allow(c.Context(), policy, key)
+			if err != nil {
+				if failurePolicy == config.FailOpen {
+					continue
+				}
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"Error": "rate limiter unavailable, try again later",
+				})
+			}
+
+			if reported == nil || !result.Allowed || result.Remaining < reported.Remaining {
+				setRateLimitHeaders(c, policy, result)
+				reported = result
+			}
+			if !result.Allowed {
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+					"Error": "too many requests, try again later",
+				})
+			}
+		}
+
+		return c.Next()
+	}, nil
+}
+
+func rateLimitKey(c *fiber.Ctx, keyBy string, emailIndex func(email string) string) string {
+	switch keyBy {
+	case config.RateLimitByIP:
+		return c.IP()
+	case config.RateLimitByUser:
+		if userId, ok := c.Locals("userId").(int); ok {
+			return strconv.Itoa(userId)
+		}
+	case config.RateLimitByEmail:
+		// Parsed like the handlers do, JSON and form bodies alike
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := c.BodyParser(&body); err == nil && strings.TrimSpace(body.Email) != "" {
+			return emailIndex(body.Email)
+		}
+	}
+	return ""
+}
+
+// setRateLimitHeaders follows the IETF RateLimit header fields draft
+func setRateLimitHeaders(c *fiber.Ctx, policy config.RateLimitPolicy, result *ratelimit.Result) {
+	c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+	c.Set("RateLimit-Policy", strconv.Itoa(policy.Limit)+";w="+strconv.Itoa(ceilSeconds(policy.Period)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
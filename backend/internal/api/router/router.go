@@ -4,52 +4,202 @@ import (
 	"context"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/imnzr/user-authentication-go/internal/api/handler"
 	"github.com/imnzr/user-authentication-go/internal/api/middleware"
 	"github.com/imnzr/user-authentication-go/internal/config"
 	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	"github.com/imnzr/user-authentication-go/internal/ratelimit"
 	"github.com/imnzr/user-authentication-go/internal/repository"
 	"github.com/imnzr/user-authentication-go/internal/repository/redis"
 	"github.com/imnzr/user-authentication-go/internal/service"
 	"github.com/imnzr/user-authentication-go/pkg/auth"
+	"github.com/imnzr/user-authentication-go/pkg/breaker"
+	"github.com/imnzr/user-authentication-go/pkg/mailer"
+	"github.com/imnzr/user-authentication-go/pkg/password"
+	"github.com/imnzr/user-authentication-go/pkg/pii"
+	"github.com/imnzr/user-authentication-go/pkg/syslog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
-func New(cfg *config.Config, db *database.DB, logger *zap.Logger) *fiber.App {
+func New(cfg *config.Config, db *database.DB, redisClient redis.Client, logger *zap.Logger) *fiber.App {
 	// Initialize auth manager
 	authManager := auth.NewJWTManager(*cfg)
 
+	// Emails and usernames are encrypted at rest
+	keyring, err := pii.LoadKeyring(cfg.PII.MasterKeyFile, cfg.PII.BlindIndexKeyFile)
+	if err != nil {
+		logger.Fatal("failed to load pii keys", zap.Error(err))
+	}
+
 	// Initialize repository
-	userRepo := repository.NewUserRepository(db.Primary)
+	userRepo := repository.NewUserRepository(db, keyring)
 
 	// Initialize transaction manager
-	txManager := database.NewTxManager(db.Primary)
+	txManager := database.NewTxManager(db)
+
+	// Every redis call goes through one breaker so an outage is detected once
+	// and each check answers according to its failure policy.
+	redisBreaker, err := breaker.New("redis", breaker.Config{
+		Threshold: cfg.RedisFailure.BreakerThreshold,
+		Cooldown:  cfg.RedisFailure.BreakerCooldown,
+	}, redis.IsFailure, prometheus.DefaultRegisterer)
+	if err != nil {
+		logger.Fatal("failed to initialize redis circuit breaker", zap.Error(err))
+	}
+	redisRepo := redis.NewBreakerClient(redisClient, redisBreaker)
+
+	webhookRepo := repository.NewWebhookRepository(db)
+	deviceRepo := repository.NewDeviceRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
 
-	// Initialize redis
-	redisClient := redis.NewRedisClient(cfg.RedisCfg.RedisAddr, cfg.RedisCfg.RedisPass, cfg.RedisCfg.RedisDB)
+	// Initialize mailer
+	mail := mailer.New(cfg.Mail, logger)
+
+	// Initialize password policy
+	passwordPolicy, err := password.NewPolicy(cfg.Password)
+	if err != nil {
+		logger.Fatal("failed to load password policy", zap.Error(err))
+	}
+	baseHasher, err := password.NewHasher(cfg.Password)
+	if err != nil {
+		logger.Fatal("failed to initialize password hasher", zap.Error(err))
+	}
+	passwordHasher, err := password.NewPooledHasher(baseHasher, password.PoolConfig{
+		Workers:    cfg.Password.HashWorkers,
+		QueueSize:  cfg.Password.HashQueueSize,
+		RetryAfter: cfg.Password.HashRetryAfter,
+	}, prometheus.DefaultRegisterer)
+	if err != nil {
+		logger.Fatal("failed to start password hash pool", zap.Error(err))
+	}
+
+	// Stream audit events to the SOC when a collector is configured
+	var (
+		auditExporter audit.Exporter
+		syslogWriter  *syslog.Writer
+	)
+	if cfg.Syslog.Address != "" {
+		syslogWriter, err = syslog.New(syslog.Config{
+			Network:               cfg.Syslog.Network,
+			Address:               cfg.Syslog.Address,
+			AppName:               cfg.Syslog.AppName,
+			Facility:              cfg.Syslog.Facility,
+			BufferSize:            cfg.Syslog.BufferSize,
+			TLSCAFile:             cfg.Syslog.TLSCAFile,
+			TLSInsecureSkipVerify: cfg.Syslog.TLSInsecureSkipVerify,
+		}, prometheus.DefaultRegisterer)
+		if err != nil {
+			logger.Fatal("failed to start syslog export", zap.Error(err))
+		}
+		auditExporter, err = service.NewSyslogExporter(syslogWriter, cfg.Syslog)
+		if err != nil {
+			logger.Fatal("failed to start syslog export", zap.Error(err))
+		}
+	}
 
 	// Initialize services
-	userService := service.NewUserService(userRepo, txManager, authManager, redisClient)
+	auditService, err := service.NewAuditService(auditRepo, auditExporter, cfg.Audit, logger)
+	if err != nil {
+		logger.Fatal("failed to initialize audit log", zap.Error(err))
+	}
+	webhookService := service.NewWebhookService(webhookRepo, auditService, cfg.Webhook, logger)
+	deviceService := service.NewDeviceService(deviceRepo, authManager, mail, cfg, logger)
+	sessionService := service.NewSessionService(sessionRepo, redisRepo, auditService, cfg)
+	tokenEpochs := service.NewTokenEpochService(userRepo, redisRepo, logger)
+	revocations := service.NewRevocationStore(redisRepo, cfg.RedisFailure, logger)
+	lockoutService := service.NewLockoutService(userRepo, authManager, redisRepo, mail, auditService, cfg, logger)
+	userService := service.NewUserService(userRepo, txManager, authManager, redisRepo, webhookService, auditService, deviceService, sessionService, tokenEpochs, revocations, lockoutService, passwordPolicy, passwordHasher, mail, cfg, logger)
+
+	// Catch up rows left in plaintext or wrapped by a rotated master key
+	if cfg.PII.ReencryptOnStartup {
+		go service.NewPIIReencryptor(userRepo, cfg.PII, logger).Run(context.Background())
+	}
 
 	// Initialize handle
 	userHandler := handler.NewUserHandler(userService, logger, authManager)
+	webhookHandler := handler.NewWebhookHandler(webhookService, logger)
+	sessionHandler := handler.NewSessionHandler(sessionService, logger)
+	lockoutHandler := handler.NewLockoutHandler(lockoutService, logger)
+	auditHandler := handler.NewAuditHandler(auditService, logger)
+	healthHandler := handler.NewHealthHandler(db, redisRepo, redisBreaker, logger)
 
 	// Create Fiber APP
 	app := fiber.New()
 
+	// Stop background workers when the server shuts down
+	app.Hooks().OnShutdown(func() error {
+		webhookService.Close()
+		auditService.Close()
+		if syslogWriter != nil {
+			syslogWriter.Close()
+		}
+		passwordHasher.Close()
+		return nil
+	})
+
 	// Global Middleware
 	app.Use(middleware.CORS())
+	app.Use(middleware.RequestID())
+	app.Use(middleware.RequestInfo())
+	app.Use(middleware.ReadYourWrites())
+
+	limiter := ratelimit.NewRedisLimiter(redisRepo)
+	rateLimit := func(policies ...string) fiber.Handler {
+		handler, err := middleware.RateLimit(limiter, userRepo.EmailIndex, cfg.RateLimit, cfg.RedisFailure.RateLimit, policies...)
+		if err != nil {
+			logger.Fatal("failed to set up rate limiting", zap.Error(err))
+		}
+		return handler
+	}
+
+	authMiddleware := middleware.AuthMiddleware(context.Background(), authManager, *cfg, revocations, sessionService, tokenEpochs)
+
+	// Prometheus metrics
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+	app.Get("/health", healthHandler.Health)
 
 	// API Routes
 	api := app.Group("/api/v1")
 
 	// Auth Routes
 	authRoutes := api.Group("/auth")
-	authRoutes.Post("/signup", userHandler.CreateUser)
-	authRoutes.Post("/signin", userHandler.LoginUser)
-	authRoutes.Get("/profile", middleware.AuthMiddleware(context.Background(), authManager, *cfg, redisClient), userHandler.GetProfile)
-	authRoutes.Get("/verify/:token", userHandler.VerifyEmail)
-	authRoutes.Post("/logout", middleware.AuthMiddleware(context.Background(), authManager, *cfg, redisClient), userHandler.LogoutUser)
+	authRoutes.Post("/signup", rateLimit("signup_ip"), userHandler.CreateUser)
+	authRoutes.Post("/signin", rateLimit("signin_ip", "signin_email"), userHandler.LoginUser)
+	authRoutes.Get("/profile", authMiddleware, userHandler.GetProfile)
+	authRoutes.Get("/verify/:token", rateLimit("verify_ip"), userHandler.VerifyEmail)
+	authRoutes.Post("/resend-verification", rateLimit("verify_ip", "verify_email"), userHandler.ResendVerification)
+	authRoutes.Post("/forgot-password", rateLimit("password_ip", "password_email"), userHandler.ForgotPassword)
+	authRoutes.Post("/reset-password", rateLimit("password_ip", "password_email"), userHandler.ResetPassword)
+	authRoutes.Get("/not-me/:token", rateLimit("verify_ip"), userHandler.ConfirmUnrecognizedLogin)
+	authRoutes.Post("/not-me/:token", rateLimit("verify_ip"), userHandler.ReportUnrecognizedLogin)
+	authRoutes.Get("/unlock/:token", rateLimit("verify_ip"), lockoutHandler.ConfirmUnlock)
+	authRoutes.Post("/unlock/:token", rateLimit("verify_ip"), lockoutHandler.UnlockWithToken)
+	authRoutes.Post("/logout", authMiddleware, userHandler.LogoutUser)
+	authRoutes.Post("/logout-all", authMiddleware, userHandler.LogoutAll)
+	authRoutes.Post("/change-password", authMiddleware, rateLimit("password_ip"), userHandler.ChangePassword)
+	authRoutes.Get("/sessions", authMiddleware, rateLimit("sessions_user"), sessionHandler.ListSessions)
+	authRoutes.Delete("/sessions/:id", authMiddleware, rateLimit("sessions_user"), sessionHandler.RevokeSession)
+	authRoutes.Get("/activity", authMiddleware, rateLimit("activity_user"), auditHandler.MyActivity)
+
+	// Admin Routes
+	adminRoutes := api.Group("/admin", authMiddleware, middleware.AdminMiddleware(userService))
+	adminRoutes.Post("/users/:id/suspend", userHandler.SuspendUser)
+	adminRoutes.Post("/users/:id/unlock", lockoutHandler.AdminUnlock)
+	adminRoutes.Get("/audit", auditHandler.ListEvents)
+	adminRoutes.Get("/audit/verify", auditHandler.VerifyChain)
+	adminRoutes.Get("/audit/checkpoints", auditHandler.ExportCheckpoints)
+	adminRoutes.Post("/audit/checkpoints", auditHandler.CreateCheckpoints)
+	adminRoutes.Post("/webhooks", webhookHandler.CreateSubscription)
+	adminRoutes.Get("/webhooks", webhookHandler.ListSubscriptions)
+	adminRoutes.Delete("/webhooks/:id", webhookHandler.DeleteSubscription)
+	adminRoutes.Post("/webhooks/:id/rotate-secret", webhookHandler.RotateSecret)
+	adminRoutes.Get("/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+	adminRoutes.Post("/webhooks/deliveries/:id/replay", webhookHandler.ReplayDelivery)
 
 	return app
 }
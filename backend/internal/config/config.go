@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -15,6 +17,15 @@ type Config struct {
 	Logger       LoggerConfig   `json:"logger"`
 	JSONWebToken JWTConfig      `json:"json_web_token"`
 	RedisCfg     RedisConfig
+	RedisFailure RedisFailureConfig `json:"redis_failure"`
+	Webhook      WebhookConfig      `json:"webhook"`
+	Mail         MailConfig         `json:"mail"`
+	RateLimit    RateLimitConfig    `json:"rate_limit"`
+	Lockout      LockoutConfig      `json:"lockout"`
+	Password     PasswordConfig     `json:"password"`
+	Audit        AuditConfig        `json:"audit"`
+	Syslog       SyslogConfig       `json:"syslog"`
+	PII          PIIConfig          `json:"pii"`
 }
 
 type ServerConfig struct {
@@ -23,6 +34,7 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `json:"read_timeout"`
 	WriteTimeout time.Duration `json:"write_timeout"`
 	IdleTimeout  time.Duration `json:"idle_timeout"`
+	BaseURL      string        `json:"base_url"`
 }
 
 type LoggerConfig struct {
@@ -31,19 +43,168 @@ type LoggerConfig struct {
 }
 
 type JWTConfig struct {
-	JWTSecretKey         string        `json:"jwt_secret_key"`
+	JWTSecretKey         Secret        `json:"jwt_secret_key"`
 	AccessTokenDuration  time.Duration `json:"access_token"`
 	RefreshTokenDuration time.Duration `json:"refresh_token"`
 }
 
+type WebhookConfig struct {
+	Workers     int           `json:"workers"`
+	QueueSize   int           `json:"queue_size"`
+	MaxAttempts int           `json:"max_attempts"`
+	Timeout     time.Duration `json:"timeout"`
+	BackoffBase time.Duration `json:"backoff_base"`
+	BackoffMax  time.Duration `json:"backoff_max"`
+	// How often due deliveries are loaded from the database
+	SweepInterval time.Duration `json:"sweep_interval"`
+	// How long a queued delivery may take before the sweeper hands it out again
+	DeliveryLease time.Duration `json:"delivery_lease"`
+	// Lets subscriptions target loopback and private addresses, for receivers on a
+	// development machine. Off, those are refused so a URL can't reach internal services.
+	AllowPrivateNetworks bool `json:"allow_private_networks"`
+}
+
+type LockoutConfig struct {
+	// Failed attempts before every further attempt is delayed
+	DelayAfter int           `json:"delay_after"`
+	BaseDelay  time.Duration `json:"base_delay"`
+	MaxDelay   time.Duration `json:"max_delay"`
+	// Failed attempts before the account is locked
+	Threshold int           `json:"threshold"`
+	Cooldown  time.Duration `json:"cooldown"`
+}
+
+type PasswordConfig struct {
+	MinLength   int      `json:"min_length"`
+	MaxLength   int      `json:"max_length"`
+	BannedWords []string `json:"banned_words"`
+	// HIBP SHA-1 list, a sorted file or a directory of range files
+	BreachedListPath string `json:"breached_list_path"`
+
+	// Hashing, argon2id or bcrypt. Both are always accepted when verifying.
+	HashAlgorithm     string `json:"hash_algorithm"`
+	Argon2Memory      uint32 `json:"argon2_memory"`
+	Argon2Iterations  uint32 `json:"argon2_iterations"`
+	Argon2Parallelism uint8  `json:"argon2_parallelism"`
+	BcryptCost        int    `json:"bcrypt_cost"`
+
+	// Bounded pool hashes run on, requests past the queue get a 503
+	HashWorkers    int           `json:"hash_workers"`
+	HashQueueSize  int           `json:"hash_queue_size"`
+	HashRetryAfter time.Duration `json:"hash_retry_after"`
+}
+
+type AuditConfig struct {
+	// Base64 ed25519 seed used to sign chain checkpoints, checkpoints are off without it
+	CheckpointSigningKey Secret        `json:"checkpoint_signing_key"`
+	CheckpointInterval   time.Duration `json:"checkpoint_interval"`
+}
+
+// SyslogConfig streams audit events to a SOC collector, off while Address is empty
+type SyslogConfig struct {
+	Address string `json:"address"`
+	// udp, tcp or tls
+	Network string `json:"network"`
+	// cef or json
+	Format     string `json:"format"`
+	AppName    string `json:"app_name"`
+	Facility   int    `json:"facility"`
+	BufferSize int    `json:"buffer_size"`
+	// Action prefixes to export, everything when empty
+	Actions               []string `json:"actions"`
+	TLSCAFile             string   `json:"tls_ca_file"`
+	TLSInsecureSkipVerify bool     `json:"tls_insecure_skip_verify"`
+}
+
+// PIIConfig encrypts emails and usernames at rest, see pii.LoadKeyring for the key file format
+type PIIConfig struct {
+	MasterKeyFile     string `json:"master_key_file"`
+	BlindIndexKeyFile string `json:"blind_index_key_file"`
+	// Encrypt plaintext rows and rewrap rows under older master keys when the server starts
+	ReencryptOnStartup bool `json:"reencrypt_on_startup"`
+	ReencryptBatchSize int  `json:"reencrypt_batch_size"`
+}
+
+type MailConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password Secret `json:"password"`
+	From     string `json:"from"`
+}
+
+// Redis drivers
+const (
+	RedisDriverRedis = "redis"
+	// Keys kept in process, for development and tests. Not shared between instances.
+	RedisDriverMemory = "memory"
+)
+
+// Redis topologies
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
 type RedisConfig struct {
-	DBUrl     string
-	RedisAddr string
-	RedisPass string
-	RedisDB   int
+	Driver string `json:"driver"`
+	// standalone, sentinel or cluster
+	Mode string `json:"mode"`
+	// redis:// or rediss:// URL, used instead of the address fields when set. May carry a password.
+	URL Secret `json:"url"`
+	// The server, or every sentinel or cluster seed node
+	Addrs    []string `json:"addrs"`
+	Username string   `json:"username"`
+	Password Secret   `json:"password"`
+	DB       int      `json:"db"`
+
+	SentinelMaster   string `json:"sentinel_master"`
+	SentinelPassword Secret `json:"sentinel_password"`
+
+	TLS                   bool   `json:"tls"`
+	TLSCAFile             string `json:"tls_ca_file"`
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify"`
+
+	// 0 keeps the go-redis default of 10 per CPU
+	PoolSize     int           `json:"pool_size"`
+	MinIdleConns int           `json:"min_idle_conns"`
+	PoolTimeout  time.Duration `json:"pool_timeout"`
+	DialTimeout  time.Duration `json:"dial_timeout"`
+	ReadTimeout  time.Duration `json:"read_timeout"`
+	WriteTimeout time.Duration `json:"write_timeout"`
+	MaxRetries   int           `json:"max_retries"`
+
+	// Pings at startup before carrying on degraded, the wait doubles after each one
+	ConnectAttempts int           `json:"connect_attempts"`
+	ConnectBackoff  time.Duration `json:"connect_backoff"`
+}
+
+// What a check does while Redis is unreachable
+const (
+	// Carry on as if Redis had no entry
+	FailOpen = "open"
+	// Refuse the request with a 503
+	FailClosed = "closed"
+)
+
+// RedisFailureConfig sets the policy of each Redis backed check and the breaker in front of Redis
+type RedisFailureConfig struct {
+	// Revoked tokens and sessions, recent revocations are still honoured from a local cache
+	Revocation string `json:"revocation"`
+	RateLimit  string `json:"rate_limit"`
+	// Issuing password reset codes, open answers as if the code was sent. Checking a code
+	// always needs Redis.
+	OTP string `json:"otp"`
+
+	BreakerThreshold int           `json:"breaker_threshold"`
+	BreakerCooldown  time.Duration `json:"breaker_cooldown"`
+	// Revocations kept in process
+	RevocationCacheSize int `json:"revocation_cache_size"`
 }
 
-// Load configuration from environment variables
+// Load configuration from environment variables. Secrets may also be read from a file
+// named by the variable with a _FILE suffix, e.g. JWT_SECRET_KEY_FILE.
 func Load() (*Config, error) {
 	// Load .env file if it exists
 	if err := godotenv.Load(); err != nil {
@@ -52,6 +213,7 @@ func Load() (*Config, error) {
 	}
 
 	cfg := &Config{}
+	secrets := &secretLoader{}
 
 	// Load server config
 	cfg.Server = ServerConfig{
@@ -60,6 +222,7 @@ func Load() (*Config, error) {
 		ReadTimeout:  getEnvDurationOrDefault("SERVER_READ_TIMEOUT", 30*time.Second),
 		WriteTimeout: getEnvDurationOrDefault("SERVER_WRITE_TIMEOUT", 30*time.Second),
 		IdleTimeout:  getEnvDurationOrDefault("SERVER_IDLE_TIMEOUT", 60*time.Second),
+		BaseURL:      getEnvOrDefault("APP_BASE_URL", "http://localhost:8080"),
 	}
 
 	// Load database config
@@ -75,17 +238,151 @@ func Load() (*Config, error) {
 
 	// Load JWT config
 	cfg.JSONWebToken = JWTConfig{
-		JWTSecretKey:         os.Getenv("JWT_SECRET_KEY"),
+		JWTSecretKey:         secrets.get("JWT_SECRET_KEY"),
 		AccessTokenDuration:  getEnvDurationOrDefault("ACCESS_TOKEN", 30*time.Second),
 		RefreshTokenDuration: getEnvDurationOrDefault("REFRESH_TOKEN", 60*time.Second),
 	}
 
 	// Load Redis Config
 	cfg.RedisCfg = RedisConfig{
-		DBUrl:     os.Getenv("REDIS_URL"),
-		RedisAddr: os.Getenv("REDIS_ADDR"),
-		RedisPass: os.Getenv("REDIS_PASS"),
-		RedisDB:   getEnvIntOrDefault("REDIS_DB", 0),
+		Driver:                getEnvOrDefault("REDIS_DRIVER", RedisDriverRedis),
+		Mode:                  getEnvOrDefault("REDIS_MODE", RedisModeStandalone),
+		URL:                   secrets.get("REDIS_URL"),
+		Addrs:                 getEnvListOrDefault("REDIS_ADDR", []string{"localhost:6379"}),
+		Username:              os.Getenv("REDIS_USERNAME"),
+		Password:              secrets.get("REDIS_PASS"),
+		DB:                    getEnvIntOrDefault("REDIS_DB", 0),
+		SentinelMaster:        os.Getenv("REDIS_SENTINEL_MASTER"),
+		SentinelPassword:      secrets.get("REDIS_SENTINEL_PASSWORD"),
+		TLS:                   getEnvBoolOrDefault("REDIS_TLS", false),
+		TLSCAFile:             os.Getenv("REDIS_TLS_CA_FILE"),
+		TLSInsecureSkipVerify: getEnvBoolOrDefault("REDIS_TLS_INSECURE_SKIP_VERIFY", false),
+		PoolSize:              getEnvIntOrDefault("REDIS_POOL_SIZE", 0),
+		MinIdleConns:          getEnvIntOrDefault("REDIS_MIN_IDLE_CONNS", 0),
+		PoolTimeout:           getEnvDurationOrDefault("REDIS_POOL_TIMEOUT", 4*time.Second),
+		DialTimeout:           getEnvDurationOrDefault("REDIS_DIAL_TIMEOUT", 5*time.Second),
+		ReadTimeout:           getEnvDurationOrDefault("REDIS_READ_TIMEOUT", 3*time.Second),
+		WriteTimeout:          getEnvDurationOrDefault("REDIS_WRITE_TIMEOUT", 3*time.Second),
+		MaxRetries:            getEnvIntOrDefault("REDIS_MAX_RETRIES", 3),
+		ConnectAttempts:       getEnvIntOrDefault("REDIS_CONNECT_ATTEMPTS", 5),
+		ConnectBackoff:        getEnvDurationOrDefault("REDIS_CONNECT_BACKOFF", time.Second),
+	}
+	switch cfg.RedisCfg.Mode {
+	case RedisModeStandalone, RedisModeSentinel, RedisModeCluster:
+	default:
+		return nil, fmt.Errorf("REDIS_MODE must be %q, %q or %q", RedisModeStandalone, RedisModeSentinel, RedisModeCluster)
+	}
+
+	// Load Redis Failure Config
+	cfg.RedisFailure = RedisFailureConfig{
+		Revocation:          getEnvOrDefault("REDIS_FAIL_REVOCATION", FailClosed),
+		RateLimit:           getEnvOrDefault("REDIS_FAIL_RATE_LIMIT", FailOpen),
+		OTP:                 getEnvOrDefault("REDIS_FAIL_OTP", FailClosed),
+		BreakerThreshold:    getEnvIntOrDefault("REDIS_BREAKER_THRESHOLD", 5),
+		BreakerCooldown:     getEnvDurationOrDefault("REDIS_BREAKER_COOLDOWN", 10*time.Second),
+		RevocationCacheSize: getEnvIntOrDefault("REDIS_REVOCATION_CACHE_SIZE", 10000),
+	}
+	for name, policy := range map[string]string{
+		"REDIS_FAIL_REVOCATION": cfg.RedisFailure.Revocation,
+		"REDIS_FAIL_RATE_LIMIT": cfg.RedisFailure.RateLimit,
+		"REDIS_FAIL_OTP":        cfg.RedisFailure.OTP,
+	} {
+		if policy != FailOpen && policy != FailClosed {
+			return nil, fmt.Errorf("%s must be %q or %q", name, FailOpen, FailClosed)
+		}
+	}
+
+	// Load Webhook Config
+	cfg.Webhook = WebhookConfig{
+		Workers:     getEnvIntOrDefault("WEBHOOK_WORKERS", 4),
+		QueueSize:   getEnvIntOrDefault("WEBHOOK_QUEUE_SIZE", 1000),
+		MaxAttempts: getEnvIntOrDefault("WEBHOOK_MAX_ATTEMPTS", 5),
+		Timeout:     getEnvDurationOrDefault("WEBHOOK_TIMEOUT", 10*time.Second),
+		BackoffBase: getEnvDurationOrDefault("WEBHOOK_BACKOFF_BASE", 5*time.Second),
+		BackoffMax:  getEnvDurationOrDefault("WEBHOOK_BACKOFF_MAX", 10*time.Minute),
+
+		SweepInterval: getEnvDurationOrDefault("WEBHOOK_SWEEP_INTERVAL", 15*time.Second),
+		DeliveryLease: getEnvDurationOrDefault("WEBHOOK_DELIVERY_LEASE", 5*time.Minute),
+
+		AllowPrivateNetworks: getEnvBoolOrDefault("WEBHOOK_ALLOW_PRIVATE_NETWORKS", false),
+	}
+	if cfg.Webhook.SweepInterval <= 0 || cfg.Webhook.DeliveryLease <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_SWEEP_INTERVAL and WEBHOOK_DELIVERY_LEASE must be positive")
+	}
+
+	// Load Rate Limit Config
+	if err := loadRateLimitConfig(&cfg.RateLimit); err != nil {
+		return nil, fmt.Errorf("failed to load rate limit config: %w", err)
+	}
+
+	// Load Lockout Config
+	cfg.Lockout = LockoutConfig{
+		DelayAfter: getEnvIntOrDefault("LOCKOUT_DELAY_AFTER", 3),
+		BaseDelay:  getEnvDurationOrDefault("LOCKOUT_BASE_DELAY", 1*time.Second),
+		MaxDelay:   getEnvDurationOrDefault("LOCKOUT_MAX_DELAY", 30*time.Second),
+		Threshold:  getEnvIntOrDefault("LOCKOUT_THRESHOLD", 10),
+		Cooldown:   getEnvDurationOrDefault("LOCKOUT_COOLDOWN", 15*time.Minute),
+	}
+
+	// Load Password Policy Config
+	cfg.Password = PasswordConfig{
+		MinLength:        getEnvIntOrDefault("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:        getEnvIntOrDefault("PASSWORD_MAX_LENGTH", 72),
+		BannedWords:      getEnvListOrDefault("PASSWORD_BANNED_WORDS", []string{"password", "qwerty"}),
+		BreachedListPath: os.Getenv("PASSWORD_BREACHED_LIST"),
+
+		HashAlgorithm:     getEnvOrDefault("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		Argon2Memory:      uint32(getEnvIntOrDefault("ARGON2_MEMORY_KIB", 64*1024)),
+		Argon2Iterations:  uint32(getEnvIntOrDefault("ARGON2_ITERATIONS", 3)),
+		Argon2Parallelism: uint8(getEnvIntOrDefault("ARGON2_PARALLELISM", 2)),
+		BcryptCost:        getEnvIntOrDefault("BCRYPT_COST", 10),
+
+		HashWorkers:    getEnvIntOrDefault("PASSWORD_HASH_WORKERS", runtime.NumCPU()),
+		HashQueueSize:  getEnvIntOrDefault("PASSWORD_HASH_QUEUE_SIZE", 4*runtime.NumCPU()),
+		HashRetryAfter: getEnvDurationOrDefault("PASSWORD_HASH_RETRY_AFTER", time.Second),
+	}
+
+	// Load Audit Config
+	cfg.Audit = AuditConfig{
+		CheckpointSigningKey: secrets.get("AUDIT_CHECKPOINT_SIGNING_KEY"),
+		CheckpointInterval:   getEnvDurationOrDefault("AUDIT_CHECKPOINT_INTERVAL", time.Hour),
+	}
+
+	// Load Syslog Config
+	cfg.Syslog = SyslogConfig{
+		Address:               os.Getenv("SYSLOG_ADDRESS"),
+		Network:               getEnvOrDefault("SYSLOG_NETWORK", "udp"),
+		Format:                getEnvOrDefault("SYSLOG_FORMAT", "cef"),
+		AppName:               getEnvOrDefault("SYSLOG_APP_NAME", "user-auth"),
+		Facility:              getEnvIntOrDefault("SYSLOG_FACILITY", 10),
+		BufferSize:            getEnvIntOrDefault("SYSLOG_BUFFER_SIZE", 1000),
+		Actions:               getEnvListOrDefault("SYSLOG_ACTIONS", nil),
+		TLSCAFile:             os.Getenv("SYSLOG_TLS_CA_FILE"),
+		TLSInsecureSkipVerify: getEnvBoolOrDefault("SYSLOG_TLS_INSECURE_SKIP_VERIFY", false),
+	}
+
+	// Load PII Config
+	cfg.PII = PIIConfig{
+		MasterKeyFile:      os.Getenv("PII_MASTER_KEY_FILE"),
+		BlindIndexKeyFile:  os.Getenv("PII_BLIND_INDEX_KEY_FILE"),
+		ReencryptOnStartup: getEnvBoolOrDefault("PII_REENCRYPT_ON_STARTUP", true),
+		ReencryptBatchSize: getEnvIntOrDefault("PII_REENCRYPT_BATCH_SIZE", 500),
+	}
+
+	// Load Mail Config
+	cfg.Mail = MailConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     getEnvIntOrDefault("SMTP_PORT", 587),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: secrets.get("SMTP_PASSWORD"),
+		From:     getEnvOrDefault("SMTP_FROM", "no-reply@localhost"),
+	}
+
+	if err := secrets.err(); err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+	if err := cfg.validateSecrets(); err != nil {
+		return nil, fmt.Errorf("invalid secrets: %w", err)
 	}
 
 	return cfg, nil
@@ -117,6 +414,19 @@ func getEnvBoolOrDefault(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+func getEnvListOrDefault(key string, defaultValue []string) []string {
+	if value := os.Getenv(key); value != "" {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+	return defaultValue
+}
+
 func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
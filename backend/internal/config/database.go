@@ -2,15 +2,33 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Database drivers
+const (
+	DatabaseDriverMySQL    = "mysql"
+	DatabaseDriverPostgres = "postgres"
+	DatabaseDriverSQLite   = "sqlite"
+)
+
 type DatabaseConfig struct {
-	Primary   MySQLConnection `json:"primary"`
-	MySQL     MySQLConfig     `json:"mysql"`
-	Pool      PoolConfig      `json:"pool"`
-	Migration MigrationConfig `json:"migration"`
+	// mysql, postgres or sqlite. The connection fields below are used by mysql and postgres,
+	// sqlite only reads Primary.Database as the file path.
+	Driver  string          `json:"driver"`
+	Primary MySQLConnection `json:"primary"`
+	// Replicas share the primary's database, credentials and options
+	Replicas    []MySQLConnection `json:"replicas"`
+	Replica     ReplicaConfig     `json:"replica"`
+	MySQL       MySQLConfig       `json:"mysql"`
+	Pool        PoolConfig        `json:"pool"`
+	Migration   MigrationConfig   `json:"migration"`
+	Transaction TransactionConfig `json:"transaction"`
 }
 
 type MySQLConnection struct {
@@ -18,7 +36,7 @@ type MySQLConnection struct {
 	Port      int    `json:"port"`
 	Database  string `json:"database"`
 	Username  string `json:"username"`
-	Password  string `json:"password"`
+	Password  Secret `json:"password"`
 	Charset   string `json:"charset"`
 	Collation string `json:"collation"`
 	ParseTime bool   `json:"parse_time"`
@@ -42,17 +60,33 @@ type PoolConfig struct {
 	ConnMaxIdleTime time.Duration `json:"conn_max_idle_time"`
 }
 
+type ReplicaConfig struct {
+	// How often replicas are pinged, a replica that fails is skipped until it answers again
+	HealthCheckInterval time.Duration `json:"health_check_interval"`
+	HealthCheckTimeout  time.Duration `json:"health_check_timeout"`
+}
+
 type MigrationConfig struct {
-	Enabled   bool   `json:"enabled"`
+	Enabled bool `json:"enabled"`
+	// Empty uses the migrations embedded in the binary
 	Directory string `json:"directory"`
+	// How long to wait for another instance that is migrating
+	LockTimeout time.Duration `json:"lock_timeout"`
 }
 
-// Build MySQL DSN (Data Source Name)
+type TransactionConfig struct {
+	// How often a transaction that hit a deadlock or lock wait timeout is run again
+	MaxRetries int `json:"max_retries"`
+	// Wait before the first retry, doubled for each one after it
+	RetryBackoff time.Duration `json:"retry_backoff"`
+}
+
+// Build MySQL DSN (Data Source Name). It holds the password, never log it.
 func (m *MySQLConnection) DSN() string {
 	return fmt.Sprintf(
 		"%s:%s@tcp(%s:%d)/%s?charset=%s&collation=%s&parseTime=%t&loc=%s&tls=%s",
 		m.Username,
-		m.Password,
+		m.Password.Value(),
 		m.Host,
 		m.Port,
 		m.Database,
@@ -80,15 +114,63 @@ func (m *MySQLConnection) DSNWithParams(mysqlCfg MySQLConfig) string {
 	return baseDSN + params
 }
 
-// Load MySQL configuration from environment
+// PostgresDSN builds a pgx connection URL. DB_TLS keeps its MySQL values, they map to
+// sslmode, anything else is passed through as the sslmode itself.
+func (m *MySQLConnection) PostgresDSN(mysqlCfg MySQLConfig) string {
+	sslMode := m.TLS
+	switch m.TLS {
+	case "false":
+		sslMode = "disable"
+	case "true":
+		sslMode = "verify-full"
+	case "skip-verify":
+		sslMode = "require"
+	case "preferred":
+		sslMode = "prefer"
+	}
+
+	params := url.Values{}
+	params.Set("sslmode", sslMode)
+	params.Set("timezone", m.Loc)
+	params.Set("connect_timeout", strconv.Itoa(int(mysqlCfg.Timeout.Seconds())))
+	// READ-COMMITTED becomes read committed
+	params.Set("default_transaction_isolation", strings.ToLower(strings.ReplaceAll(mysqlCfg.TxIsolation, "-", " ")))
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(m.Username, m.Password.Value()),
+		Host:     net.JoinHostPort(m.Host, strconv.Itoa(m.Port)),
+		Path:     "/" + m.Database,
+		RawQuery: params.Encode(),
+	}
+	return dsn.String()
+}
+
+// Load database configuration from environment
 func loadDatabaseConfig(cfg *DatabaseConfig) error {
+	password, err := getSecret("DB_PASSWORD")
+	if err != nil {
+		return err
+	}
+
+	cfg.Driver = getEnvOrDefault("DB_DRIVER", DatabaseDriverMySQL)
+	defaultPort := 3306
+	switch cfg.Driver {
+	case DatabaseDriverMySQL:
+	case DatabaseDriverPostgres:
+		defaultPort = 5432
+	case DatabaseDriverSQLite:
+	default:
+		return fmt.Errorf("DB_DRIVER must be %s, %s or %s, got %q", DatabaseDriverMySQL, DatabaseDriverPostgres, DatabaseDriverSQLite, cfg.Driver)
+	}
+
 	// Primary database connection
 	cfg.Primary = MySQLConnection{
 		Host:      getEnvOrDefault("DB_HOST", "localhost"),
-		Port:      getEnvIntOrDefault("DB_PORT", 3306),
+		Port:      getEnvIntOrDefault("DB_PORT", defaultPort),
 		Database:  os.Getenv("DB_NAME"),
 		Username:  os.Getenv("DB_USER"),
-		Password:  os.Getenv("DB_PASSWORD"),
+		Password:  password,
 		Charset:   getEnvOrDefault("DB_CHARSET", "utf8mb4"),
 		Collation: getEnvOrDefault("DB_COLLATION", "utf8mb4_unicode_ci"),
 		ParseTime: getEnvBoolOrDefault("DB_PARSE_TIME", true),
@@ -100,11 +182,30 @@ func loadDatabaseConfig(cfg *DatabaseConfig) error {
 	if cfg.Primary.Database == "" {
 		return fmt.Errorf("DB_NAME is required")
 	}
-	if cfg.Primary.Username == "" {
+	if cfg.Primary.Username == "" && cfg.Driver != DatabaseDriverSQLite {
 		return fmt.Errorf("DB_USER is required")
 	}
-	if cfg.Primary.Password == "" {
-		return fmt.Errorf("DB_PASSWORD is required")
+
+	// Read replicas, DB_REPLICAS is a list of host:port
+	cfg.Replicas = nil
+	for _, addr := range getEnvListOrDefault("DB_REPLICAS", nil) {
+		host, port, err := splitHostPort(addr, cfg.Primary.Port)
+		if err != nil {
+			return fmt.Errorf("invalid DB_REPLICAS entry %q: %w", addr, err)
+		}
+		replica := cfg.Primary
+		replica.Host, replica.Port = host, port
+		cfg.Replicas = append(cfg.Replicas, replica)
+	}
+	if len(cfg.Replicas) > 0 && cfg.Driver == DatabaseDriverSQLite {
+		return fmt.Errorf("DB_REPLICAS is not supported with %s", DatabaseDriverSQLite)
+	}
+	cfg.Replica = ReplicaConfig{
+		HealthCheckInterval: getEnvDurationOrDefault("DB_REPLICA_HEALTH_INTERVAL", 5*time.Second),
+		HealthCheckTimeout:  getEnvDurationOrDefault("DB_REPLICA_HEALTH_TIMEOUT", 2*time.Second),
+	}
+	if cfg.Replica.HealthCheckInterval <= 0 || cfg.Replica.HealthCheckTimeout <= 0 {
+		return fmt.Errorf("DB_REPLICA_HEALTH_INTERVAL and DB_REPLICA_HEALTH_TIMEOUT must be positive")
 	}
 
 	// MySQL specific configuration
@@ -127,9 +228,34 @@ func loadDatabaseConfig(cfg *DatabaseConfig) error {
 
 	// Migration configuration
 	cfg.Migration = MigrationConfig{
-		Enabled:   getEnvBoolOrDefault("DB_MIGRATION_ENABLED", true),
-		Directory: getEnvOrDefault("DB_MIGRATION_DIR", "migrations"),
+		Enabled:     getEnvBoolOrDefault("DB_MIGRATION_ENABLED", true),
+		Directory:   getEnvOrDefault("DB_MIGRATION_DIR", ""),
+		LockTimeout: getEnvDurationOrDefault("DB_MIGRATION_LOCK_TIMEOUT", time.Minute),
+	}
+
+	cfg.Transaction = TransactionConfig{
+		MaxRetries:   getEnvIntOrDefault("DB_TX_MAX_RETRIES", 3),
+		RetryBackoff: getEnvDurationOrDefault("DB_TX_RETRY_BACKOFF", 20*time.Millisecond),
+	}
+	if cfg.Transaction.MaxRetries < 0 || cfg.Transaction.RetryBackoff < 0 {
+		return fmt.Errorf("DB_TX_MAX_RETRIES and DB_TX_RETRY_BACKOFF can't be negative")
 	}
 
 	return nil
 }
+
+// splitHostPort accepts host or host:port
+func splitHostPort(addr string, defaultPort int) (string, int, error) {
+	if !strings.Contains(addr, ":") {
+		return addr, defaultPort, nil
+	}
+	host, portString, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q", portString)
+	}
+	return host, port, nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/imnzr/user-authentication-go/pkg/pii"
+	"github.com/joho/godotenv"
+)
+
+// UseDevDefaults sets up the environment for running without external services: SQLite in
+// dir, Redis in memory, and JWT and PII keys generated once into dir so sessions and
+// encrypted rows survive a restart. Call it before Load. Keys that are already configured,
+// in the environment or in .env, are kept; the database and Redis settings are not, a .env
+// written for docker-compose would otherwise point at services that aren't running.
+func UseDevDefaults(dir string) error {
+	godotenv.Load()
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create dev directory: %w", err)
+	}
+
+	os.Setenv("DB_DRIVER", DatabaseDriverSQLite)
+	os.Setenv("REDIS_DRIVER", RedisDriverMemory)
+	os.Setenv("DB_NAME", filepath.Join(dir, "auth.db"))
+	os.Setenv("DB_REPLICAS", "")
+	// Webhook receivers under development run on the same machine
+	if os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "" {
+		os.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	}
+
+	if os.Getenv("JWT_SECRET_KEY") == "" && os.Getenv("JWT_SECRET_KEY_FILE") == "" {
+		file, err := devKeyFile(dir, "jwt_secret", generateDevSecret)
+		if err != nil {
+			return err
+		}
+		os.Setenv("JWT_SECRET_KEY_FILE", file)
+	}
+	if os.Getenv("PII_MASTER_KEY_FILE") == "" {
+		file, err := devKeyFile(dir, "pii_master.key", func() (string, error) {
+			key, err := pii.GenerateKey()
+			return "dev:" + key, err
+		})
+		if err != nil {
+			return err
+		}
+		os.Setenv("PII_MASTER_KEY_FILE", file)
+	}
+	if os.Getenv("PII_BLIND_INDEX_KEY_FILE") == "" {
+		file, err := devKeyFile(dir, "pii_blind_index.key", pii.GenerateKey)
+		if err != nil {
+			return err
+		}
+		os.Setenv("PII_BLIND_INDEX_KEY_FILE", file)
+	}
+	return nil
+}
+
+// devKeyFile returns dir/name, writing a new key into it the first time
+func devKeyFile(dir string, name string, generate func() (string, error)) (string, error) {
+	file := filepath.Join(dir, name)
+	if _, err := os.Stat(file); err == nil {
+		return file, nil
+	}
+
+	key, err := generate()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate %s: %w", name, err)
+	}
+	if err := os.WriteFile(file, []byte(key+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return file, nil
+}
+
+func generateDevSecret() (string, error) {
+	secret := make([]byte, 48)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate limit keys
+const (
+	RateLimitByIP    = "ip"
+	RateLimitByEmail = "email"
+	RateLimitByUser  = "user"
+)
+
+type RateLimitConfig struct {
+	Enabled  bool                       `json:"enabled"`
+	Policies map[string]RateLimitPolicy `json:"policies"`
+}
+
+type RateLimitPolicy struct {
+	Name   string        `json:"name"`
+	Limit  int           `json:"limit"`
+	Period time.Duration `json:"period"`
+	KeyBy  string        `json:"key_by"`
+}
+
+// Default policies, each one can be overridden with RATE_LIMIT_<NAME>=<limit>/<period>
+// e.g. RATE_LIMIT_SIGNIN_EMAIL=5/15m
+var defaultRateLimitPolicies = []RateLimitPolicy{
+	{Name: "signin_ip", Limit: 20, Period: time.Minute, KeyBy: RateLimitByIP},
+	{Name: "signin_email", Limit: 5, Period: 15 * time.Minute, KeyBy: RateLimitByEmail},
+	{Name: "signup_ip", Limit: 5, Period: time.Hour, KeyBy: RateLimitByIP},
+	{Name: "verify_ip", Limit: 10, Period: time.Minute, KeyBy: RateLimitByIP},
+	{Name: "verify_email", Limit: 3, Period: 15 * time.Minute, KeyBy: RateLimitByEmail},
+	{Name: "password_ip", Limit: 10, Period: 15 * time.Minute, KeyBy: RateLimitByIP},
+	{Name: "password_email", Limit: 3, Period: 15 * time.Minute, KeyBy: RateLimitByEmail},
+	{Name: "sessions_user", Limit: 60, Period: time.Minute, KeyBy: RateLimitByUser},
+	{Name: "activity_user", Limit: 60, Period: time.Minute, KeyBy: RateLimitByUser},
+}
+
+// Load rate limit configuration from environment
+func loadRateLimitConfig(cfg *RateLimitConfig) error {
+	cfg.Enabled = getEnvBoolOrDefault("RATE_LIMIT_ENABLED", true)
+	cfg.Policies = make(map[string]RateLimitPolicy, len(defaultRateLimitPolicies))
+
+	for _, policy := range defaultRateLimitPolicies {
+		env := "RATE_LIMIT_" + strings.ToUpper(policy.Name)
+		if value := os.Getenv(env); value != "" {
+			limit, period, err := parseRateLimit(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", env, err)
+			}
+			policy.Limit = limit
+			policy.Period = period
+		}
+		cfg.Policies[policy.Name] = policy
+	}
+
+	return nil
+}
+
+// parseRateLimit parses "<limit>/<period>", e.g. "10/1m"
+func parseRateLimit(value string) (int, time.Duration, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected <limit>/<period>, got %q", value)
+	}
+
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("invalid limit %q", parts[0])
+	}
+
+	period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || period <= 0 {
+		return 0, 0, fmt.Errorf("invalid period %q", parts[1])
+	}
+
+	return limit, period, nil
+}
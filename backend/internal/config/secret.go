@@ -0,0 +1,144 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Secret is a credential that must never show up in logs or config dumps. It prints and
+// marshals as a placeholder, Value returns the real thing.
+type Secret string
+
+const redacted = "[REDACTED]"
+
+// Smallest JWT signing key accepted, HS256 needs at least 256 bits
+const minJWTSecretLength = 32
+
+const minDatabasePasswordLength = 8
+
+// Values that show up in examples and tutorials, never accepted as a secret
+var weakSecrets = []string{
+	"secret", "changeme", "change-me", "password", "admin", "root", "test", "default",
+	"jwt_secret", "jwt-secret", "jwtsecret", "your-secret-key", "your_secret_key", "mysecret",
+}
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String keeps an unset secret empty so dumps still show what is missing
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("config.Secret(%q)", s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// getSecret reads KEY from the file named by KEY_FILE, as mounted by Docker and Kubernetes
+// secrets, or from KEY itself. Setting both is an error so a stale value can't win silently.
+func getSecret(key string) (Secret, error) {
+	file := os.Getenv(key + "_FILE")
+	if file == "" {
+		return Secret(os.Getenv(key)), nil
+	}
+	if os.Getenv(key) != "" {
+		return "", fmt.Errorf("%s and %s_FILE are both set, use only one", key, key)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", key, err)
+	}
+	// Editors and echo leave a trailing newline that isn't part of the secret
+	return Secret(strings.TrimRight(string(data), "\r\n")), nil
+}
+
+// secretLoader collects errors so every bad secret is reported at once
+type secretLoader struct {
+	errs []error
+}
+
+func (l *secretLoader) get(key string) Secret {
+	secret, err := getSecret(key)
+	if err != nil {
+		l.errs = append(l.errs, err)
+	}
+	return secret
+}
+
+func (l *secretLoader) err() error {
+	return errors.Join(l.errs...)
+}
+
+// isWeakSecret catches well known values and keys made of only a couple of characters
+func isWeakSecret(value string) bool {
+	lower := strings.ToLower(value)
+	for _, weak := range weakSecrets {
+		if lower == weak {
+			return true
+		}
+	}
+
+	distinct := make(map[rune]struct{})
+	for _, r := range value {
+		distinct[r] = struct{}{}
+	}
+	return len(distinct) < 4
+}
+
+// validateSecrets reports every missing or weak secret
+func (c *Config) validateSecrets() error {
+	var errs []error
+
+	jwtSecret := c.JSONWebToken.JWTSecretKey.Value()
+	switch {
+	case jwtSecret == "":
+		errs = append(errs, errors.New("JWT_SECRET_KEY is required"))
+	case len(jwtSecret) < minJWTSecretLength:
+		errs = append(errs, fmt.Errorf("JWT_SECRET_KEY must be at least %d bytes, got %d", minJWTSecretLength, len(jwtSecret)))
+	case isWeakSecret(jwtSecret):
+		errs = append(errs, errors.New("JWT_SECRET_KEY is too weak, generate a random one"))
+	}
+
+	// A SQLite file has no password
+	dbPassword := c.Database.Primary.Password.Value()
+	switch {
+	case c.Database.Driver == DatabaseDriverSQLite:
+	case dbPassword == "":
+		errs = append(errs, errors.New("DB_PASSWORD is required"))
+	case len(dbPassword) < minDatabasePasswordLength:
+		errs = append(errs, fmt.Errorf("DB_PASSWORD must be at least %d characters", minDatabasePasswordLength))
+	case isWeakSecret(dbPassword):
+		errs = append(errs, errors.New("DB_PASSWORD is too weak"))
+	}
+
+	if pass := c.RedisCfg.Password.Value(); pass != "" && isWeakSecret(pass) {
+		errs = append(errs, errors.New("REDIS_PASS is too weak"))
+	}
+
+	if key := c.Audit.CheckpointSigningKey.Value(); key != "" {
+		seed, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			errs = append(errs, fmt.Errorf("AUDIT_CHECKPOINT_SIGNING_KEY must be a base64 %d byte ed25519 seed", ed25519.SeedSize))
+		}
+	}
+
+	return errors.Join(errs...)
+}
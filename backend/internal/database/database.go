@@ -4,45 +4,65 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/imnzr/user-authentication-go/internal/config"
+	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 type DB struct {
 	Primary *sql.DB
 	Config  *config.DatabaseConfig
+	Dialect Dialect
+
+	replicas    []*replica
+	nextReplica atomic.Uint64
+	stop        chan struct{}
 }
 
-// New initializes MySQL database connection
+// New initializes the database connection for the configured driver
 func New(cfg *config.DatabaseConfig) (*DB, error) {
+	dialect, err := DialectFor(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+
 	// Connect to primary database
-	primary, err := connectMySQL(cfg.Primary, cfg.MySQL, cfg.Pool)
+	primary, err := connect(dialect, cfg.Primary, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to MySQL database: %w", err)
+		return nil, fmt.Errorf("failed to connect to %s database: %w", dialect.Name(), err)
 	}
 
 	db := &DB{
 		Primary: primary,
 		Config:  cfg,
+		Dialect: dialect,
 	}
 
-	// Configure MySQL session settings
-	if err := db.configureMySQLSession(); err != nil {
-		return nil, fmt.Errorf("failed to configure MySQL session: %w", err)
+	// Configure MySQL session settings, Postgres gets them from the DSN
+	if dialect.Name() == config.DatabaseDriverMySQL {
+		if err := db.configureMySQLSession(); err != nil {
+			return nil, fmt.Errorf("failed to configure MySQL session: %w", err)
+		}
+	}
+
+	// Replicas that are down now are picked up by the health checks once they answer
+	if err := db.openReplicas(); err != nil {
+		primary.Close()
+		return nil, err
 	}
 
 	return db, nil
 }
 
-func connectMySQL(conn config.MySQLConnection, mysqlCfg config.MySQLConfig, pool config.PoolConfig) (*sql.DB, error) {
-	dsn := conn.DSNWithParams(mysqlCfg)
-
-	db, err := sql.Open("mysql", dsn)
+func open(dialect Dialect, conn config.MySQLConnection, cfg *config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open(dialect.DriverName(), dialect.DSN(conn, cfg.MySQL))
 	if err != nil {
-		return nil, fmt.Errorf("failed to open MySQL connection: %w", err)
+		return nil, fmt.Errorf("failed to open %s connection: %w", dialect.Name(), err)
 	}
+	pool := cfg.Pool
 
 	// Configure connection pool
 	db.SetMaxOpenConns(pool.MaxOpenConns)
@@ -50,13 +70,22 @@ func connectMySQL(conn config.MySQLConnection, mysqlCfg config.MySQLConfig, pool
 	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
 	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
 
+	return db, nil
+}
+
+func connect(dialect Dialect, conn config.MySQLConnection, cfg *config.DatabaseConfig) (*sql.DB, error) {
+	db, err := open(dialect, conn, cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := db.PingContext(ctx); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to ping MySQL database: %w", err)
+		return nil, fmt.Errorf("failed to ping %s database: %w", dialect.Name(), err)
 	}
 
 	return db, nil
@@ -85,6 +114,7 @@ func (db *DB) configureMySQLSession() error {
 
 // Close closes database connection
 func (db *DB) Close() error {
+	db.closeReplicas()
 	if db.Primary != nil {
 		return db.Primary.Close()
 	}
@@ -99,7 +129,7 @@ func (db *DB) Health() error {
 	return db.Primary.PingContext(ctx)
 }
 
-// GetVersion returns MySQL version
+// GetVersion returns the server version
 func (db *DB) GetVersion() (string, error) {
 	var version string
 	err := db.Primary.QueryRow("SELECT VERSION()").Scan(&version)
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier is what *sql.DB, *sql.Tx and *sql.Conn have in common
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Dialect hides the SQL differences between the supported databases. Queries are written
+// with ? placeholders and standard SQL, NOW() works on all of them.
+type Dialect interface {
+	// Name is the config.DatabaseDriver* value
+	Name() string
+	DriverName() string
+	DSN(conn config.MySQLConnection, mysqlCfg config.MySQLConfig) string
+	// Rebind rewrites ? placeholders into the driver's form
+	Rebind(query string) string
+	// InsertId runs an INSERT into a table with an id column and returns the new id
+	InsertId(ctx context.Context, q Querier, query string, args ...interface{}) (int64, error)
+	// InsertIgnore turns an INSERT into one that skips rows hitting a unique key
+	InsertIgnore(query string) string
+	// ForUpdate makes a SELECT lock the rows it reads until the transaction ends
+	ForUpdate(query string) string
+	// IsRetryable reports whether err aborted the transaction in a way running it again can fix,
+	// a deadlock or a lock wait that timed out
+	IsRetryable(err error) bool
+	// UniqueViolation reports whether err is a duplicate on a unique key, and which key. The
+	// key is the index or constraint name, SQLite gives the table and columns instead.
+	UniqueViolation(err error) (key string, ok bool)
+	// AdvisoryLock takes a named lock held by conn, waiting up to timeout
+	AdvisoryLock(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) (release func(), err error)
+}
+
+var ErrLockTimeout = errors.New("timed out waiting for lock")
+
+// Bind wraps q so queries written with ? placeholders are rebound for the dialect
+func Bind(dialect Dialect, q Querier) Querier {
+	return &boundQuerier{q: q, dialect: dialect}
+}
+
+type boundQuerier struct {
+	q       Querier
+	dialect Dialect
+}
+
+func (b *boundQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return b.q.ExecContext(ctx, b.dialect.Rebind(query), args...)
+}
+
+func (b *boundQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return b.q.QueryContext(ctx, b.dialect.Rebind(query), args...)
+}
+
+func (b *boundQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return b.q.QueryRowContext(ctx, b.dialect.Rebind(query), args...)
+}
+
+func DialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case config.DatabaseDriverMySQL, "":
+		return mysqlDialect{}, nil
+	case config.DatabaseDriverPostgres:
+		return postgresDialect{}, nil
+	case config.DatabaseDriverSQLite:
+		return sqliteDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string       { return config.DatabaseDriverMySQL }
+func (mysqlDialect) DriverName() string { return "mysql" }
+
+func (mysqlDialect) DSN(conn config.MySQLConnection, mysqlCfg config.MySQLConfig) string {
+	return conn.DSNWithParams(mysqlCfg)
+}
+
+func (mysqlDialect) Rebind(query string) string {
+	return query
+}
+
+func (mysqlDialect) InsertId(ctx context.Context, q Querier, query string, args ...interface{}) (int64, error) {
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (mysqlDialect) InsertIgnore(query string) string {
+	return strings.Replace(query, "INSERT", "INSERT IGNORE", 1)
+}
+
+func (mysqlDialect) ForUpdate(query string) string {
+	return forUpdate(query)
+}
+
+// MySQL error numbers
+const (
+	mysqlLockWaitTimeout = 1205
+	mysqlDeadlock        = 1213
+	mysqlDuplicateEntry  = 1062
+)
+
+// Duplicate entry 'x' for key 'users.idx_users_email_bidx', older servers leave out the table
+var mysqlDuplicateKey = regexp.MustCompile(`for key '(?:[^']*\.)?([^'.]+)'$`)
+
+func (mysqlDialect) IsRetryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	return mysqlErr.Number == mysqlDeadlock || mysqlErr.Number == mysqlLockWaitTimeout
+}
+
+func (mysqlDialect) UniqueViolation(err error) (string, bool) {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != mysqlDuplicateEntry {
+		return "", false
+	}
+	if match := mysqlDuplicateKey.FindStringSubmatch(mysqlErr.Message); match != nil {
+		return match[1], true
+	}
+	return "", true
+}
+
+func (mysqlDialect) AdvisoryLock(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) (func(), error) {
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(timeout.Seconds())).Scan(&acquired); err != nil {
+		return nil, err
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return nil, ErrLockTimeout
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name)
+	}, nil
+}
+
+type postgresDialect struct{}
+
+// How often a Postgres advisory lock is retried, it has no wait with timeout
+const postgresLockPoll = 250 * time.Millisecond
+
+func (postgresDialect) Name() string       { return config.DatabaseDriverPostgres }
+func (postgresDialect) DriverName() string { return "pgx" }
+
+func (postgresDialect) DSN(conn config.MySQLConnection, mysqlCfg config.MySQLConfig) string {
+	return conn.PostgresDSN(mysqlCfg)
+}
+
+// Rebind numbers the placeholders, $1, $2 and so on. Question marks inside quotes are kept.
+func (postgresDialect) Rebind(query string) string {
+	var (
+		rebound strings.Builder
+		n       int
+		quote   byte
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			rebound.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		rebound.WriteByte(c)
+	}
+	return rebound.String()
+}
+
+func (postgresDialect) InsertId(ctx context.Context, q Querier, query string, args ...interface{}) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, strings.TrimRight(strings.TrimSpace(query), ";")+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+func (postgresDialect) InsertIgnore(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), ";") + " ON CONFLICT DO NOTHING"
+}
+
+func (postgresDialect) ForUpdate(query string) string {
+	return forUpdate(query)
+}
+
+// Postgres SQLSTATE codes
+const (
+	postgresSerializationFailure = "40001"
+	postgresDeadlock             = "40P01"
+	postgresLockNotAvailable     = "55P03"
+	postgresUniqueViolation      = "23505"
+)
+
+func (postgresDialect) IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code {
+	case postgresSerializationFailure, postgresDeadlock, postgresLockNotAvailable:
+		return true
+	}
+	return false
+}
+
+func (postgresDialect) UniqueViolation(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != postgresUniqueViolation {
+		return "", false
+	}
+	return pgErr.ConstraintName, true
+}
+
+func (postgresDialect) AdvisoryLock(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&acquired); err != nil {
+			return nil, err
+		}
+		if acquired {
+			return func() {
+				conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", name)
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(postgresLockPoll):
+		}
+	}
+}
+
+func forUpdate(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), ";") + " FOR UPDATE"
+}
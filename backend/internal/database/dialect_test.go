@@ -0,0 +1,176 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// The SQLite side is covered against a real database by the repository tests
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"no placeholders", "SELECT 1", "SELECT 1"},
+		{"numbered in order", "UPDATE users SET name = ? WHERE id = ? AND status = ?", "UPDATE users SET name = $1 WHERE id = $2 AND status = $3"},
+		{"single quotes", "SELECT * FROM users WHERE name = '?' AND id = ?", "SELECT * FROM users WHERE name = '?' AND id = $1"},
+		{"double quotes", `SELECT "what?" FROM users WHERE id = ?`, `SELECT "what?" FROM users WHERE id = $1`},
+		{"quote inside the other quote", `SELECT '"?' FROM users WHERE id = ? AND name = '?"'`, `SELECT '"?' FROM users WHERE id = $1 AND name = '?"'`},
+		{"ten or more", "VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", "VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (postgresDialect{}).Rebind(tt.query); got != tt.want {
+				t.Fatalf("Rebind = %q, want %q", got, tt.want)
+			}
+			// MySQL and SQLite take question marks as they are
+			for _, dialect := range []Dialect{mysqlDialect{}, sqliteDialect{}} {
+				if got := dialect.Rebind(tt.query); got != tt.query {
+					t.Fatalf("%s Rebind = %q, want it unchanged", dialect.Name(), got)
+				}
+			}
+		})
+	}
+}
+
+func TestInsertIgnore(t *testing.T) {
+	const query = "INSERT INTO devices (user_id, fingerprint) VALUES (?, ?);"
+	want := map[Dialect]string{
+		mysqlDialect{}:    "INSERT IGNORE INTO devices (user_id, fingerprint) VALUES (?, ?);",
+		postgresDialect{}: "INSERT INTO devices (user_id, fingerprint) VALUES (?, ?) ON CONFLICT DO NOTHING",
+		sqliteDialect{}:   "INSERT OR IGNORE INTO devices (user_id, fingerprint) VALUES (?, ?);",
+	}
+	for dialect, want := range want {
+		if got := dialect.InsertIgnore(query); got != want {
+			t.Fatalf("%s InsertIgnore = %q, want %q", dialect.Name(), got, want)
+		}
+	}
+}
+
+func TestForUpdate(t *testing.T) {
+	const query = " SELECT id FROM users WHERE id = ?; "
+	want := map[Dialect]string{
+		mysqlDialect{}:    "SELECT id FROM users WHERE id = ? FOR UPDATE",
+		postgresDialect{}: "SELECT id FROM users WHERE id = ? FOR UPDATE",
+		// A SQLite transaction locks the whole database instead
+		sqliteDialect{}: query,
+	}
+	for dialect, want := range want {
+		if got := dialect.ForUpdate(query); got != want {
+			t.Fatalf("%s ForUpdate = %q, want %q", dialect.Name(), got, want)
+		}
+	}
+}
+
+func TestDialectFor(t *testing.T) {
+	for driver, want := range map[string]string{
+		"":         "mysql",
+		"mysql":    "mysql",
+		"postgres": "postgres",
+		"sqlite":   "sqlite",
+	} {
+		dialect, err := DialectFor(driver)
+		if err != nil || dialect.Name() != want {
+			t.Fatalf("DialectFor(%q) = %v, %v, want %s", driver, dialect, err, want)
+		}
+	}
+	if _, err := DialectFor("oracle"); err == nil {
+		t.Fatal("DialectFor accepted an unknown driver")
+	}
+}
+
+func TestUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		err     error
+		key     string
+		ok      bool
+	}{
+		{
+			name:    "mysql 8 qualified key",
+			dialect: mysqlDialect{},
+			err:     &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'abc' for key 'users.idx_users_email_bidx'"},
+			key:     "idx_users_email_bidx",
+			ok:      true,
+		},
+		{
+			name:    "mysql 5.7 bare key",
+			dialect: mysqlDialect{},
+			err:     &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'abc' for key 'idx_users_email_bidx'"},
+			key:     "idx_users_email_bidx",
+			ok:      true,
+		},
+		{
+			name:    "mysql wrapped",
+			dialect: mysqlDialect{},
+			err:     fmt.Errorf("insert: %w", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'abc' for key 'PRIMARY'"}),
+			key:     "PRIMARY",
+			ok:      true,
+		},
+		{
+			name:    "mysql other error",
+			dialect: mysqlDialect{},
+			err:     &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"},
+		},
+		{
+			name:    "postgres",
+			dialect: postgresDialect{},
+			err:     &pgconn.PgError{Code: "23505", ConstraintName: "idx_users_email_bidx"},
+			key:     "idx_users_email_bidx",
+			ok:      true,
+		},
+		{
+			name:    "postgres other error",
+			dialect: postgresDialect{},
+			err:     &pgconn.PgError{Code: "40P01"},
+		},
+		{
+			name:    "not a driver error",
+			dialect: mysqlDialect{},
+			err:     errors.New("Duplicate entry"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := tt.dialect.UniqueViolation(tt.err)
+			if key != tt.key || ok != tt.ok {
+				t.Fatalf("UniqueViolation = %q, %v, want %q, %v", key, ok, tt.key, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		err     error
+		want    bool
+	}{
+		{"mysql deadlock", mysqlDialect{}, &mysql.MySQLError{Number: 1213}, true},
+		{"mysql lock wait timeout", mysqlDialect{}, fmt.Errorf("update: %w", &mysql.MySQLError{Number: 1205}), true},
+		{"mysql duplicate", mysqlDialect{}, &mysql.MySQLError{Number: 1062}, false},
+		{"postgres serialization failure", postgresDialect{}, &pgconn.PgError{Code: "40001"}, true},
+		{"postgres deadlock", postgresDialect{}, &pgconn.PgError{Code: "40P01"}, true},
+		{"postgres lock not available", postgresDialect{}, &pgconn.PgError{Code: "55P03"}, true},
+		{"postgres unique violation", postgresDialect{}, &pgconn.PgError{Code: "23505"}, false},
+		{"sqlite not a driver error", sqliteDialect{}, errors.New("database is locked"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.IsRetryable(tt.err); got != tt.want {
+				t.Fatalf("IsRetryable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+// Package migrate applies the versioned SQL files in the migrations package, or a directory
+// with the same layout, and records them in the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/migrations"
+)
+
+var (
+	ErrDirty          = errors.New("a previous migration failed half way")
+	ErrLocked         = errors.New("another instance is running migrations")
+	ErrUnknownVersion = errors.New("unknown migration version")
+	ErrNoDown         = errors.New("migration has no down file")
+)
+
+// Name of the advisory lock. It belongs to the connection, if the process dies the
+// server releases it.
+const lockName = "schema_migrations"
+
+// Postgres has no DATETIME
+var createTableQueries = map[string]string{
+	config.DatabaseDriverMySQL: `CREATE TABLE IF NOT EXISTS schema_migrations(
+    version BIGINT NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    dirty BOOLEAN NOT NULL DEFAULT FALSE,
+    applied_at DATETIME(6) NOT NULL
+)`,
+	config.DatabaseDriverPostgres: `CREATE TABLE IF NOT EXISTS schema_migrations(
+    version BIGINT NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    dirty BOOLEAN NOT NULL DEFAULT FALSE,
+    applied_at TIMESTAMP(6) NOT NULL
+)`,
+	config.DatabaseDriverSQLite: `CREATE TABLE IF NOT EXISTS schema_migrations(
+    version BIGINT NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    dirty BOOLEAN NOT NULL DEFAULT FALSE,
+    applied_at DATETIME NOT NULL
+)`,
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	hasDown bool
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// Status of one migration, known from the source, the database or both
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Dirty     bool       `json:"dirty,omitempty"`
+	// Recorded in the database but missing from the source, usually after running an older build
+	Missing bool `json:"missing,omitempty"`
+}
+
+// Result lists what a run changed, in the order it happened
+type Result struct {
+	Applied  []string `json:"applied"`
+	Reverted []string `json:"reverted"`
+}
+
+type appliedMigration struct {
+	name      string
+	appliedAt time.Time
+	dirty     bool
+}
+
+type Migrator struct {
+	db          *sql.DB
+	dialect     database.Dialect
+	migrations  []*Migration
+	lockTimeout time.Duration
+}
+
+// Source returns the migrations embedded in the binary for the dialect, or the files in dir
+// when it is set
+func Source(dialect database.Dialect, dir string) (fs.FS, error) {
+	if dir != "" {
+		return os.DirFS(dir), nil
+	}
+	return fs.Sub(migrations.FS, dialect.Name())
+}
+
+func New(db *sql.DB, dialect database.Dialect, source fs.FS, lockTimeout time.Duration) (*Migrator, error) {
+	loaded, err := Load(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:          db,
+		dialect:     dialect,
+		migrations:  loaded,
+		lockTimeout: lockTimeout,
+	}, nil
+}
+
+// Load reads every migration in the root of source, sorted by version
+func Load(source fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			if strings.HasSuffix(entry.Name(), ".sql") {
+				return nil, fmt.Errorf("migration %s: expected <version>_<name>.up.sql or .down.sql", entry.Name())
+			}
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s", version, m.Name, match[2])
+		}
+
+		body, err := fs.ReadFile(source, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+			m.hasDown = true
+		}
+	}
+
+	loaded := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %s has no up file", m)
+		}
+		loaded = append(loaded, m)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Version < loaded[j].Version })
+	return loaded, nil
+}
+
+// Up applies every pending migration, including ones older than the latest applied version
+func (m *Migrator) Up(ctx context.Context) (*Result, error) {
+	result := &Result{}
+	err := m.withLock(ctx, func(conn *sql.Conn, applied map[int64]appliedMigration) error {
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			result.Applied = append(result.Applied, migration.String())
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Down reverts the last steps applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) (*Result, error) {
+	result := &Result{}
+	err := m.withLock(ctx, func(conn *sql.Conn, applied map[int64]appliedMigration) error {
+		for _, version := range appliedVersionsDesc(applied) {
+			if steps <= 0 {
+				break
+			}
+			migration, err := m.revertible(version)
+			if err != nil {
+				return err
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			result.Reverted = append(result.Reverted, migration.String())
+			steps--
+		}
+		return nil
+	})
+	return result, err
+}
+
+// To reverts applied migrations newer than version, then applies pending ones up to it.
+// Version 0 reverts everything.
+func (m *Migrator) To(ctx context.Context, version int64) (*Result, error) {
+	result := &Result{}
+	if version != 0 && m.find(version) == nil {
+		return result, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	err := m.withLock(ctx, func(conn *sql.Conn, applied map[int64]appliedMigration) error {
+		for _, appliedVersion := range appliedVersionsDesc(applied) {
+			if appliedVersion <= version {
+				break
+			}
+			migration, err := m.revertible(appliedVersion)
+			if err != nil {
+				return err
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			result.Reverted = append(result.Reverted, migration.String())
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			result.Applied = append(result.Applied, migration.String())
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Force records the schema as being exactly at version without running anything: every
+// migration up to it applied, everything newer not. It is the way out after a dirty migration
+// was fixed by hand, and how a database created before migrations were tracked is adopted.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return m.lock(ctx, func(conn *sql.Conn) error {
+		if _, err := m.exec(ctx, conn, "DELETE FROM schema_migrations WHERE version > ?", version); err != nil {
+			return fmt.Errorf("failed to force migration %d: %w", version, err)
+		}
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			// Delete and insert, there is no upsert both databases understand
+			if _, err := m.exec(ctx, conn, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+				return fmt.Errorf("failed to force migration %d: %w", version, err)
+			}
+			if _, err := m.exec(ctx, conn,
+				"INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, FALSE, ?)",
+				migration.Version, migration.Name, time.Now().UTC(),
+			); err != nil {
+				return fmt.Errorf("failed to force migration %d: %w", version, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Status lists every migration in version order. It doesn't take the lock.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if _, err := m.db.ExecContext(ctx, createTableQueries[m.dialect.Name()]); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	applied, err := loadApplied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.appliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			status.Dirty = row.dirty
+		}
+		statuses = append(statuses, status)
+	}
+	for version, row := range applied {
+		if m.find(version) != nil {
+			continue
+		}
+		appliedAt := row.appliedAt
+		statuses = append(statuses, Status{
+			Version:   version,
+			Name:      row.name,
+			Applied:   true,
+			AppliedAt: &appliedAt,
+			Dirty:     row.dirty,
+			Missing:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// withLock runs fn holding the lock, with the applied migrations. It refuses to run while
+// a migration is dirty, the schema is in an unknown state until someone looks at it.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, applied map[int64]appliedMigration) error) error {
+	return m.lock(ctx, func(conn *sql.Conn) error {
+		applied, err := loadApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for version, row := range applied {
+			if row.dirty {
+				return fmt.Errorf("%w: version %d, fix the schema by hand and run migrate force", ErrDirty, version)
+			}
+		}
+		return fn(conn, applied)
+	})
+}
+
+func (m *Migrator) lock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	release, err := m.dialect.AdvisoryLock(ctx, conn, lockName, m.lockTimeout)
+	if errors.Is(err, database.ErrLockTimeout) {
+		return ErrLocked
+	}
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer release()
+
+	if _, err := conn.ExecContext(ctx, createTableQueries[m.dialect.Name()]); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+func loadApplied(ctx context.Context, db database.Querier) (map[int64]appliedMigration, error) {
+	rows, err := db.QueryContext(ctx, "SELECT version, name, dirty, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var (
+			version int64
+			row     appliedMigration
+		)
+		if err := rows.Scan(&version, &row.name, &row.dirty, &row.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
+
+func appliedVersionsDesc(applied map[int64]appliedMigration) []int64 {
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	return versions
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) revertible(version int64) (*Migration, error) {
+	migration := m.find(version)
+	if migration == nil {
+		return nil, fmt.Errorf("%w: %d is applied but not in the source", ErrUnknownVersion, version)
+	}
+	if !migration.hasDown {
+		return nil, fmt.Errorf("%w: %s", ErrNoDown, migration)
+	}
+	return migration, nil
+}
+
+// apply marks the migration dirty before running it. MySQL commits DDL implicitly, so if a
+// statement fails the earlier ones stay and the row stays dirty.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration *Migration) error {
+	if _, err := m.exec(ctx, conn,
+		"INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, TRUE, ?)",
+		migration.Version, migration.Name, time.Now().UTC(),
+	); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", migration, err)
+	}
+	if err := execStatements(ctx, conn, migration, "up", migration.Up); err != nil {
+		return err
+	}
+	if _, err := m.exec(ctx, conn,
+		"UPDATE schema_migrations SET dirty = FALSE, applied_at = ? WHERE version = ?",
+		time.Now().UTC(), migration.Version,
+	); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", migration, err)
+	}
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration *Migration) error {
+	if _, err := m.exec(ctx, conn, "UPDATE schema_migrations SET dirty = TRUE WHERE version = ?", migration.Version); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", migration, err)
+	}
+	if err := execStatements(ctx, conn, migration, "down", migration.Down); err != nil {
+		return err
+	}
+	if _, err := m.exec(ctx, conn, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", migration, err)
+	}
+	return nil
+}
+
+func (m *Migrator) exec(ctx context.Context, conn *sql.Conn, query string, args ...interface{}) (sql.Result, error) {
+	return conn.ExecContext(ctx, m.dialect.Rebind(query), args...)
+}
+
+// execStatements runs the statements one by one, the connection doesn't allow multi statements
+func execStatements(ctx context.Context, conn *sql.Conn, migration *Migration, direction string, body string) error {
+	for i, statement := range splitStatements(body) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migration %s.%s statement %d: %w", migration, direction, i+1, err)
+		}
+	}
+	return nil
+}
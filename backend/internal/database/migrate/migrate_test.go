@@ -0,0 +1,297 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/database/migrate"
+	"github.com/imnzr/user-authentication-go/internal/testutil"
+)
+
+// testMigrations creates three tables, the second file holds two statements
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"1_create_users.up.sql":      {Data: []byte("CREATE TABLE users(id INTEGER PRIMARY KEY)")},
+		"1_create_users.down.sql":    {Data: []byte("DROP TABLE users")},
+		"2_create_posts.up.sql":      {Data: []byte("CREATE TABLE posts(id INTEGER PRIMARY KEY);\n-- a second table; in the same file\nCREATE TABLE tags(name TEXT DEFAULT 'a;b')")},
+		"2_create_posts.down.sql":    {Data: []byte("DROP TABLE tags;\nDROP TABLE posts;")},
+		"3_create_comments.up.sql":   {Data: []byte("CREATE TABLE comments(id INTEGER PRIMARY KEY)")},
+		"3_create_comments.down.sql": {Data: []byte("DROP TABLE comments")},
+		"README.md":                  {Data: []byte("not a migration")},
+	}
+}
+
+func newMigrator(t *testing.T, source fstest.MapFS) (*migrate.Migrator, *database.DB) {
+	t.Helper()
+
+	db := testutil.NewEmptyDB(t)
+	migrator, err := migrate.New(db.Primary, db.Dialect, source, time.Second)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return migrator, db
+}
+
+func tables(t *testing.T, db *database.DB) []string {
+	t.Helper()
+
+	rows, err := db.Primary.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name != 'schema_migrations' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func assertTables(t *testing.T, db *database.DB, want ...string) {
+	t.Helper()
+
+	if want == nil {
+		want = []string{}
+	}
+	if got := tables(t, db); !reflect.DeepEqual(got, want) {
+		t.Fatalf("tables = %v, want %v", got, want)
+	}
+}
+
+func assertResult(t *testing.T, result *migrate.Result, err error, applied []string, reverted []string) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Applied, applied) || !reflect.DeepEqual(result.Reverted, reverted) {
+		t.Fatalf("applied %v and reverted %v, want %v and %v", result.Applied, result.Reverted, applied, reverted)
+	}
+}
+
+func TestMigratorUpAndDown(t *testing.T) {
+	migrator, db := newMigrator(t, testMigrations())
+	ctx := context.Background()
+
+	result, err := migrator.Up(ctx)
+	assertResult(t, result, err, []string{"1_create_users", "2_create_posts", "3_create_comments"}, nil)
+	assertTables(t, db, "comments", "posts", "tags", "users")
+
+	// Nothing left to do
+	result, err = migrator.Up(ctx)
+	assertResult(t, result, err, nil, nil)
+
+	result, err = migrator.Down(ctx, 2)
+	assertResult(t, result, err, nil, []string{"3_create_comments", "2_create_posts"})
+	assertTables(t, db, "users")
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	applied := []bool{}
+	for _, status := range statuses {
+		applied = append(applied, status.Applied)
+	}
+	if !reflect.DeepEqual(applied, []bool{true, false, false}) {
+		t.Fatalf("applied = %v, want only the first", applied)
+	}
+}
+
+func TestMigratorTo(t *testing.T) {
+	migrator, db := newMigrator(t, testMigrations())
+	ctx := context.Background()
+
+	result, err := migrator.To(ctx, 2)
+	assertResult(t, result, err, []string{"1_create_users", "2_create_posts"}, nil)
+	assertTables(t, db, "posts", "tags", "users")
+
+	result, err = migrator.To(ctx, 1)
+	assertResult(t, result, err, nil, []string{"2_create_posts"})
+
+	result, err = migrator.To(ctx, 0)
+	assertResult(t, result, err, nil, []string{"1_create_users"})
+	assertTables(t, db)
+
+	if _, err := migrator.To(ctx, 4); !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Fatalf("To an unknown version = %v, want %v", err, migrate.ErrUnknownVersion)
+	}
+}
+
+func TestMigratorAppliesOlderPendingMigrations(t *testing.T) {
+	source := testMigrations()
+	delete(source, "2_create_posts.up.sql")
+	delete(source, "2_create_posts.down.sql")
+	migrator, db := newMigrator(t, source)
+	ctx := context.Background()
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A migration merged from another branch with a lower version than what is applied
+	source["2_create_posts.up.sql"] = testMigrations()["2_create_posts.up.sql"]
+	migrator, err := migrate.New(db.Primary, db.Dialect, source, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := migrator.Up(ctx)
+	assertResult(t, result, err, []string{"2_create_posts"}, nil)
+	assertTables(t, db, "comments", "posts", "tags", "users")
+
+	// Without a down file it can't be reverted
+	if _, err := migrator.Down(ctx, 2); !errors.Is(err, migrate.ErrNoDown) {
+		t.Fatalf("Down past a migration without down file = %v, want %v", err, migrate.ErrNoDown)
+	}
+}
+
+func TestMigratorStopsAtADirtyMigration(t *testing.T) {
+	source := testMigrations()
+	source["3_create_comments.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE comments(id INTEGER PRIMARY KEY);\nCREATE TABLE broken(")}
+	migrator, db := newMigrator(t, source)
+	ctx := context.Background()
+
+	if _, err := migrator.Up(ctx); err == nil {
+		t.Fatal("Up succeeded with a broken migration")
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := statuses[2]; !last.Applied || !last.Dirty {
+		t.Fatalf("status of the broken migration = %+v, want dirty", last)
+	}
+
+	// Nothing runs on a schema in an unknown state
+	for name, run := range map[string]func() error{
+		"Up":   func() error { _, err := migrator.Up(ctx); return err },
+		"Down": func() error { _, err := migrator.Down(ctx, 1); return err },
+		"To":   func() error { _, err := migrator.To(ctx, 1); return err },
+	} {
+		if err := run(); !errors.Is(err, migrate.ErrDirty) {
+			t.Fatalf("%s on a dirty schema = %v, want %v", name, err, migrate.ErrDirty)
+		}
+	}
+
+	// Fixed by hand, then recorded as applied
+	if _, err := db.Primary.Exec("DROP TABLE comments"); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Force(ctx, 2); err != nil {
+		t.Fatalf("Force: %v", err)
+	}
+	statuses, err = migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 3 || !statuses[1].Applied || statuses[1].Dirty || statuses[2].Applied {
+		t.Fatalf("statuses after Force = %+v", statuses)
+	}
+	if _, err := migrator.Down(ctx, 1); err != nil {
+		t.Fatalf("Down after Force: %v", err)
+	}
+	assertTables(t, db, "users")
+}
+
+func TestMigratorForceAdoptsAnExistingSchema(t *testing.T) {
+	migrator, db := newMigrator(t, testMigrations())
+	ctx := context.Background()
+	if _, err := db.Primary.Exec("CREATE TABLE users(id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrator.Force(ctx, 1); err != nil {
+		t.Fatalf("Force: %v", err)
+	}
+	result, err := migrator.Up(ctx)
+	assertResult(t, result, err, []string{"2_create_posts", "3_create_comments"}, nil)
+
+	if err := migrator.Force(ctx, 9); !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Fatalf("Force of an unknown version = %v, want %v", err, migrate.ErrUnknownVersion)
+	}
+}
+
+func TestMigratorReportsMigrationsMissingFromTheSource(t *testing.T) {
+	source := testMigrations()
+	migrator, db := newMigrator(t, source)
+	ctx := context.Background()
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// An older build that doesn't know migration 3
+	delete(source, "3_create_comments.up.sql")
+	delete(source, "3_create_comments.down.sql")
+	older, err := migrate.New(db.Primary, db.Dialect, source, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := older.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 3 || !statuses[2].Missing || statuses[2].Name != "create_comments" {
+		t.Fatalf("statuses = %+v, want 3 reported missing", statuses)
+	}
+	if _, err := older.Down(ctx, 1); !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Fatalf("Down of a migration missing from the source = %v, want %v", err, migrate.ErrUnknownVersion)
+	}
+}
+
+func TestLoadRejectsBadSources(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"bad name": {"1-create.up.sql": {Data: []byte("SELECT 1")}},
+		"no up":    {"1_create.down.sql": {Data: []byte("SELECT 1")}},
+		"same version": {
+			"1_create_users.up.sql": {Data: []byte("SELECT 1")},
+			"1_create_posts.up.sql": {Data: []byte("SELECT 1")},
+		},
+	}
+	for name, source := range cases {
+		if _, err := migrate.Load(source); err == nil {
+			t.Fatalf("Load accepted a source with %s", name)
+		}
+	}
+
+	loaded, err := migrate.Load(testMigrations())
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded) != 3 || loaded[0].Version != 1 || loaded[2].Version != 3 {
+		t.Fatalf("loaded %v, want the three migrations in order", loaded)
+	}
+}
+
+func TestEmbeddedMigrationsRevertCleanly(t *testing.T) {
+	db := testutil.NewEmptyDB(t)
+	source, err := migrate.Source(db.Dialect, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := migrate.New(db.Primary, db.Dialect, source, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if _, err := migrator.To(ctx, 0); err != nil {
+		t.Fatalf("To(0): %v", err)
+	}
+	assertTables(t, db)
+	// And back up, a down file that forgot something would make this fail
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up after reverting everything: %v", err)
+	}
+}
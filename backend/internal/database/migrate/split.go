@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A SQLite trigger body is a list of statements between BEGIN and END
+var (
+	triggerStart = regexp.MustCompile(`(?is)^CREATE\s+(TEMP\s+|TEMPORARY\s+)?TRIGGER\b.*\bBEGIN\b`)
+	triggerEnd   = regexp.MustCompile(`(?i)\bEND\s*$`)
+)
+
+// splitStatements splits a migration on semicolons outside of quotes, dollar quotes, comments
+// and SQLite trigger bodies. Line comments are dropped, MySQL rejects a statement that is only
+// a comment.
+func splitStatements(body string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+	)
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := closingQuote(body, i)
+			current.WriteString(body[i:end])
+			i = end - 1
+
+		case c == '$' && dollarTag(body, i) != "":
+			// Postgres dollar quoted body, $$ ... $$ or $tag$ ... $tag$
+			tag := dollarTag(body, i)
+			end := strings.Index(body[i+len(tag):], tag)
+			if end < 0 {
+				current.WriteString(body[i:])
+				i = len(body)
+				break
+			}
+			current.WriteString(body[i : i+len(tag)+end+len(tag)])
+			i += len(tag) + end + len(tag) - 1
+
+		case c == '#' || isDashComment(body, i):
+			for i < len(body) && body[i] != '\n' {
+				i++
+			}
+			current.WriteByte('\n')
+
+		case c == '/' && i+1 < len(body) && body[i+1] == '*':
+			end := strings.Index(body[i+2:], "*/")
+			if end < 0 {
+				current.WriteString(body[i:])
+				i = len(body)
+				break
+			}
+			current.WriteString(body[i : i+2+end+2])
+			i += 2 + end + 1
+
+		case c == ';':
+			if statement := strings.TrimSpace(current.String()); triggerStart.MatchString(statement) && !triggerEnd.MatchString(statement) {
+				current.WriteByte(c)
+				break
+			}
+			flush()
+
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return statements
+}
+
+// dollarTag returns the $tag$ starting at i, or "" when there is none
+func dollarTag(body string, i int) string {
+	for j := i + 1; j < len(body); j++ {
+		c := body[j]
+		switch {
+		case c == '$':
+			return body[i : j+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || j > i+1 && c >= '0' && c <= '9':
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// MySQL only treats -- as a comment when whitespace follows it
+func isDashComment(body string, i int) bool {
+	if !strings.HasPrefix(body[i:], "--") {
+		return false
+	}
+	return i+2 == len(body) || strings.ContainsRune(" \t\r\n", rune(body[i+2]))
+}
+
+// closingQuote returns the index just past the quote that closes the one at start,
+// skipping backslash escapes and doubled quotes
+func closingQuote(body string, start int) int {
+	quote := body[start]
+	for i := start + 1; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(body) && body[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(body)
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+type replica struct {
+	db      *sql.DB
+	addr    string
+	healthy atomic.Bool
+}
+
+// ReplicaHealth is the last health check result of one replica
+type ReplicaHealth struct {
+	Addr    string `json:"addr"`
+	Healthy bool   `json:"healthy"`
+}
+
+// WriteTracker remembers that a request wrote to the primary. Reads made after that skip
+// the replicas, which may not have the write yet.
+type WriteTracker struct {
+	wrote atomic.Bool
+}
+
+type writeTrackerKey struct{}
+
+// WriteTrackerKey is the context key the request middleware stores a WriteTracker under
+var WriteTrackerKey = writeTrackerKey{}
+
+func NewWriteTracker() *WriteTracker {
+	return &WriteTracker{}
+}
+
+// WithWriteTracker gives work outside of a request the same read-your-writes guarantee
+func WithWriteTracker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, WriteTrackerKey, NewWriteTracker())
+}
+
+// WithPrimaryReads sends every read in ctx to the primary, for reads that must not be even
+// slightly stale. Inside a request the rest of the request reads from the primary too.
+func WithPrimaryReads(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(WriteTrackerKey).(*WriteTracker); !ok {
+		ctx = WithWriteTracker(ctx)
+	}
+	markWrite(ctx)
+	return ctx
+}
+
+func markWrite(ctx context.Context) {
+	if tracker, ok := ctx.Value(WriteTrackerKey).(*WriteTracker); ok {
+		tracker.wrote.Store(true)
+	}
+}
+
+func hasWritten(ctx context.Context) bool {
+	tracker, ok := ctx.Value(WriteTrackerKey).(*WriteTracker)
+	return ok && tracker.wrote.Load()
+}
+
+// Writer returns the primary and records the write, so the rest of the request reads from it too
+func (db *DB) Writer(ctx context.Context) *sql.DB {
+	markWrite(ctx)
+	return db.Primary
+}
+
+// Reader returns the next healthy replica, round robin. Inside a transaction, after a write
+// in the same request, or when no replica is healthy it returns the primary.
+func (db *DB) Reader(ctx context.Context) *sql.DB {
+	if len(db.replicas) == 0 || hasWritten(ctx) {
+		return db.Primary
+	}
+	if _, ok := TxFromContext(ctx); ok {
+		return db.Primary
+	}
+
+	start := db.nextReplica.Add(1)
+	for i := range db.replicas {
+		r := db.replicas[(start+uint64(i))%uint64(len(db.replicas))]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return db.Primary
+}
+
+// ReplicaHealth reports every replica in configuration order
+func (db *DB) ReplicaHealth() []ReplicaHealth {
+	health := make([]ReplicaHealth, 0, len(db.replicas))
+	for _, r := range db.replicas {
+		health = append(health, ReplicaHealth{Addr: r.addr, Healthy: r.healthy.Load()})
+	}
+	return health
+}
+
+func (db *DB) openReplicas() error {
+	for _, conn := range db.Config.Replicas {
+		replicaDB, err := open(db.Dialect, conn, db.Config)
+		if err != nil {
+			db.closeReplicas()
+			return fmt.Errorf("failed to open replica %s:%d: %w", conn.Host, conn.Port, err)
+		}
+		db.replicas = append(db.replicas, &replica{
+			db:   replicaDB,
+			addr: fmt.Sprintf("%s:%d", conn.Host, conn.Port),
+		})
+	}
+	if len(db.replicas) == 0 {
+		return nil
+	}
+
+	db.checkReplicas()
+	db.stop = make(chan struct{})
+	go db.runHealthChecks(db.Config.Replica.HealthCheckInterval, db.stop)
+	return nil
+}
+
+// runHealthChecks takes stop as an argument, Close clears the field while it runs
+func (db *DB) runHealthChecks(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			db.checkReplicas()
+		}
+	}
+}
+
+func (db *DB) checkReplicas() {
+	for _, r := range db.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), db.Config.Replica.HealthCheckTimeout)
+		r.healthy.Store(r.db.PingContext(ctx) == nil)
+		cancel()
+	}
+}
+
+func (db *DB) closeReplicas() {
+	if db.stop != nil {
+		close(db.stop)
+		db.stop = nil
+	}
+	for _, r := range db.replicas {
+		r.db.Close()
+	}
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+)
+
+// newReplicatedDB opens an in-memory primary and n in-memory replicas. Each is a separate
+// database that knows its own name, so a test can tell where a query went.
+func newReplicatedDB(t *testing.T, n int) *DB {
+	t.Helper()
+
+	cfg := &config.DatabaseConfig{
+		Driver:  config.DatabaseDriverSQLite,
+		Primary: config.MySQLConnection{Database: ":memory:"},
+		MySQL:   config.MySQLConfig{Timeout: time.Second},
+		Pool:    config.PoolConfig{MaxOpenConns: 4, MaxIdleConns: 4},
+		Replica: config.ReplicaConfig{HealthCheckInterval: time.Hour, HealthCheckTimeout: time.Second},
+	}
+	for i := 1; i <= n; i++ {
+		cfg.Replicas = append(cfg.Replicas, config.MySQLConnection{Host: fmt.Sprintf("replica-%d", i), Port: 3306, Database: ":memory:"})
+	}
+	db, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	name(t, db.Primary, "primary")
+	for i, r := range db.replicas {
+		name(t, r.db, fmt.Sprintf("replica-%d", i+1))
+	}
+	return db
+}
+
+func name(t *testing.T, db *sql.DB, name string) {
+	t.Helper()
+
+	if _, err := db.Exec("CREATE TABLE whoami(name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO whoami(name) VALUES (?)", name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func whoami(t *testing.T, db *sql.DB) string {
+	t.Helper()
+
+	var name string
+	if err := db.QueryRow("SELECT name FROM whoami").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestReaderRoundRobinsOverReplicas(t *testing.T) {
+	db := newReplicatedDB(t, 2)
+	ctx := context.Background()
+
+	seen := map[string]int{}
+	for i := 0; i < 6; i++ {
+		seen[whoami(t, db.Reader(ctx))]++
+	}
+	if seen["replica-1"] != 3 || seen["replica-2"] != 3 {
+		t.Fatalf("reads went to %v, want 3 on each replica", seen)
+	}
+	if whoami(t, db.Writer(ctx)) != "primary" {
+		t.Fatal("Writer isn't the primary")
+	}
+}
+
+func TestReaderReadsYourWrites(t *testing.T) {
+	db := newReplicatedDB(t, 1)
+
+	// Without a tracker nothing is remembered, like work outside of a request
+	db.Writer(context.Background())
+	if got := whoami(t, db.Reader(context.Background())); got != "replica-1" {
+		t.Fatalf("read without a tracker went to %s", got)
+	}
+
+	request := WithWriteTracker(context.Background())
+	if got := whoami(t, db.Reader(request)); got != "replica-1" {
+		t.Fatalf("read before any write went to %s", got)
+	}
+	db.Writer(request)
+	for i := 0; i < 3; i++ {
+		if got := whoami(t, db.Reader(request)); got != "primary" {
+			t.Fatalf("read after a write went to %s", got)
+		}
+	}
+
+	// Other requests keep using the replica
+	if got := whoami(t, db.Reader(WithWriteTracker(context.Background()))); got != "replica-1" {
+		t.Fatalf("another request's read went to %s", got)
+	}
+}
+
+func TestWithPrimaryReads(t *testing.T) {
+	db := newReplicatedDB(t, 1)
+
+	if got := whoami(t, db.Reader(WithPrimaryReads(context.Background()))); got != "primary" {
+		t.Fatalf("read went to %s", got)
+	}
+
+	// Inside a request the request's own tracker is marked
+	request := WithWriteTracker(context.Background())
+	WithPrimaryReads(request)
+	if got := whoami(t, db.Reader(request)); got != "primary" {
+		t.Fatalf("later read in the request went to %s", got)
+	}
+}
+
+func TestReaderInsideATransaction(t *testing.T) {
+	db := newReplicatedDB(t, 1)
+	db.Config.Transaction = config.TransactionConfig{MaxRetries: 0}
+
+	err := NewTxManager(db).WithTransaction(context.Background(), func(ctx context.Context) error {
+		if got := whoami(t, db.Reader(ctx)); got != "primary" {
+			t.Errorf("read inside a transaction went to %s", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReaderSkipsUnhealthyReplicas(t *testing.T) {
+	db := newReplicatedDB(t, 2)
+	ctx := context.Background()
+
+	db.replicas[0].db.Close()
+	db.checkReplicas()
+	for i := 0; i < 4; i++ {
+		if got := whoami(t, db.Reader(ctx)); got != "replica-2" {
+			t.Fatalf("read went to %s, want the healthy replica", got)
+		}
+	}
+	want := []ReplicaHealth{{Addr: "replica-1:3306", Healthy: false}, {Addr: "replica-2:3306", Healthy: true}}
+	if got := db.ReplicaHealth(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("ReplicaHealth = %v, want %v", got, want)
+	}
+
+	// With no replica left reads fall back to the primary
+	db.replicas[1].db.Close()
+	db.checkReplicas()
+	if got := whoami(t, db.Reader(ctx)); got != "primary" {
+		t.Fatalf("read went to %s, want the primary", got)
+	}
+}
+
+func TestReaderWithoutReplicas(t *testing.T) {
+	db := newReplicatedDB(t, 0)
+	if got := whoami(t, db.Reader(context.Background())); got != "primary" {
+		t.Fatalf("read went to %s", got)
+	}
+	if health := db.ReplicaHealth(); len(health) != 0 {
+		t.Fatalf("ReplicaHealth = %v", health)
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLite stores times as text in this layout, the one the driver writes with _time_format=sqlite.
+// Text in one layout and one zone compares in time order.
+const sqliteTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+// SQLite has no NOW(), queries shared with MySQL and Postgres use it
+func init() {
+	sqlite.MustRegisterScalarFunction("NOW", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return time.Now().UTC().Format(sqliteTimeLayout), nil
+	})
+}
+
+// sqliteDialect runs on an embedded database file, for development and tests. It is pure Go,
+// the binary still builds with CGO_ENABLED=0.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string       { return config.DatabaseDriverSQLite }
+func (sqliteDialect) DriverName() string { return "sqlite" }
+
+// DSN uses DB_NAME as the file path. ":memory:" becomes an in-memory database that every
+// connection of the pool shares, a plain :memory: would give each connection its own.
+func (sqliteDialect) DSN(conn config.MySQLConnection, mysqlCfg config.MySQLConfig) string {
+	path := conn.Database
+	params := url.Values{}
+	if path == ":memory:" {
+		path = "/" + randomName()
+		params.Set("vfs", "memdb")
+	}
+	params.Add("_pragma", "foreign_keys(1)")
+	// A locked database is retried for DB_TIMEOUT before the query fails
+	params.Add("_pragma", "busy_timeout("+strconv.FormatInt(mysqlCfg.Timeout.Milliseconds(), 10)+")")
+	params.Set("_time_format", "sqlite")
+	return "file:" + path + "?" + params.Encode()
+}
+
+func randomName() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (sqliteDialect) Rebind(query string) string {
+	return query
+}
+
+func (sqliteDialect) InsertId(ctx context.Context, q Querier, query string, args ...interface{}) (int64, error) {
+	return mysqlDialect{}.InsertId(ctx, q, query, args...)
+}
+
+func (sqliteDialect) InsertIgnore(query string) string {
+	return strings.Replace(query, "INSERT", "INSERT OR IGNORE", 1)
+}
+
+// ForUpdate leaves the query alone, SQLite has no row locks. A transaction takes the
+// database's write lock at its first write and keeps it until it ends.
+func (sqliteDialect) ForUpdate(query string) string {
+	return query
+}
+
+// IsRetryable catches a database that stayed locked for the whole busy timeout
+func (sqliteDialect) IsRetryable(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	// Extended codes keep the primary code in the low byte
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return true
+	}
+	return false
+}
+
+// UniqueViolation returns the columns, "UNIQUE constraint failed: users.email_bidx"
+func (sqliteDialect) UniqueViolation(err error) (string, bool) {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return "", false
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+	default:
+		return "", false
+	}
+	_, key, _ := strings.Cut(sqliteErr.Error(), "UNIQUE constraint failed: ")
+	return strings.TrimSuffix(key, " ("+strconv.Itoa(sqliteErr.Code())+")"), true
+}
+
+// AdvisoryLock is a no-op, a SQLite file is only used by one process
+func (sqliteDialect) AdvisoryLock(context.Context, *sql.Conn, string, time.Duration) (func(), error) {
+	return func() {}, nil
+}
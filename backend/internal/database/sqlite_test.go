@@ -0,0 +1,86 @@
+package database_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/testutil"
+)
+
+func TestSQLiteMemoryDatabaseIsSharedByThePool(t *testing.T) {
+	db := testutil.NewDB(t)
+	other := testutil.NewDB(t)
+
+	if _, err := db.Primary.Exec("CREATE TABLE items(name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every connection of the pool sees the table, not just the one that created it
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.Primary.Exec("INSERT INTO items(name) VALUES ('a')")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("insert on another connection: %v", err)
+		}
+	}
+
+	// Another in-memory database is a separate database
+	if _, err := other.Primary.Exec("SELECT name FROM items"); err == nil {
+		t.Fatal("a second in-memory database sees the first one's table")
+	}
+}
+
+func TestSQLiteNow(t *testing.T) {
+	db := testutil.NewDB(t)
+	if _, err := db.Primary.Exec("CREATE TABLE stamps(id INTEGER PRIMARY KEY, at DATETIME)"); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().Add(-time.Second)
+	if _, err := db.Primary.Exec("INSERT INTO stamps(id, at) VALUES (1, NOW())"); err != nil {
+		t.Fatalf("NOW(): %v", err)
+	}
+	// Times bound as parameters compare with the ones NOW() wrote
+	if _, err := db.Primary.Exec("INSERT INTO stamps(id, at) VALUES (2, ?)", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var at time.Time
+	if err := db.Primary.QueryRow("SELECT at FROM stamps WHERE id = 1").Scan(&at); err != nil {
+		t.Fatalf("scan NOW(): %v", err)
+	}
+	if at.Before(before) || at.After(time.Now().Add(time.Second)) {
+		t.Fatalf("NOW() = %v, want about %v", at, time.Now())
+	}
+
+	var count int
+	if err := db.Primary.QueryRow("SELECT COUNT(*) FROM stamps WHERE at > ?", time.Now().Add(time.Minute)).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("%d rows later than a minute from now, want 1", count)
+	}
+}
+
+func TestSQLiteEnforcesForeignKeys(t *testing.T) {
+	db := testutil.NewDB(t)
+
+	_, err := db.Primary.ExecContext(context.Background(),
+		"INSERT INTO webhook_deliveries(subscription_id, event_id, event_type, payload, status, created_at, updated_at) VALUES (?, 'e', 'user.signed_up', '{}', 'pending', NOW(), NOW())", 999)
+	if err == nil || !strings.Contains(err.Error(), "FOREIGN KEY") {
+		t.Fatalf("insert of a delivery for a missing subscription = %v, want a foreign key error", err)
+	}
+}
@@ -4,30 +4,96 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math/rand/v2"
+	"time"
 )
 
 type TxManager interface {
+	// WithTransaction runs fn in a read committed transaction, see WithTransactionOptions
 	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	// WithTransactionOptions runs fn in a transaction that repositories find in the context
+	// fn gets. It commits when fn returns nil and rolls back otherwise.
+	//
+	// Called inside another transaction it runs fn in a savepoint of that one instead, an
+	// error rolls back only what fn did and opts are ignored. The outermost call retries fn
+	// from the start when the transaction hits a deadlock or lock wait timeout, so fn must
+	// be safe to run more than once.
+	WithTransactionOptions(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error
+}
+
+type TxOptions struct {
+	// sql.LevelDefault is the database's default, not read committed
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
 }
 
 type txManager struct {
-	db *sql.DB
+	db *DB
 }
 
-func NewTxManager(db *sql.DB) TxManager {
+// Transactions always run on the primary
+func NewTxManager(db *DB) TxManager {
 	return &txManager{db: db}
 }
 
+type txContextKey struct{}
+
+// txState is what the context carries for an open transaction
+type txState struct {
+	tx *sql.Tx
+	// Savepoints opened so far, names them uniquely within the transaction
+	savepoints int
+}
+
+// TxFromContext returns the transaction WithTransaction stored in the context
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	state, ok := ctx.Value(txContextKey{}).(*txState)
+	if !ok {
+		return nil, false
+	}
+	return state.tx, true
+}
+
 func (tm *txManager) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
-	tx, err := tm.db.BeginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelReadCommitted,
+	return tm.WithTransactionOptions(ctx, TxOptions{Isolation: sql.LevelReadCommitted}, fn)
+}
+
+func (tm *txManager) WithTransactionOptions(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	if state, ok := ctx.Value(txContextKey{}).(*txState); ok {
+		return tm.withSavepoint(ctx, state, fn)
+	}
+
+	retry := tm.db.Config.Transaction
+	backoff := retry.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := tm.run(ctx, opts, fn)
+		if err == nil || attempt >= retry.MaxRetries || !tm.db.Dialect.IsRetryable(err) {
+			return err
+		}
+
+		// Jitter keeps the transactions that deadlocked from meeting again
+		wait := backoff + rand.N(backoff+1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// run is one attempt at the outermost transaction
+func (tm *txManager) run(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	tx, err := tm.db.Writer(ctx).BeginTx(ctx, &sql.TxOptions{
+		Isolation: opts.Isolation,
+		ReadOnly:  opts.ReadOnly,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
 	// Add transaction to context
-	txCtx := context.WithValue(ctx, "db_tx", tx)
+	txCtx := context.WithValue(ctx, txContextKey{}, &txState{tx: tx})
 
 	defer func() {
 		if p := recover(); p != nil {
@@ -38,7 +104,7 @@ func (tm *txManager) WithTransaction(ctx context.Context, fn func(ctx context.Co
 
 	if err := fn(txCtx); err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
-			return fmt.Errorf("transaction failed: %v, rollback failed: %w", err, rollbackErr)
+			return fmt.Errorf("transaction failed: %w, rollback failed: %v", err, rollbackErr)
 		}
 		return err
 	}
@@ -49,3 +115,39 @@ func (tm *txManager) WithTransaction(ctx context.Context, fn func(ctx context.Co
 
 	return nil
 }
+
+// withSavepoint runs a nested WithTransaction. The same SQL works on MySQL, Postgres and SQLite.
+func (tm *txManager) withSavepoint(ctx context.Context, state *txState, fn func(ctx context.Context) error) error {
+	state.savepoints++
+	name := fmt.Sprintf("sp_%d", state.savepoints)
+	if _, err := state.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+
+	rollback := func() error {
+		if _, err := state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); err != nil {
+			return err
+		}
+		_, err := state.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx); err != nil {
+		if rollbackErr := rollback(); rollbackErr != nil {
+			return fmt.Errorf("savepoint failed: %w, rollback failed: %v", err, rollbackErr)
+		}
+		return err
+	}
+
+	if _, err := state.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return nil
+}
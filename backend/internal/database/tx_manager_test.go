@@ -0,0 +1,251 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/testutil"
+)
+
+var errDeadlock = errors.New("deadlock")
+
+// retryDialect reports errDeadlock as retryable, SQLite can't be made to deadlock on demand
+type retryDialect struct {
+	database.Dialect
+}
+
+func (retryDialect) IsRetryable(err error) bool {
+	return errors.Is(err, errDeadlock)
+}
+
+func newItemsDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	db := testutil.NewDB(t)
+	if _, err := db.Primary.Exec("CREATE TABLE items(name TEXT NOT NULL)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	return db
+}
+
+func insertItem(t *testing.T, ctx context.Context, name string) {
+	t.Helper()
+
+	tx, ok := database.TxFromContext(ctx)
+	if !ok {
+		t.Fatal("no transaction in context")
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO items(name) VALUES (?)", name); err != nil {
+		t.Fatalf("failed to insert %s: %v", name, err)
+	}
+}
+
+func itemNames(t *testing.T, db *database.DB) []string {
+	t.Helper()
+
+	rows, err := db.Primary.Query("SELECT name FROM items ORDER BY rowid")
+	if err != nil {
+		t.Fatalf("failed to list items: %v", err)
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("failed to scan item: %v", err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func assertItems(t *testing.T, db *database.DB, want ...string) {
+	t.Helper()
+
+	got := itemNames(t, db)
+	if len(got) != len(want) {
+		t.Fatalf("items = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("items = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestWithTransactionCommitsAndRollsBack(t *testing.T) {
+	db := newItemsDB(t)
+	tm := database.NewTxManager(db)
+	ctx := context.Background()
+
+	if err := tm.WithTransaction(ctx, func(ctx context.Context) error {
+		insertItem(t, ctx, "committed")
+		return nil
+	}); err != nil {
+		t.Fatalf("WithTransaction: %v", err)
+	}
+
+	errFailed := errors.New("failed")
+	err := tm.WithTransaction(ctx, func(ctx context.Context) error {
+		insertItem(t, ctx, "rolled back")
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("WithTransaction = %v, want %v", err, errFailed)
+	}
+
+	assertItems(t, db, "committed")
+}
+
+func TestNestedTransactionRollsBackOnlyItsSavepoint(t *testing.T) {
+	db := newItemsDB(t)
+	tm := database.NewTxManager(db)
+	errInner := errors.New("inner failed")
+
+	err := tm.WithTransaction(context.Background(), func(ctx context.Context) error {
+		outer, _ := database.TxFromContext(ctx)
+		insertItem(t, ctx, "outer")
+
+		err := tm.WithTransaction(ctx, func(ctx context.Context) error {
+			if inner, _ := database.TxFromContext(ctx); inner != outer {
+				t.Error("nested call opened a new transaction")
+			}
+			insertItem(t, ctx, "inner")
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Errorf("nested WithTransaction = %v, want %v", err, errInner)
+		}
+
+		// A second savepoint after the first was rolled back
+		if err := tm.WithTransaction(ctx, func(ctx context.Context) error {
+			insertItem(t, ctx, "second")
+			// Two levels deep
+			return tm.WithTransaction(ctx, func(ctx context.Context) error {
+				insertItem(t, ctx, "deepest")
+				return nil
+			})
+		}); err != nil {
+			t.Errorf("nested WithTransaction: %v", err)
+		}
+
+		insertItem(t, ctx, "after")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction: %v", err)
+	}
+
+	assertItems(t, db, "outer", "second", "deepest", "after")
+}
+
+func TestOuterRollbackUndoesReleasedSavepoints(t *testing.T) {
+	db := newItemsDB(t)
+	tm := database.NewTxManager(db)
+	errOuter := errors.New("outer failed")
+
+	err := tm.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if err := tm.WithTransaction(ctx, func(ctx context.Context) error {
+			insertItem(t, ctx, "inner")
+			return nil
+		}); err != nil {
+			t.Errorf("nested WithTransaction: %v", err)
+		}
+		return errOuter
+	})
+	if !errors.Is(err, errOuter) {
+		t.Fatalf("WithTransaction = %v, want %v", err, errOuter)
+	}
+
+	assertItems(t, db)
+}
+
+func TestWithTransactionRetriesRetryableErrors(t *testing.T) {
+	db := newItemsDB(t)
+	db.Dialect = retryDialect{db.Dialect}
+	tm := database.NewTxManager(db)
+
+	attempts := 0
+	err := tm.WithTransaction(context.Background(), func(ctx context.Context) error {
+		attempts++
+		insertItem(t, ctx, "attempt")
+		if attempts < 3 {
+			return errDeadlock
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction: %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", attempts)
+	}
+
+	// The failed attempts were rolled back
+	assertItems(t, db, "attempt")
+}
+
+func TestWithTransactionGivesUpAfterMaxRetries(t *testing.T) {
+	db := newItemsDB(t)
+	db.Dialect = retryDialect{db.Dialect}
+	tm := database.NewTxManager(db)
+
+	attempts := 0
+	err := tm.WithTransaction(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return errDeadlock
+	})
+	if !errors.Is(err, errDeadlock) {
+		t.Fatalf("WithTransaction = %v, want %v", err, errDeadlock)
+	}
+	if want := db.Config.Transaction.MaxRetries + 1; attempts != want {
+		t.Fatalf("attempts = %d, want %d", attempts, want)
+	}
+}
+
+func TestWithTransactionDoesNotRetryOtherErrors(t *testing.T) {
+	db := newItemsDB(t)
+	db.Dialect = retryDialect{db.Dialect}
+	tm := database.NewTxManager(db)
+	errFailed := errors.New("failed")
+
+	attempts := 0
+	err := tm.WithTransaction(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("WithTransaction = %v, want %v", err, errFailed)
+	}
+	if attempts != 1 {
+		t.Fatalf("attempts = %d, want 1", attempts)
+	}
+}
+
+func TestNestedTransactionIsNotRetried(t *testing.T) {
+	db := newItemsDB(t)
+	db.Dialect = retryDialect{db.Dialect}
+	tm := database.NewTxManager(db)
+
+	outerAttempts, innerAttempts := 0, 0
+	err := tm.WithTransaction(context.Background(), func(ctx context.Context) error {
+		outerAttempts++
+		return tm.WithTransaction(ctx, func(ctx context.Context) error {
+			innerAttempts++
+			if outerAttempts == 1 {
+				return errDeadlock
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction: %v", err)
+	}
+	// The whole transaction runs again, not just the savepoint
+	if outerAttempts != 2 || innerAttempts != 2 {
+		t.Fatalf("attempts = %d outer, %d inner, want 2 and 2", outerAttempts, innerAttempts)
+	}
+}
@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Actions
+const (
+	ActionSignup           = "user.signup"
+	ActionEmailVerified    = "user.email_verified"
+	ActionLogin            = "auth.login"
+	ActionLogout           = "auth.logout"
+	ActionLogoutAll        = "auth.logout_all"
+	ActionPasswordForgot   = "password.reset_requested"
+	ActionPasswordReset    = "password.reset"
+	ActionPasswordChanged  = "password.changed"
+	ActionAccountLocked    = "account.locked"
+	ActionAccountUnlocked  = "account.unlocked"
+	ActionAccountSuspended = "account.suspended"
+	ActionSessionRevoked   = "session.revoked"
+
+	ActionWebhookCreated       = "webhook.subscription_created"
+	ActionWebhookDeleted       = "webhook.subscription_deleted"
+	ActionWebhookSecretRotated = "webhook.secret_rotated"
+	ActionWebhookReplayed      = "webhook.delivery_replayed"
+)
+
+// Outcomes
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Actors that aren't a signed in user
+const (
+	ActorSystem    = "system"
+	ActorAnonymous = "anonymous"
+	// Someone holding a link mailed to the account owner
+	ActorEmailLink = "email_link"
+)
+
+// Largest page the List endpoints return
+const MaxPageSize = 200
+
+type Event struct {
+	Id      int64  `json:"id"`
+	Action  string `json:"action"`
+	Outcome string `json:"outcome"`
+	// Who did it, "user:<id>", "admin:<id>", ActorSystem or ActorAnonymous
+	Actor   string `json:"actor"`
+	ActorId *int   `json:"actor_id,omitempty"`
+	// The account the action was about
+	TargetId  *int                   `json:"target_id,omitempty"`
+	IPAddress string                 `json:"ip_address"`
+	UserAgent string                 `json:"user_agent"`
+	RequestId string                 `json:"request_id"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+
+	// Tamper evidence, see ComputeHash
+	ChainDay string `json:"chain_day,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// Actor is who performed an action
+type Actor struct {
+	Name string
+	Id   *int
+}
+
+func UserActor(id int) Actor {
+	return Actor{Name: fmt.Sprintf("user:%d", id), Id: &id}
+}
+
+func AdminActor(id int) Actor {
+	return Actor{Name: fmt.Sprintf("admin:%d", id), Id: &id}
+}
+
+var (
+	SystemActor    = Actor{Name: ActorSystem}
+	AnonymousActor = Actor{Name: ActorAnonymous}
+	EmailLinkActor = Actor{Name: ActorEmailLink}
+)
+
+// NewEvent starts an event, targetId 0 means it isn't about a known account
+func NewEvent(action string, outcome string, actor Actor, targetId int) *Event {
+	event := &Event{
+		Action:  action,
+		Outcome: outcome,
+		Actor:   actor.Name,
+		ActorId: actor.Id,
+	}
+	if targetId != 0 {
+		event.TargetId = &targetId
+	}
+	return event
+}
+
+// With adds a metadata entry
+func (e *Event) With(key string, value interface{}) *Event {
+	if e.Metadata == nil {
+		e.Metadata = make(map[string]interface{})
+	}
+	e.Metadata[key] = value
+	return e
+}
+
+type Filter struct {
+	Action   string
+	Outcome  string
+	ActorId  *int
+	TargetId *int
+	Since    *time.Time
+	Until    *time.Time
+	// Only events older than this id, from the previous page
+	BeforeId int64
+	Limit    int
+}
+
+type Page struct {
+	Events     []*Event `json:"events"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// RequestInfo describes the HTTP request an event happened in
+type RequestInfo struct {
+	IPAddress string
+	UserAgent string
+	RequestId string
+}
+
+type requestInfoKey struct{}
+
+// RequestInfoKey is the context key the request middleware stores RequestInfo under
+var RequestInfoKey = requestInfoKey{}
+
+// RequestInfoFrom returns the request the context belongs to, empty outside of a request
+func RequestInfoFrom(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(RequestInfoKey).(RequestInfo)
+	return info
+}
+
+// Repository only appends, events are never changed or removed
+type Repository interface {
+	ChainRepository
+
+	// Insert appends the event to its day's hash chain
+	Insert(ctx context.Context, event *Event) error
+	// List returns events newest first
+	List(ctx context.Context, filter Filter) ([]*Event, error)
+}
+
+// Recorder is used by other services to write events, failures are logged and never block the action
+type Recorder interface {
+	Record(ctx context.Context, event *Event)
+}
+
+// Exporter forwards events to an external system, it must not block
+type Exporter interface {
+	Export(event *Event)
+}
+
+type Service interface {
+	Recorder
+
+	// List pages through events, cursor comes from the previous Page
+	List(ctx context.Context, filter Filter, cursor string) (*Page, error)
+
+	// VerifyChain checks every chain between the two days (inclusive, empty for no bound)
+	// and reports the first broken link
+	VerifyChain(ctx context.Context, fromDay string, toDay string) (*VerifyResult, error)
+	// CreateCheckpoints signs the heads of chains that grew since their last checkpoint
+	CreateCheckpoints(ctx context.Context) ([]*Checkpoint, error)
+	ExportCheckpoints(ctx context.Context, fromDay string, toDay string) (*CheckpointExport, error)
+
+	// Stop periodic checkpoints
+	Close()
+}
@@ -0,0 +1,168 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ChainDayLayout names a chain, one chain per UTC day
+const ChainDayLayout = "2006-01-02"
+
+// Reasons reported in a ChainBreak
+const (
+	BreakPrevHash            = "prev_hash_mismatch"
+	BreakHash                = "hash_mismatch"
+	BreakHead                = "head_mismatch"
+	BreakCheckpoint          = "checkpoint_mismatch"
+	BreakCheckpointSignature = "checkpoint_signature_invalid"
+)
+
+// ChainDay returns the chain an event created at t belongs to
+func ChainDay(t time.Time) string {
+	return t.UTC().Format(ChainDayLayout)
+}
+
+// GenesisHash is the prev_hash of the first event of a day, tying the chain to its date
+func GenesisHash(day string) string {
+	sum := sha256.Sum256([]byte("audit-chain:" + day))
+	return hex.EncodeToString(sum[:])
+}
+
+// chainRecord is what gets hashed, field order is fixed by the struct
+type chainRecord struct {
+	PrevHash  string          `json:"prev_hash"`
+	Action    string          `json:"action"`
+	Outcome   string          `json:"outcome"`
+	Actor     string          `json:"actor"`
+	ActorId   *int            `json:"actor_id"`
+	TargetId  *int            `json:"target_id"`
+	IPAddress string          `json:"ip_address"`
+	UserAgent string          `json:"user_agent"`
+	RequestId string          `json:"request_id"`
+	Metadata  json.RawMessage `json:"metadata"`
+	CreatedAt int64           `json:"created_at"`
+}
+
+// ComputeHash hashes the event together with the hash of the event before it.
+// CreatedAt counts in microseconds, the precision the table stores.
+func (e *Event) ComputeHash(prevHash string) (string, error) {
+	metadata, err := CanonicalMetadata(e.Metadata)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := json.Marshal(chainRecord{
+		PrevHash:  prevHash,
+		Action:    e.Action,
+		Outcome:   e.Outcome,
+		Actor:     e.Actor,
+		ActorId:   e.ActorId,
+		TargetId:  e.TargetId,
+		IPAddress: e.IPAddress,
+		UserAgent: e.UserAgent,
+		RequestId: e.RequestId,
+		Metadata:  metadata,
+		CreatedAt: e.CreatedAt.UnixMicro(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit event: %w", err)
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CanonicalMetadata encodes metadata the same way before it is stored and after it
+// is read back, so numbers and key order don't change the hash
+func CanonicalMetadata(metadata map[string]interface{}) (json.RawMessage, error) {
+	if len(metadata) == 0 {
+		return json.RawMessage("null"), nil
+	}
+
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit metadata: %w", err)
+	}
+	decoded, err := DecodeMetadata(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
+
+// DecodeMetadata keeps numbers as written instead of converting them to float64
+func DecodeMetadata(data []byte) (map[string]interface{}, error) {
+	var metadata map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode audit metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// ChainHead is the last event appended to a day's chain
+type ChainHead struct {
+	Day         string `json:"day"`
+	LastEventId int64  `json:"last_event_id"`
+	LastHash    string `json:"last_hash"`
+	EventCount  int    `json:"event_count"`
+}
+
+// ChainBreak is the first link that failed verification
+type ChainBreak struct {
+	Day     string `json:"day"`
+	EventId int64  `json:"event_id,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+type VerifyResult struct {
+	Days          []string    `json:"days"`
+	EventsChecked int         `json:"events_checked"`
+	Valid         bool        `json:"valid"`
+	Break         *ChainBreak `json:"break,omitempty"`
+}
+
+// Checkpoint is a signed copy of a chain head that can be stored outside the database
+type Checkpoint struct {
+	Id          int64     `json:"id"`
+	Day         string    `json:"day"`
+	LastEventId int64     `json:"last_event_id"`
+	LastHash    string    `json:"last_hash"`
+	EventCount  int       `json:"event_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	KeyId       string    `json:"key_id"`
+	// Base64 ed25519 signature over SigningPayload
+	Signature string `json:"signature"`
+}
+
+// SigningPayload is the exact message a checkpoint signature covers
+func (c *Checkpoint) SigningPayload() []byte {
+	return []byte(fmt.Sprintf("audit-checkpoint:v1|%s|%d|%s|%d|%d",
+		c.Day, c.LastEventId, c.LastHash, c.EventCount, c.CreatedAt.UnixMicro()))
+}
+
+// CheckpointExport is everything a verifier needs, stored away from the database
+type CheckpointExport struct {
+	Algorithm   string        `json:"algorithm"`
+	KeyId       string        `json:"key_id"`
+	PublicKey   string        `json:"public_key"`
+	Checkpoints []*Checkpoint `json:"checkpoints"`
+}
+
+// ChainRepository reads the chain for verification, events are appended through Repository.Insert
+type ChainRepository interface {
+	// WalkDay calls fn for every event of the day in chain order
+	WalkDay(ctx context.Context, day string, fn func(event *Event) error) error
+	ListHeads(ctx context.Context, fromDay string, toDay string) ([]*ChainHead, error)
+	GetEventHash(ctx context.Context, id int64) (string, error)
+
+	InsertCheckpoint(ctx context.Context, checkpoint *Checkpoint) error
+	LatestCheckpoint(ctx context.Context, day string) (*Checkpoint, error)
+	ListCheckpoints(ctx context.Context, fromDay string, toDay string) ([]*Checkpoint, error)
+}
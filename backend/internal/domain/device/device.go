@@ -0,0 +1,39 @@
+package device
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+type KnownDevice struct {
+	Id          int       `json:"id"`
+	UserId      int       `json:"user_id"`
+	Fingerprint string    `json:"fingerprint"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// Fingerprint identifies a device by the IP and user-agent it logs in from
+func Fingerprint(ipAddress, userAgent string) string {
+	sum := sha256.Sum256([]byte(ipAddress + "|" + userAgent))
+	return hex.EncodeToString(sum[:])
+}
+
+type Repository interface {
+	Create(ctx context.Context, device *KnownDevice) error
+	GetByFingerprint(ctx context.Context, userId int, fingerprint string) (*KnownDevice, error)
+	CountByUser(ctx context.Context, userId int) (int, error)
+	Touch(ctx context.Context, id int) error
+	DeleteByUser(ctx context.Context, userId int) error
+}
+
+type Service interface {
+	// RecordLogin remembers the device and alerts the user when it has never been seen before
+	RecordLogin(ctx context.Context, userId int, email string, ipAddress string, userAgent string) error
+	// ForgetAll drops every known device so the next login from each one alerts again
+	ForgetAll(ctx context.Context, userId int) error
+}
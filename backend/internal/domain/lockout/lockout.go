@@ -0,0 +1,28 @@
+package lockout
+
+import (
+	"context"
+
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	"github.com/imnzr/user-authentication-go/internal/domain/user"
+)
+
+type Service interface {
+	// Check returns errorpkg.ErrAccountLocked or errorpkg.ErrLoginThrottled while the user has to wait
+	Check(ctx context.Context, u *user.User) error
+	RecordFailure(ctx context.Context, u *user.User) error
+	RecordSuccess(ctx context.Context, u *user.User) error
+
+	// CheckEmail and RecordEmailFailure throttle an email that has no account on the same
+	// schedule, keyed by its blind index, so sign-in answers don't tell the two apart
+	CheckEmail(ctx context.Context, emailIndex string) error
+	RecordEmailFailure(ctx context.Context, emailIndex string) error
+
+	// Unlock clears the lock early, actor is recorded in the audit trail
+	Unlock(ctx context.Context, userId int, actor audit.Actor) error
+	// CheckUnlockToken validates the link from the lock email without using it, the user
+	// confirms before anything changes
+	CheckUnlockToken(ctx context.Context, tokenString string) error
+	// UnlockWithToken handles the confirmed unlock link, it works once
+	UnlockWithToken(ctx context.Context, tokenString string) error
+}
@@ -0,0 +1,26 @@
+package revocation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenId names a token in the store, its jti claim or, for tokens issued without one,
+// a SHA-256 of the token so the raw token is never used as a key
+func TokenId(token string, claims jwt.MapClaims) string {
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		return "jti:" + jti
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Store remembers revoked tokens until they would have expired anyway.
+// Writes and lookups must both go through it so they agree on the key.
+type Store interface {
+	Revoke(ctx context.Context, token string, claims jwt.MapClaims) error
+	IsRevoked(ctx context.Context, token string, claims jwt.MapClaims) (bool, error)
+}
@@ -0,0 +1,40 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+type Session struct {
+	Id         string     `json:"id"`
+	UserId     int        `json:"user_id"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// TouchInterval is how often a session's last_seen_at is written, requests in between
+// don't touch the database
+const TouchInterval = time.Minute
+
+type Repository interface {
+	Create(ctx context.Context, session *Session) error
+	ListActiveByUser(ctx context.Context, userId int) ([]*Session, error)
+	Touch(ctx context.Context, id string) error
+	Revoke(ctx context.Context, userId int, id string) error
+	// RevokeAll returns the ids of the sessions it revoked
+	RevokeAll(ctx context.Context, userId int) ([]string, error)
+}
+
+type Service interface {
+	Create(ctx context.Context, userId int, ipAddress string, userAgent string) (*Session, error)
+	List(ctx context.Context, userId int) ([]*Session, error)
+	Revoke(ctx context.Context, userId int, sessionId string) error
+	RevokeAll(ctx context.Context, userId int) error
+
+	// Used by the auth middleware on every request
+	IsRevoked(ctx context.Context, sessionId string) (bool, error)
+	Touch(ctx context.Context, sessionId string) error
+}
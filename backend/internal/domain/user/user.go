@@ -11,35 +11,96 @@ import (
 )
 
 type User struct {
-	Id        int       `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Id                    int        `json:"id"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	Password              string     `json:"password"`
+	Status                string     `json:"status"`
+	Role                  string     `json:"role"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	TokenEpoch            int        `json:"-"`
+	FailedLoginAttempts   int        `json:"-"`
+	LockedUntil           *time.Time `json:"locked_until,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
 }
 
+// User status
+const (
+	StatusPending   = "pending"
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+)
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Repository returns errorpkg.ErrUserNotFound for a missing user, and ErrEmailTaken when
+// Create hits the unique email index
 type Repository interface {
 	Create(ctx context.Context, user *User) error
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	GetById(ctx context.Context, userId int) (*User, error)
-	ResetPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, email string, hashedPassword string) error
+	UpdatePassword(ctx context.Context, userId int, hashedPassword string) error
+	RequirePasswordReset(ctx context.Context, userId int) error
+	UpdateStatus(ctx context.Context, userId int, status string) error
+
+	// Account lockout
+	IncrementFailedLogins(ctx context.Context, userId int) (int, error)
+	SetLockedUntil(ctx context.Context, userId int, until time.Time, resetAttempts bool) error
+	ClearLockout(ctx context.Context, userId int) error
+
+	// Token epoch, every token carrying an older epoch is rejected
+	GetTokenEpoch(ctx context.Context, userId int) (int, error)
+	IncrementTokenEpoch(ctx context.Context, userId int) (int, error)
 
 	// Verifify User Create
 	ActivateByEmail(ctx context.Context, email string) error
+
+	// PII encryption. ListStalePII returns ids after afterId whose username and email are
+	// still plaintext or whose data key is wrapped by an older master key.
+	ListStalePII(ctx context.Context, afterId int, limit int) ([]int, error)
+	// ReencryptPII brings one user up to the active master key, reporting whether it changed
+	ReencryptPII(ctx context.Context, userId int) (bool, error)
+	// EmailIndex is the blind index an email is looked up by. Logs keep it instead of the
+	// address, attempts on the same email can still be told apart.
+	EmailIndex(email string) string
 }
 
 type Service interface {
+	// Create returns a nil user when the email is already registered. The owner is mailed
+	// instead, so the caller can answer the same way in both cases.
 	Create(ctx context.Context, req *request.UserCreateRequest) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	GetById(ctx context.Context, userId int) (*User, error)
 	GetUserProfile(ctx context.Context, userId int) (*response.UserProfileResponse, error)
 	LoginUser(ctx context.Context, req *request.UserLoginRequest) (*response.TokenResponse, error)
-	LogoutUser(ctx context.Context, token string, exp int64) error
+	LogoutUser(ctx context.Context, userId int, sessionId string, token string, claims jwt.MapClaims) error
 	VerifyEmail(ctx context.Context, tokenString string) (jwt.MapClaims, error)
 
 	ForgotPassword(ctx context.Context, email string) error
+	ResendVerification(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, req *request.ResetPasswordRequest) error
+	ChangePassword(ctx context.Context, userId int, req *request.ChangePasswordRequest) error
+	// CheckUnrecognizedLogin validates the "this wasn't me" link from a new device alert
+	// without using it, the user confirms before anything changes
+	CheckUnrecognizedLogin(ctx context.Context, tokenString string) error
+	// ReportUnrecognizedLogin handles the confirmed "this wasn't me" link, it works once
+	ReportUnrecognizedLogin(ctx context.Context, tokenString string) error
+	// LogoutAll signs the user out of every device
+	LogoutAll(ctx context.Context, userId int) error
+	// SuspendUser blocks the account and signs it out, adminId is recorded in the audit trail
+	SuspendUser(ctx context.Context, userId int, adminId int) error
+}
+
+// TokenEpochStore is the cached view of users.token_epoch used on every request
+type TokenEpochStore interface {
+	Current(ctx context.Context, userId int) (int, error)
+	Bump(ctx context.Context, userId int) (int, error)
 }
 
 type Controller interface {
@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/pkg/request"
+)
+
+type EventType string
+
+// User lifecycle events
+const (
+	EventUserSignedUp EventType = "user.signed_up"
+	EventUserVerified EventType = "user.verified"
+	EventUserLoggedIn EventType = "user.logged_in"
+	// user.Service has no email change or account deletion yet, nothing publishes these two
+	// until it does. Subscriptions can already ask for them.
+	EventUserEmailChanged EventType = "user.email_changed"
+	EventUserDeleted      EventType = "user.deleted"
+
+	// Subscribe to every event
+	EventAll EventType = "*"
+)
+
+// Delivery status
+const (
+	DeliveryPending   = "pending"
+	DeliveryRetrying  = "retrying"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+var KnownEvents = []EventType{
+	EventUserSignedUp,
+	EventUserVerified,
+	EventUserLoggedIn,
+	EventUserEmailChanged,
+	EventUserDeleted,
+}
+
+type Event struct {
+	Id         string                 `json:"id"`
+	Type       EventType              `json:"type"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+type Subscription struct {
+	Id        int         `json:"id"`
+	URL       string      `json:"url"`
+	Secret    string      `json:"-"`
+	Events    []EventType `json:"events"`
+	Active    bool        `json:"active"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// Matches reports whether the subscription wants the given event
+func (s *Subscription) Matches(eventType EventType) bool {
+	if !s.Active {
+		return false
+	}
+	for _, e := range s.Events {
+		if e == EventAll || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type Delivery struct {
+	Id             int       `json:"id"`
+	SubscriptionId int       `json:"subscription_id"`
+	EventId        string    `json:"event_id"`
+	EventType      EventType `json:"event_type"`
+	Payload        string    `json:"payload"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	ResponseCode   int       `json:"response_code"`
+	LastError      string    `json:"last_error"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// When the sweeper may hand the delivery to a worker, zero once it succeeded or failed
+	NextAttemptAt time.Time `json:"-"`
+}
+
+type Repository interface {
+	CreateSubscription(ctx context.Context, sub *Subscription) error
+	GetSubscription(ctx context.Context, id int) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	UpdateSubscriptionSecret(ctx context.Context, id int, secret string) error
+	DeleteSubscription(ctx context.Context, id int) error
+
+	// Delivery log
+	CreateDelivery(ctx context.Context, delivery *Delivery) error
+	UpdateDelivery(ctx context.Context, delivery *Delivery) error
+	GetDelivery(ctx context.Context, id int) (*Delivery, error)
+	ListDeliveries(ctx context.Context, subscriptionId int, limit int) ([]*Delivery, error)
+	// Pending and retrying deliveries whose next attempt is due, oldest first
+	ListDueDeliveries(ctx context.Context, now time.Time, limit int) ([]int, error)
+	// ClaimDelivery moves a due delivery's next attempt to until, it reports false when
+	// another instance claimed it first
+	ClaimDelivery(ctx context.Context, id int, now time.Time, until time.Time) (bool, error)
+}
+
+// Publisher is used by other services to emit events without caring about delivery
+type Publisher interface {
+	Publish(ctx context.Context, eventType EventType, data map[string]interface{})
+}
+
+type Service interface {
+	Publisher
+
+	// Changes are recorded in the audit trail with adminId as the actor
+	CreateSubscription(ctx context.Context, req *request.WebhookSubscriptionRequest, adminId int) (*Subscription, string, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	DeleteSubscription(ctx context.Context, id int, adminId int) error
+	RotateSecret(ctx context.Context, id int, adminId int) (string, error)
+
+	ListDeliveries(ctx context.Context, subscriptionId int, limit int) ([]*Delivery, error)
+	ReplayDelivery(ctx context.Context, deliveryId int, adminId int) (*Delivery, error)
+
+	// Stop delivery workers
+	Close()
+}
@@ -0,0 +1,10 @@
+package errorpkg
+
+import "errors"
+
+var (
+	ErrInvalidAuditCursor   = errors.New("invalid audit cursor")
+	ErrAuditEventNotFound   = errors.New("audit event not found")
+	ErrCheckpointsDisabled  = errors.New("audit checkpoint signing key is not configured")
+	ErrInvalidCheckpointKey = errors.New("invalid audit checkpoint signing key")
+)
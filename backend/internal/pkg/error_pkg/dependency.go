@@ -0,0 +1,8 @@
+package errorpkg
+
+import "errors"
+
+var (
+	// ErrServiceUnavailable is returned when a dependency is down and the check fails closed
+	ErrServiceUnavailable = errors.New("service temporarily unavailable, try again later")
+)
@@ -0,0 +1,7 @@
+package errorpkg
+
+import "errors"
+
+var (
+	ErrDeviceNotFound = errors.New("device not found")
+)
@@ -0,0 +1,7 @@
+package errorpkg
+
+import "errors"
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+)
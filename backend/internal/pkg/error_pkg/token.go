@@ -0,0 +1,7 @@
+package errorpkg
+
+import "errors"
+
+var (
+	ErrTokenRevoked = errors.New("token_revoked")
+)
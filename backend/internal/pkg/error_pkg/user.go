@@ -1,7 +1,32 @@
 package errorpkg
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
-	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidCredentials    = errors.New("invalid email or password")
+	ErrPasswordResetRequired = errors.New("password reset required")
+	ErrInvalidResetCode      = errors.New("invalid or expired reset code")
+	ErrInvalidLink           = errors.New("invalid or expired link")
+	ErrAccountSuspended      = errors.New("account suspended")
+	ErrAccountLocked         = errors.New("account temporarily locked")
+	ErrLoginThrottled        = errors.New("too many failed login attempts")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrEmailTaken            = errors.New("email is already registered")
 )
+
+// RetryAfterError tells the caller when the request may be tried again
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,10 @@
+package errorpkg
+
+import "errors"
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrWebhookInvalidURL       = errors.New("invalid webhook url")
+	ErrWebhookInvalidEvent     = errors.New("invalid webhook event")
+)
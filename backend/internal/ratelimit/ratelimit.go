@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+)
+
+type Result struct {
+	Allowed bool
+	Limit   int
+	// Requests left before the limit is hit
+	Remaining int
+	// How long a denied request must wait
+	RetryAfter time.Duration
+	// How long until the limit is fully restored
+	ResetAfter time.Duration
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, policy config.RateLimitPolicy, key string) (*Result, error)
+}
+
+// gcraScript implements the generic cell rate algorithm.
+// The key stores the theoretical arrival time (TAT) in milliseconds and the
+// clock comes from Redis itself, so every instance sharing the Redis agrees.
+var gcraScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local interval = period / limit
+
+local tat = tonumber(redis.call("GET", key))
+if not tat or tat < now then
+	tat = now
+end
+
+local new_tat = tat + interval
+local allow_at = new_tat - period
+if allow_at > now then
+	return {0, 0, math.ceil(allow_at - now), math.ceil(tat - now)}
+end
+
+redis.call("SET", key, tostring(new_tat), "PX", math.ceil(new_tat - now))
+return {1, math.floor((now - allow_at) / interval), 0, math.ceil(new_tat - now)}
+`, gcraLocal)
+
+// gcraLocal is gcraScript for the in-memory client
+func gcraLocal(store redis.ScriptStore, keys []string, args []interface{}) (interface{}, error) {
+	limit, ok1 := args[0].(int)
+	period, ok2 := args[1].(int64)
+	if !ok1 || !ok2 || limit <= 0 {
+		return nil, fmt.Errorf("invalid rate limit arguments: %v", args)
+	}
+
+	now := float64(store.Now().UnixMilli())
+	interval := float64(period) / float64(limit)
+
+	tat := now
+	if value, ok := store.Get(keys[0]); ok {
+		if stored, err := strconv.ParseFloat(value, 64); err == nil && stored > now {
+			tat = stored
+		}
+	}
+
+	newTat := tat + interval
+	allowAt := newTat - float64(period)
+	if allowAt > now {
+		return []interface{}{int64(0), int64(0), int64(math.Ceil(allowAt - now)), int64(math.Ceil(tat - now))}, nil
+	}
+
+	resetAfter := math.Ceil(newTat - now)
+	store.Set(keys[0], strconv.FormatFloat(newTat, 'f', -1, 64), time.Duration(resetAfter)*time.Millisecond)
+	return []interface{}{int64(1), int64(math.Floor((now - allowAt) / interval)), int64(0), int64(resetAfter)}, nil
+}
+
+type redisLimiter struct {
+	client redis.Client
+}
+
+func NewRedisLimiter(client redis.Client) Limiter {
+	return &redisLimiter{client: client}
+}
+
+// Allow implements Limiter.
+func (l *redisLimiter) Allow(ctx context.Context, policy config.RateLimitPolicy, key string) (*Result, error) {
+	redisKey := fmt.Sprintf("rate_limit:%s:%s", policy.Name, key)
+
+	reply, err := l.client.Eval(ctx, gcraScript, []string{redisKey}, policy.Limit, policy.Period.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate rate limit: %w", err)
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit result: %v", reply)
+	}
+	ints := make([]int64, len(values))
+	for i, v := range values {
+		if ints[i], ok = v.(int64); !ok {
+			return nil, fmt.Errorf("unexpected rate limit result: %v", reply)
+		}
+	}
+
+	return &Result{
+		Allowed:    ints[0] == 1,
+		Limit:      policy.Limit,
+		Remaining:  int(ints[1]),
+		RetryAfter: time.Duration(ints[2]) * time.Millisecond,
+		ResetAfter: time.Duration(ints[3]) * time.Millisecond,
+	}, nil
+}
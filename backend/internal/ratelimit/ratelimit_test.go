@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+)
+
+func allow(t *testing.T, limiter Limiter, policy config.RateLimitPolicy, key string) *Result {
+	t.Helper()
+
+	result, err := limiter.Allow(context.Background(), policy, key)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	return result
+}
+
+func TestGCRAAllowsBurstThenDenies(t *testing.T) {
+	limiter := NewRedisLimiter(redis.NewMemoryClient())
+	policy := config.RateLimitPolicy{Name: "test", Limit: 3, Period: time.Minute}
+
+	for want := 2; want >= 0; want-- {
+		result := allow(t, limiter, policy, "a")
+		if !result.Allowed || result.Remaining != want || result.Limit != 3 {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", 3-want, result, want)
+		}
+	}
+
+	result := allow(t, limiter, policy, "a")
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("request 4 = %+v, want denied", result)
+	}
+	// One request comes back every period / limit
+	if result.RetryAfter <= 19*time.Second || result.RetryAfter > 20*time.Second {
+		t.Fatalf("RetryAfter = %v, want about 20s", result.RetryAfter)
+	}
+	if result.ResetAfter <= 59*time.Second || result.ResetAfter > time.Minute {
+		t.Fatalf("ResetAfter = %v, want about 1m", result.ResetAfter)
+	}
+
+	// A denied request doesn't push the limit further out
+	if again := allow(t, limiter, policy, "a"); again.RetryAfter > result.RetryAfter {
+		t.Fatalf("RetryAfter grew from %v to %v", result.RetryAfter, again.RetryAfter)
+	}
+}
+
+func TestGCRAKeysAndPoliciesAreIndependent(t *testing.T) {
+	limiter := NewRedisLimiter(redis.NewMemoryClient())
+	login := config.RateLimitPolicy{Name: "login", Limit: 1, Period: time.Minute}
+	signup := config.RateLimitPolicy{Name: "signup", Limit: 1, Period: time.Minute}
+
+	if !allow(t, limiter, login, "a").Allowed {
+		t.Fatal("first request denied")
+	}
+	if allow(t, limiter, login, "a").Allowed {
+		t.Fatal("second request allowed")
+	}
+	if !allow(t, limiter, login, "b").Allowed {
+		t.Fatal("another key shares the limit")
+	}
+	if !allow(t, limiter, signup, "a").Allowed {
+		t.Fatal("another policy shares the limit")
+	}
+}
+
+func TestGCRARestoresOverTime(t *testing.T) {
+	limiter := NewRedisLimiter(redis.NewMemoryClient())
+	policy := config.RateLimitPolicy{Name: "test", Limit: 2, Period: 200 * time.Millisecond}
+
+	allow(t, limiter, policy, "a")
+	allow(t, limiter, policy, "a")
+	denied := allow(t, limiter, policy, "a")
+	if denied.Allowed {
+		t.Fatal("third request allowed")
+	}
+
+	time.Sleep(denied.RetryAfter + 20*time.Millisecond)
+	result := allow(t, limiter, policy, "a")
+	if !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("request after RetryAfter = %+v, want allowed with 0 remaining", result)
+	}
+}
+
+func TestGCRARejectsInvalidPolicy(t *testing.T) {
+	limiter := NewRedisLimiter(redis.NewMemoryClient())
+
+	_, err := limiter.Allow(context.Background(), config.RateLimitPolicy{Name: "test", Limit: 0, Period: time.Minute}, "a")
+	if err == nil {
+		t.Fatal("Allow with a zero limit succeeded")
+	}
+}
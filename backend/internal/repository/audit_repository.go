@@ -0,0 +1,368 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+)
+
+type auditRepository struct {
+	db      database.Querier
+	primary *sql.DB
+	dialect database.Dialect
+}
+
+func NewAuditRepository(db *database.DB) audit.Repository {
+	return &auditRepository{
+		db:      database.Bind(db.Dialect, db.Primary),
+		primary: db.Primary,
+		dialect: db.Dialect,
+	}
+}
+
+func nullInt(v *int) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*v), Valid: true}
+}
+
+func intPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
+
+const auditEventColumns = `id, action, outcome, actor, actor_id, target_id, ip_address, user_agent, request_id,
+	metadata, created_at, chain_day, prev_hash, hash`
+
+func scanAuditEvent(row rowScanner) (*audit.Event, error) {
+	event := &audit.Event{}
+	var (
+		actorId, targetId sql.NullInt64
+		metadata          sql.NullString
+		chainDay          sql.NullTime
+		prevHash, hash    sql.NullString
+	)
+	if err := row.Scan(
+		&event.Id, &event.Action, &event.Outcome, &event.Actor, &actorId, &targetId,
+		&event.IPAddress, &event.UserAgent, &event.RequestId, &metadata, &event.CreatedAt,
+		&chainDay, &prevHash, &hash,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan audit event: %w", err)
+	}
+	event.ActorId = intPtr(actorId)
+	event.TargetId = intPtr(targetId)
+	if metadata.Valid {
+		decoded, err := audit.DecodeMetadata([]byte(metadata.String))
+		if err != nil {
+			return nil, err
+		}
+		event.Metadata = decoded
+	}
+	// Events from before the chain existed have none of these
+	if chainDay.Valid {
+		event.ChainDay = chainDay.Time.Format(audit.ChainDayLayout)
+	}
+	event.PrevHash = prevHash.String
+	event.Hash = hash.String
+
+	return event, nil
+}
+
+// Insert implements audit.Repository.
+func (a *auditRepository) Insert(ctx context.Context, event *audit.Event) error {
+	// The hash covers created_at, so it must already have the precision the column keeps
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+	event.ChainDay = audit.ChainDay(event.CreatedAt)
+
+	metadata, err := audit.CanonicalMetadata(event.Metadata)
+	if err != nil {
+		return err
+	}
+	storedMetadata := sql.NullString{String: string(metadata), Valid: len(event.Metadata) > 0}
+
+	rawTx, err := a.primary.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin audit transaction: %w", err)
+	}
+	defer rawTx.Rollback()
+	tx := database.Bind(a.dialect, rawTx)
+
+	// Locking the day's head row serializes appends to the chain
+	if _, err := tx.ExecContext(ctx,
+		a.dialect.InsertIgnore("INSERT INTO audit_chain_heads(chain_day, last_event_id, last_hash, event_count) VALUES (?,0,?,0)"),
+		event.ChainDay, audit.GenesisHash(event.ChainDay),
+	); err != nil {
+		return fmt.Errorf("failed to create audit chain head: %w", err)
+	}
+	if err := tx.QueryRowContext(ctx,
+		a.dialect.ForUpdate("SELECT last_hash FROM audit_chain_heads WHERE chain_day = ?"), event.ChainDay,
+	).Scan(&event.PrevHash); err != nil {
+		return fmt.Errorf("failed to lock audit chain head: %w", err)
+	}
+
+	event.Hash, err = event.ComputeHash(event.PrevHash)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_events(action, outcome, actor, actor_id, target_id, ip_address, user_agent, request_id, metadata, created_at, chain_day, prev_hash, hash)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)
+	`
+	id, err := a.dialect.InsertId(ctx, tx, query,
+		event.Action,
+		event.Outcome,
+		event.Actor,
+		nullInt(event.ActorId),
+		nullInt(event.TargetId),
+		event.IPAddress,
+		event.UserAgent,
+		event.RequestId,
+		storedMetadata,
+		event.CreatedAt,
+		event.ChainDay,
+		event.PrevHash,
+		event.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE audit_chain_heads SET last_event_id = ?, last_hash = ?, event_count = event_count + 1 WHERE chain_day = ?",
+		id, event.Hash, event.ChainDay,
+	); err != nil {
+		return fmt.Errorf("failed to advance audit chain head: %w", err)
+	}
+
+	if err := rawTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit audit event: %w", err)
+	}
+	event.Id = id
+	return nil
+}
+
+// List implements audit.Repository.
+func (a *auditRepository) List(ctx context.Context, filter audit.Filter) ([]*audit.Event, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.Outcome != "" {
+		conditions = append(conditions, "outcome = ?")
+		args = append(args, filter.Outcome)
+	}
+	if filter.ActorId != nil {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, *filter.ActorId)
+	}
+	if filter.TargetId != nil {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, *filter.TargetId)
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC())
+	}
+	if filter.BeforeId > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.BeforeId)
+	}
+
+	query := "SELECT " + auditEventColumns + " FROM audit_events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := a.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*audit.Event
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// WalkDay implements audit.Repository.
+func (a *auditRepository) WalkDay(ctx context.Context, day string, fn func(event *audit.Event) error) error {
+	rows, err := a.db.QueryContext(ctx,
+		"SELECT "+auditEventColumns+" FROM audit_events WHERE chain_day = ? ORDER BY id", day,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to read audit chain: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// dayRange adds optional chain_day bounds to a query
+func dayRange(query string, fromDay string, toDay string) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if fromDay != "" {
+		conditions = append(conditions, "chain_day >= ?")
+		args = append(args, fromDay)
+	}
+	if toDay != "" {
+		conditions = append(conditions, "chain_day <= ?")
+		args = append(args, toDay)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return query, args
+}
+
+// ListHeads implements audit.Repository.
+func (a *auditRepository) ListHeads(ctx context.Context, fromDay string, toDay string) ([]*audit.ChainHead, error) {
+	query, args := dayRange("SELECT chain_day, last_event_id, last_hash, event_count FROM audit_chain_heads", fromDay, toDay)
+	rows, err := a.db.QueryContext(ctx, query+" ORDER BY chain_day", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit chain heads: %w", err)
+	}
+	defer rows.Close()
+
+	var heads []*audit.ChainHead
+	for rows.Next() {
+		head := &audit.ChainHead{}
+		var day time.Time
+		if err := rows.Scan(&day, &head.LastEventId, &head.LastHash, &head.EventCount); err != nil {
+			return nil, fmt.Errorf("failed to scan audit chain head: %w", err)
+		}
+		head.Day = day.Format(audit.ChainDayLayout)
+		heads = append(heads, head)
+	}
+
+	return heads, rows.Err()
+}
+
+// GetEventHash implements audit.Repository.
+func (a *auditRepository) GetEventHash(ctx context.Context, id int64) (string, error) {
+	var hash sql.NullString
+	err := a.db.QueryRowContext(ctx, "SELECT hash FROM audit_events WHERE id = ?", id).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", errorpkg.ErrAuditEventNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get audit event hash: %w", err)
+	}
+	return hash.String, nil
+}
+
+// InsertCheckpoint implements audit.Repository.
+func (a *auditRepository) InsertCheckpoint(ctx context.Context, checkpoint *audit.Checkpoint) error {
+	query := `
+		INSERT INTO audit_checkpoints(chain_day, last_event_id, last_hash, event_count, key_id, signature, created_at)
+		VALUES (?,?,?,?,?,?,?)
+	`
+	id, err := a.dialect.InsertId(ctx, a.db, query,
+		checkpoint.Day,
+		checkpoint.LastEventId,
+		checkpoint.LastHash,
+		checkpoint.EventCount,
+		checkpoint.KeyId,
+		checkpoint.Signature,
+		checkpoint.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit checkpoint: %w", err)
+	}
+	checkpoint.Id = id
+	return nil
+}
+
+const auditCheckpointColumns = "id, chain_day, last_event_id, last_hash, event_count, key_id, signature, created_at"
+
+func scanAuditCheckpoint(row rowScanner) (*audit.Checkpoint, error) {
+	checkpoint := &audit.Checkpoint{}
+	var day time.Time
+	if err := row.Scan(
+		&checkpoint.Id, &day, &checkpoint.LastEventId, &checkpoint.LastHash, &checkpoint.EventCount,
+		&checkpoint.KeyId, &checkpoint.Signature, &checkpoint.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	checkpoint.Day = day.Format(audit.ChainDayLayout)
+	return checkpoint, nil
+}
+
+// LatestCheckpoint implements audit.Repository.
+func (a *auditRepository) LatestCheckpoint(ctx context.Context, day string) (*audit.Checkpoint, error) {
+	row := a.db.QueryRowContext(ctx,
+		"SELECT "+auditCheckpointColumns+" FROM audit_checkpoints WHERE chain_day = ? ORDER BY id DESC LIMIT 1", day,
+	)
+	checkpoint, err := scanAuditCheckpoint(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// ListCheckpoints implements audit.Repository.
+func (a *auditRepository) ListCheckpoints(ctx context.Context, fromDay string, toDay string) ([]*audit.Checkpoint, error) {
+	query, args := dayRange("SELECT "+auditCheckpointColumns+" FROM audit_checkpoints", fromDay, toDay)
+	rows, err := a.db.QueryContext(ctx, query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var checkpoints []*audit.Checkpoint
+	for rows.Next() {
+		checkpoint, err := scanAuditCheckpoint(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit checkpoint: %w", err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	return checkpoints, rows.Err()
+}
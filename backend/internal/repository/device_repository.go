@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/domain/device"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+)
+
+type deviceRepository struct {
+	db      database.Querier
+	dialect database.Dialect
+}
+
+func NewDeviceRepository(db *database.DB) device.Repository {
+	return &deviceRepository{
+		db:      database.Bind(db.Dialect, db.Primary),
+		dialect: db.Dialect,
+	}
+}
+
+// Create implements device.Repository.
+func (d *deviceRepository) Create(ctx context.Context, knownDevice *device.KnownDevice) error {
+	query := `
+		INSERT INTO user_devices(user_id, fingerprint, ip_address, user_agent, first_seen_at, last_seen_at)
+		VALUES (?,?,?,?,NOW(),NOW())
+	`
+	id, err := d.dialect.InsertId(ctx, d.db, query,
+		knownDevice.UserId,
+		knownDevice.Fingerprint,
+		knownDevice.IPAddress,
+		knownDevice.UserAgent,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create known device: %w", err)
+	}
+	knownDevice.Id = int(id)
+	return nil
+}
+
+// GetByFingerprint implements device.Repository.
+func (d *deviceRepository) GetByFingerprint(ctx context.Context, userId int, fingerprint string) (*device.KnownDevice, error) {
+	query := `
+		SELECT id, user_id, fingerprint, ip_address, user_agent, first_seen_at, last_seen_at
+		FROM user_devices WHERE user_id = ? AND fingerprint = ?
+	`
+	knownDevice := &device.KnownDevice{}
+	err := d.db.QueryRowContext(ctx, query, userId, fingerprint).Scan(
+		&knownDevice.Id,
+		&knownDevice.UserId,
+		&knownDevice.Fingerprint,
+		&knownDevice.IPAddress,
+		&knownDevice.UserAgent,
+		&knownDevice.FirstSeenAt,
+		&knownDevice.LastSeenAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errorpkg.ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get known device: %w", err)
+	}
+
+	return knownDevice, nil
+}
+
+// CountByUser implements device.Repository.
+func (d *deviceRepository) CountByUser(ctx context.Context, userId int) (int, error) {
+	var count int
+	err := d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_devices WHERE user_id = ?", userId).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count known devices: %w", err)
+	}
+	return count, nil
+}
+
+// Touch implements device.Repository.
+func (d *deviceRepository) Touch(ctx context.Context, id int) error {
+	if _, err := d.db.ExecContext(ctx, "UPDATE user_devices SET last_seen_at = NOW() WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to update known device: %w", err)
+	}
+	return nil
+}
+
+// DeleteByUser implements device.Repository.
+func (d *deviceRepository) DeleteByUser(ctx context.Context, userId int) error {
+	if _, err := d.db.ExecContext(ctx, "DELETE FROM user_devices WHERE user_id = ?", userId); err != nil {
+		return fmt.Errorf("failed to delete known devices: %w", err)
+	}
+	return nil
+}
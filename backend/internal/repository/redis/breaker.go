@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/imnzr/user-authentication-go/pkg/breaker"
+)
+
+// IsFailure reports whether err means Redis is unhealthy. A missing key or a request the
+// caller gave up on doesn't count against the breaker.
+func IsFailure(err error) bool {
+	return err != nil && !IsNil(err) && !errors.Is(err, context.Canceled)
+}
+
+type breakerClient struct {
+	client  Client
+	breaker *breaker.Breaker
+}
+
+// NewBreakerClient sends every call through b, while it is open calls fail with breaker.ErrOpen
+func NewBreakerClient(client Client, b *breaker.Breaker) Client {
+	return &breakerClient{
+		client:  client,
+		breaker: b,
+	}
+}
+
+func (r *breakerClient) Ping(ctx context.Context) error {
+	return r.breaker.Do(func() error {
+		return r.client.Ping(ctx)
+	})
+}
+
+// Close isn't a call to Redis, it skips the breaker
+func (r *breakerClient) Close() error {
+	return r.client.Close()
+}
+
+func (r *breakerClient) Set(ctx context.Context, key string, value string, ttlSeconds int64) error {
+	return r.breaker.Do(func() error {
+		return r.client.Set(ctx, key, value, ttlSeconds)
+	})
+}
+
+func (r *breakerClient) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := r.breaker.Do(func() error {
+		var err error
+		value, err = r.client.Get(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+func (r *breakerClient) Del(ctx context.Context, key string) error {
+	return r.breaker.Do(func() error {
+		return r.client.Del(ctx, key)
+	})
+}
+
+func (r *breakerClient) Incr(ctx context.Context, key string, ttlSeconds int64) (int64, error) {
+	var count int64
+	err := r.breaker.Do(func() error {
+		var err error
+		count, err = r.client.Incr(ctx, key, ttlSeconds)
+		return err
+	})
+	return count, err
+}
+
+func (r *breakerClient) SetNX(ctx context.Context, key string, value string, ttlSeconds int64) (bool, error) {
+	var set bool
+	err := r.breaker.Do(func() error {
+		var err error
+		set, err = r.client.SetNX(ctx, key, value, ttlSeconds)
+		return err
+	})
+	return set, err
+}
+
+func (r *breakerClient) Expire(ctx context.Context, key string, ttlSeconds int64) (bool, error) {
+	var ok bool
+	err := r.breaker.Do(func() error {
+		var err error
+		ok, err = r.client.Expire(ctx, key, ttlSeconds)
+		return err
+	})
+	return ok, err
+}
+
+func (r *breakerClient) Exists(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := r.breaker.Do(func() error {
+		var err error
+		exists, err = r.client.Exists(ctx, key)
+		return err
+	})
+	return exists, err
+}
+
+func (r *breakerClient) Eval(ctx context.Context, script *Script, keys []string, args ...interface{}) (interface{}, error) {
+	var result interface{}
+	err := r.breaker.Do(func() error {
+		var err error
+		result, err = r.client.Eval(ctx, script, keys, args...)
+		return err
+	})
+	return result, err
+}
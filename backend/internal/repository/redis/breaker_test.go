@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/pkg/breaker"
+)
+
+var errUnreachable = errors.New("dial tcp: connection refused")
+
+// flakyClient fails every Get with err while it is set
+type flakyClient struct {
+	*MemoryClient
+	err error
+}
+
+func (c *flakyClient) Get(ctx context.Context, key string) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	return c.MemoryClient.Get(ctx, key)
+}
+
+func newBreakerClient(t *testing.T) (Client, *flakyClient, *breaker.Breaker) {
+	t.Helper()
+
+	b, err := breaker.New("redis", breaker.Config{Threshold: 2, Cooldown: time.Hour}, IsFailure, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flaky := &flakyClient{MemoryClient: NewMemoryClient()}
+	return NewBreakerClient(flaky, b), flaky, b
+}
+
+func TestIsFailure(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{func() error { _, err := NewMemoryClient().Get(context.Background(), "missing"); return err }(), false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, true},
+		{errUnreachable, true},
+		{breaker.ErrOpen, true},
+	}
+	for _, tc := range cases {
+		if got := IsFailure(tc.err); got != tc.want {
+			t.Fatalf("IsFailure(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestBreakerClientIgnoresMissingKeys(t *testing.T) {
+	client, _, b := newBreakerClient(t)
+
+	for i := 0; i < 5; i++ {
+		if _, err := client.Get(context.Background(), "missing"); !IsNil(err) {
+			t.Fatalf("Get = %v, want a miss", err)
+		}
+	}
+	if state := b.Snapshot().State; state != breaker.StateClosed {
+		t.Fatalf("state = %s after misses, want closed", state)
+	}
+}
+
+func TestBreakerClientOpensWhileRedisIsDown(t *testing.T) {
+	client, flaky, b := newBreakerClient(t)
+	ctx := context.Background()
+	if err := client.Set(ctx, "key", "value", 60); err != nil {
+		t.Fatal(err)
+	}
+
+	flaky.err = errUnreachable
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get(ctx, "key"); !errors.Is(err, errUnreachable) {
+			t.Fatalf("Get = %v, want %v", err, errUnreachable)
+		}
+	}
+
+	// Every call is refused now, not only the failing one, and callers see a Redis failure
+	flaky.err = nil
+	if err := client.Set(ctx, "key", "other", 60); !errors.Is(err, breaker.ErrOpen) || !IsFailure(err) {
+		t.Fatalf("Set with the breaker open = %v, want %v", err, breaker.ErrOpen)
+	}
+	if value, _ := flaky.Get(ctx, "key"); value != "value" {
+		t.Fatalf("stored value = %q, the refused Set reached Redis", value)
+	}
+	// Close doesn't talk to Redis and isn't refused
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+	if state := b.Snapshot().State; state != breaker.StateOpen {
+		t.Fatalf("state = %s, want open", state)
+	}
+}
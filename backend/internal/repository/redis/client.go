@@ -2,32 +2,137 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/imnzr/user-authentication-go/internal/config"
 	goredis "github.com/redis/go-redis/v9"
 )
 
+// RedisClient is the go-redis implementation, against one server, Sentinel or a Cluster
 type RedisClient struct {
-	Client *goredis.Client
+	client goredis.UniversalClient
+
+	scriptsMu sync.Mutex
+	scripts   map[*Script]*goredis.Script
+}
+
+func NewRedisClient(cfg config.RedisConfig) (*RedisClient, error) {
+	client, err := newUniversalClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisClient{
+		client:  client,
+		scripts: make(map[*Script]*goredis.Script),
+	}, nil
 }
 
-func NewRedisClient(addr, pass string, db int) *RedisClient {
-	rdb := goredis.NewClient(&goredis.Options{
-		Addr:     addr,
-		Password: pass,
-		DB:       db,
-	})
-	return &RedisClient{Client: rdb}
+func ttl(ttlSeconds int64) time.Duration {
+	return time.Duration(ttlSeconds) * time.Second
 }
 
 func (r *RedisClient) Ping(ctx context.Context) error {
-	return r.Client.Ping(ctx).Err()
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *RedisClient) Close() error {
+	return r.client.Close()
 }
 
 func (r *RedisClient) Set(ctx context.Context, key string, value string, ttlSeconds int64) error {
-	return r.Client.Set(ctx, key, value, time.Duration(ttlSeconds)*time.Second).Err()
+	return r.client.Set(ctx, key, value, ttl(ttlSeconds)).Err()
 }
 
 func (r *RedisClient) Get(ctx context.Context, key string) (string, error) {
-	return r.Client.Get(ctx, key).Result()
+	return r.client.Get(ctx, key).Result()
+}
+
+func (r *RedisClient) Del(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
+// incrScript sets the TTL in the same step as the first increment, so a crash between
+// the two can't leave a counter that never expires
+var incrScript = goredis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 and tonumber(ARGV[1]) > 0 then
+	redis.call("EXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+func (r *RedisClient) Incr(ctx context.Context, key string, ttlSeconds int64) (int64, error) {
+	return incrScript.Run(ctx, r.client, []string{key}, ttlSeconds).Int64()
+}
+
+func (r *RedisClient) SetNX(ctx context.Context, key string, value string, ttlSeconds int64) (bool, error) {
+	return r.client.SetNX(ctx, key, value, ttl(ttlSeconds)).Result()
+}
+
+func (r *RedisClient) Expire(ctx context.Context, key string, ttlSeconds int64) (bool, error) {
+	return r.client.Expire(ctx, key, ttl(ttlSeconds)).Result()
+}
+
+func (r *RedisClient) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := r.client.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+// Eval runs the Lua version with EVALSHA, loading it on first use
+func (r *RedisClient) Eval(ctx context.Context, script *Script, keys []string, args ...interface{}) (interface{}, error) {
+	r.scriptsMu.Lock()
+	compiled, ok := r.scripts[script]
+	if !ok {
+		compiled = goredis.NewScript(script.lua)
+		r.scripts[script] = compiled
+	}
+	r.scriptsMu.Unlock()
+
+	return compiled.Run(ctx, r.client, keys, args...).Result()
+}
+
+// IsNil reports whether err means the key does not exist
+func IsNil(err error) bool {
+	return errors.Is(err, goredis.Nil)
+}
+
+// New returns the client for the configured driver
+func New(cfg config.RedisConfig) (Client, error) {
+	switch cfg.Driver {
+	case config.RedisDriverRedis:
+		return NewRedisClient(cfg)
+	case config.RedisDriverMemory:
+		return NewMemoryClient(), nil
+	default:
+		return nil, fmt.Errorf("unsupported redis driver %q", cfg.Driver)
+	}
+}
+
+// Connect pings until Redis answers, waiting backoff after the first failure and twice as
+// long after each next one. It returns the last error when every attempt failed.
+func Connect(ctx context.Context, client Client, attempts int, backoff time.Duration) error {
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = client.Ping(ctx); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("redis unreachable after %d attempts: %w", attempts, err)
 }
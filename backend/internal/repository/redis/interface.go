@@ -1,9 +1,48 @@
 package redis
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
+// Client is the key-value port every Redis backed feature goes through. TTLs are in seconds,
+// 0 means the key doesn't expire. Get returns an error matching IsNil for a missing key.
 type Client interface {
 	Ping(ctx context.Context) error
+	Close() error
 	Set(ctx context.Context, key string, value string, ttlSeconds int64) error
 	Get(ctx context.Context, key string) (string, error)
+	Del(ctx context.Context, key string) error
+
+	// Incr adds one to the counter at key, the TTL is set when the counter is created
+	Incr(ctx context.Context, key string, ttlSeconds int64) (int64, error)
+	// SetNX sets key only if it doesn't exist and reports whether it did
+	SetNX(ctx context.Context, key string, value string, ttlSeconds int64) (bool, error)
+	// Expire reports false when the key doesn't exist
+	Expire(ctx context.Context, key string, ttlSeconds int64) (bool, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	// Eval runs a script atomically. Integer results come back as int64, arrays as []interface{}.
+	Eval(ctx context.Context, script *Script, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// ScriptStore is what a script's Go version can use, it runs while the store is locked
+type ScriptStore interface {
+	Get(key string) (string, bool)
+	// ttl 0 keeps the key forever
+	Set(key string, value string, ttl time.Duration)
+	Del(key string)
+	Now() time.Time
+}
+
+// LocalScript is the Go equivalent of a Lua script for clients that can't run Lua
+type LocalScript func(store ScriptStore, keys []string, args []interface{}) (interface{}, error)
+
+// Script is a Lua script with a Go version of the same logic
+type Script struct {
+	lua   string
+	local LocalScript
+}
+
+func NewScript(lua string, local LocalScript) *Script {
+	return &Script{lua: lua, local: local}
 }
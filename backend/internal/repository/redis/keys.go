@@ -0,0 +1,43 @@
+package redis
+
+import "fmt"
+
+// ForgotPasswordKey holds the password reset code sent to an email, by its blind index
+func ForgotPasswordKey(emailIndex string) string {
+	return "forgot_password:" + emailIndex
+}
+
+// TokenEpochKey caches the current token epoch of a user
+func TokenEpochKey(userId int) string {
+	return fmt.Sprintf("token_epoch:%d", userId)
+}
+
+// SessionRevokedKey marks a session whose tokens must no longer be accepted
+func SessionRevokedKey(sessionId string) string {
+	return "session_revoked:" + sessionId
+}
+
+// SessionTouchedKey marks a session whose last_seen_at was written recently
+func SessionTouchedKey(sessionId string) string {
+	return "session_touched:" + sessionId
+}
+
+// LoginFailuresKey counts failed sign-ins for an email that has no account, by its blind index
+func LoginFailuresKey(emailIndex string) string {
+	return "login_failures:" + emailIndex
+}
+
+// LoginLockedUntilKey holds when sign-in for an email that has no account may be tried again
+func LoginLockedUntilKey(emailIndex string) string {
+	return "login_locked_until:" + emailIndex
+}
+
+// UsedActionTokenKey marks a single use token from an email link that was already used
+func UsedActionTokenKey(tokenId string) string {
+	return "action_token_used:" + tokenId
+}
+
+// RevokedTokenKey marks a token that must no longer be accepted, see revocation.TokenId
+func RevokedTokenKey(tokenId string) string {
+	return "token_revoked:" + tokenId
+}
@@ -0,0 +1,205 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// How often expired keys nobody reads again are swept
+const memorySweepInterval = time.Minute
+
+var (
+	ErrNotInteger    = errors.New("value is not an integer")
+	ErrNoLocalScript = errors.New("script has no local version")
+)
+
+type memoryEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// MemoryClient keeps keys in process with the same semantics as Redis, for running without a
+// Redis server in development and tests. State isn't shared between instances.
+type MemoryClient struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		entries:   make(map[string]memoryEntry),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (m *MemoryClient) expiry(ttlSeconds int64) time.Time {
+	if ttlSeconds <= 0 {
+		return time.Time{}
+	}
+	return m.now().Add(ttl(ttlSeconds))
+}
+
+// lookup must be called with mu held, it drops the key when it has expired
+func (m *MemoryClient) lookup(key string) (memoryEntry, bool) {
+	entry, ok := m.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	if !entry.expiresAt.IsZero() && !m.now().Before(entry.expiresAt) {
+		delete(m.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+// store must be called with mu held
+func (m *MemoryClient) store(key string, entry memoryEntry) {
+	m.entries[key] = entry
+
+	if now := m.now(); now.Sub(m.lastSweep) >= memorySweepInterval {
+		m.lastSweep = now
+		for k, e := range m.entries {
+			if !e.expiresAt.IsZero() && !now.Before(e.expiresAt) {
+				delete(m.entries, k)
+			}
+		}
+	}
+}
+
+func (m *MemoryClient) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (m *MemoryClient) Close() error {
+	return nil
+}
+
+func (m *MemoryClient) Set(ctx context.Context, key string, value string, ttlSeconds int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.store(key, memoryEntry{value: value, expiresAt: m.expiry(ttlSeconds)})
+	return nil
+}
+
+func (m *MemoryClient) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.lookup(key)
+	if !ok {
+		return "", goredis.Nil
+	}
+	return entry.value, nil
+}
+
+func (m *MemoryClient) Del(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *MemoryClient) Incr(ctx context.Context, key string, ttlSeconds int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.lookup(key)
+	if !ok {
+		m.store(key, memoryEntry{value: "1", expiresAt: m.expiry(ttlSeconds)})
+		return 1, nil
+	}
+
+	count, err := strconv.ParseInt(entry.value, 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+	count++
+	entry.value = strconv.FormatInt(count, 10)
+	m.store(key, entry)
+	return count, nil
+}
+
+func (m *MemoryClient) SetNX(ctx context.Context, key string, value string, ttlSeconds int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.lookup(key); ok {
+		return false, nil
+	}
+	m.store(key, memoryEntry{value: value, expiresAt: m.expiry(ttlSeconds)})
+	return true, nil
+}
+
+func (m *MemoryClient) Expire(ctx context.Context, key string, ttlSeconds int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.lookup(key)
+	if !ok {
+		return false, nil
+	}
+	// Like Redis, a TTL that isn't positive deletes the key
+	if ttlSeconds <= 0 {
+		delete(m.entries, key)
+		return true, nil
+	}
+	entry.expiresAt = m.expiry(ttlSeconds)
+	m.store(key, entry)
+	return true, nil
+}
+
+func (m *MemoryClient) Exists(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.lookup(key)
+	return ok, nil
+}
+
+// Eval runs the script's Go version with the store locked, so it is atomic like EVAL
+func (m *MemoryClient) Eval(ctx context.Context, script *Script, keys []string, args ...interface{}) (interface{}, error) {
+	if script.local == nil {
+		return nil, ErrNoLocalScript
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return script.local(memoryScriptStore{m}, keys, args)
+}
+
+// memoryScriptStore exposes the store to a script, the caller already holds mu
+type memoryScriptStore struct {
+	m *MemoryClient
+}
+
+func (s memoryScriptStore) Get(key string) (string, bool) {
+	entry, ok := s.m.lookup(key)
+	return entry.value, ok
+}
+
+func (s memoryScriptStore) Set(key string, value string, ttl time.Duration) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = s.m.now().Add(ttl)
+	}
+	s.m.store(key, memoryEntry{value: value, expiresAt: expiresAt})
+}
+
+func (s memoryScriptStore) Del(key string) {
+	delete(s.m.entries, key)
+}
+
+func (s memoryScriptStore) Now() time.Time {
+	return s.m.now()
+}
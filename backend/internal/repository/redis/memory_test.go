@@ -0,0 +1,205 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newClockedClient returns a memory client whose time only moves when the test advances it
+func newClockedClient() (*MemoryClient, func(d time.Duration)) {
+	m := NewMemoryClient()
+	now := time.Now()
+	var mu sync.Mutex
+	m.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	return m, func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+}
+
+func assertMissing(t *testing.T, m *MemoryClient, key string) {
+	t.Helper()
+
+	if _, err := m.Get(context.Background(), key); !IsNil(err) {
+		t.Fatalf("Get(%s) = %v, want a miss", key, err)
+	}
+	if exists, _ := m.Exists(context.Background(), key); exists {
+		t.Fatalf("Exists(%s) = true", key)
+	}
+}
+
+func TestMemoryClientSetGetDel(t *testing.T) {
+	m, advance := newClockedClient()
+	ctx := context.Background()
+
+	assertMissing(t, m, "k")
+	m.Set(ctx, "k", "v", 10)
+	if value, err := m.Get(ctx, "k"); err != nil || value != "v" {
+		t.Fatalf("Get = %q, %v", value, err)
+	}
+
+	// Keys expire like in Redis, the last second included
+	advance(9 * time.Second)
+	if exists, _ := m.Exists(ctx, "k"); !exists {
+		t.Fatal("key expired early")
+	}
+	advance(time.Second)
+	assertMissing(t, m, "k")
+
+	// No TTL keeps the key
+	m.Set(ctx, "forever", "v", 0)
+	advance(24 * time.Hour)
+	if exists, _ := m.Exists(ctx, "forever"); !exists {
+		t.Fatal("a key without TTL expired")
+	}
+	m.Del(ctx, "forever")
+	assertMissing(t, m, "forever")
+	if err := m.Del(ctx, "forever"); err != nil {
+		t.Fatalf("Del of a missing key = %v", err)
+	}
+}
+
+func TestMemoryClientIncr(t *testing.T) {
+	m, advance := newClockedClient()
+	ctx := context.Background()
+
+	for want := int64(1); want <= 3; want++ {
+		if n, err := m.Incr(ctx, "count", 10); err != nil || n != want {
+			t.Fatalf("Incr = %d, %v, want %d", n, err, want)
+		}
+		advance(4 * time.Second)
+	}
+	// The TTL is set by the first increment only, like the Lua script does it
+	assertMissing(t, m, "count")
+
+	m.Set(ctx, "text", "abc", 0)
+	if _, err := m.Incr(ctx, "text", 10); !errors.Is(err, ErrNotInteger) {
+		t.Fatalf("Incr of text = %v, want %v", err, ErrNotInteger)
+	}
+}
+
+func TestMemoryClientIncrIsAtomic(t *testing.T) {
+	m := NewMemoryClient()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Incr(context.Background(), "count", 60)
+		}()
+	}
+	wg.Wait()
+
+	if value, _ := m.Get(context.Background(), "count"); value != "50" {
+		t.Fatalf("count = %s, want 50", value)
+	}
+}
+
+func TestMemoryClientSetNX(t *testing.T) {
+	m, advance := newClockedClient()
+	ctx := context.Background()
+
+	if set, _ := m.SetNX(ctx, "lock", "a", 5); !set {
+		t.Fatal("SetNX of a new key = false")
+	}
+	if set, _ := m.SetNX(ctx, "lock", "b", 5); set {
+		t.Fatal("SetNX replaced an existing key")
+	}
+	if value, _ := m.Get(ctx, "lock"); value != "a" {
+		t.Fatalf("value = %q, want a", value)
+	}
+
+	advance(5 * time.Second)
+	if set, _ := m.SetNX(ctx, "lock", "c", 5); !set {
+		t.Fatal("SetNX over an expired key = false")
+	}
+}
+
+func TestMemoryClientExpire(t *testing.T) {
+	m, advance := newClockedClient()
+	ctx := context.Background()
+
+	if ok, _ := m.Expire(ctx, "missing", 5); ok {
+		t.Fatal("Expire of a missing key = true")
+	}
+
+	m.Set(ctx, "k", "v", 0)
+	if ok, _ := m.Expire(ctx, "k", 5); !ok {
+		t.Fatal("Expire = false")
+	}
+	advance(5 * time.Second)
+	assertMissing(t, m, "k")
+
+	m.Set(ctx, "k", "v", 0)
+	if ok, _ := m.Expire(ctx, "k", 0); !ok {
+		t.Fatal("Expire with no TTL = false")
+	}
+	assertMissing(t, m, "k")
+}
+
+func TestMemoryClientSweepsExpiredKeys(t *testing.T) {
+	m, advance := newClockedClient()
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		m.Set(ctx, "old:"+strconv.Itoa(i), "v", 1)
+	}
+	advance(memorySweepInterval)
+	// Writing anything drops keys that expired without being read again
+	m.Set(ctx, "new", "v", 0)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.entries) != 1 {
+		t.Fatalf("%d entries after the sweep, want 1", len(m.entries))
+	}
+}
+
+func TestMemoryClientEval(t *testing.T) {
+	m, _ := newClockedClient()
+	ctx := context.Background()
+
+	// Swaps the value of a key for the argument and returns the old one
+	swap := NewScript(`local old = redis.call("GET", KEYS[1]) redis.call("SET", KEYS[1], ARGV[1]) return old`,
+		func(store ScriptStore, keys []string, args []interface{}) (interface{}, error) {
+			old, _ := store.Get(keys[0])
+			store.Set(keys[0], args[0].(string), time.Second)
+			return old, nil
+		})
+
+	m.Set(ctx, "k", "before", 0)
+	old, err := m.Eval(ctx, swap, []string{"k"}, "after")
+	if err != nil || old != "before" {
+		t.Fatalf("Eval = %v, %v", old, err)
+	}
+	if value, _ := m.Get(ctx, "k"); value != "after" {
+		t.Fatalf("value = %q, want after", value)
+	}
+
+	if _, err := m.Eval(ctx, NewScript("return 1", nil), nil); !errors.Is(err, ErrNoLocalScript) {
+		t.Fatalf("Eval of a Lua only script = %v, want %v", err, ErrNoLocalScript)
+	}
+}
+
+func TestMemoryClientPing(t *testing.T) {
+	m := NewMemoryClient()
+	if err := m.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Ping(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Ping with a cancelled context = %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// newUniversalClient connects to a single server, a Sentinel managed master or a Cluster.
+// A URL sets where and how to connect, pool and timeout settings always come from cfg.
+func newUniversalClient(cfg config.RedisConfig) (goredis.UniversalClient, error) {
+	opts, err := universalOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.PoolSize = cfg.PoolSize
+	opts.MinIdleConns = cfg.MinIdleConns
+	opts.PoolTimeout = cfg.PoolTimeout
+	opts.DialTimeout = cfg.DialTimeout
+	opts.ReadTimeout = cfg.ReadTimeout
+	opts.WriteTimeout = cfg.WriteTimeout
+	opts.MaxRetries = cfg.MaxRetries
+
+	if opts.TLSConfig, err = tlsConfig(cfg, opts.TLSConfig); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Mode {
+	case config.RedisModeSentinel:
+		if opts.MasterName == "" {
+			return nil, errors.New("redis sentinel mode needs REDIS_SENTINEL_MASTER or master_name in REDIS_URL")
+		}
+		return goredis.NewFailoverClient(opts.Failover()), nil
+	case config.RedisModeCluster:
+		return goredis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return goredis.NewClient(opts.Simple()), nil
+	}
+}
+
+func universalOptions(cfg config.RedisConfig) (*goredis.UniversalOptions, error) {
+	url := cfg.URL.Value()
+	if url == "" {
+		return &goredis.UniversalOptions{
+			Addrs:            cfg.Addrs,
+			Username:         cfg.Username,
+			Password:         cfg.Password.Value(),
+			DB:               cfg.DB,
+			MasterName:       cfg.SentinelMaster,
+			SentinelPassword: cfg.SentinelPassword.Value(),
+		}, nil
+	}
+
+	// Parse errors can echo the URL, which may hold a password, so they aren't wrapped
+	switch cfg.Mode {
+	case config.RedisModeSentinel:
+		parsed, err := goredis.ParseFailoverURL(url)
+		if err != nil {
+			return nil, errors.New("invalid REDIS_URL for sentinel mode")
+		}
+		masterName := parsed.MasterName
+		if masterName == "" {
+			masterName = cfg.SentinelMaster
+		}
+		return &goredis.UniversalOptions{
+			Addrs:            parsed.SentinelAddrs,
+			Username:         parsed.Username,
+			Password:         parsed.Password,
+			DB:               parsed.DB,
+			MasterName:       masterName,
+			SentinelUsername: parsed.SentinelUsername,
+			SentinelPassword: parsed.SentinelPassword,
+			TLSConfig:        parsed.TLSConfig,
+		}, nil
+
+	case config.RedisModeCluster:
+		parsed, err := goredis.ParseClusterURL(url)
+		if err != nil {
+			return nil, errors.New("invalid REDIS_URL for cluster mode")
+		}
+		return &goredis.UniversalOptions{
+			Addrs:     parsed.Addrs,
+			Username:  parsed.Username,
+			Password:  parsed.Password,
+			TLSConfig: parsed.TLSConfig,
+		}, nil
+
+	default:
+		parsed, err := goredis.ParseURL(url)
+		if err != nil {
+			return nil, errors.New("invalid REDIS_URL")
+		}
+		return &goredis.UniversalOptions{
+			Addrs:     []string{parsed.Addr},
+			Username:  parsed.Username,
+			Password:  parsed.Password,
+			DB:        parsed.DB,
+			TLSConfig: parsed.TLSConfig,
+		}, nil
+	}
+}
+
+// tlsConfig turns TLS on for REDIS_TLS and applies the CA and verification settings to it,
+// or to the config a rediss:// URL already asked for
+func tlsConfig(cfg config.RedisConfig, fromURL *tls.Config) (*tls.Config, error) {
+	tlsCfg := fromURL
+	if tlsCfg == nil {
+		if !cfg.TLS {
+			return nil, nil
+		}
+		tlsCfg = &tls.Config{}
+	}
+	tlsCfg.MinVersion = tls.VersionTLS12
+	tlsCfg.InsecureSkipVerify = cfg.TLSInsecureSkipVerify
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in redis CA file")
+		}
+		tlsCfg.RootCAs = pool
+	}
+	return tlsCfg, nil
+}
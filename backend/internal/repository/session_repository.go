@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/domain/session"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+)
+
+type sessionRepository struct {
+	db database.Querier
+}
+
+func NewSessionRepository(db *database.DB) session.Repository {
+	return &sessionRepository{
+		db: database.Bind(db.Dialect, db.Primary),
+	}
+}
+
+// Create implements session.Repository.
+func (s *sessionRepository) Create(ctx context.Context, sess *session.Session) error {
+	query := `
+		INSERT INTO user_sessions(id, user_id, ip_address, user_agent, created_at, last_seen_at)
+		VALUES (?,?,?,?,NOW(),NOW())
+	`
+	if _, err := s.db.ExecContext(ctx, query, sess.Id, sess.UserId, sess.IPAddress, sess.UserAgent); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// ListActiveByUser implements session.Repository.
+func (s *sessionRepository) ListActiveByUser(ctx context.Context, userId int) ([]*session.Session, error) {
+	query := `
+		SELECT id, user_id, ip_address, user_agent, created_at, last_seen_at
+		FROM user_sessions WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY last_seen_at DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*session.Session
+	for rows.Next() {
+		sess := &session.Session{}
+		if err := rows.Scan(
+			&sess.Id, &sess.UserId, &sess.IPAddress, &sess.UserAgent, &sess.CreatedAt, &sess.LastSeenAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, sess)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Touch implements session.Repository.
+// last_seen_at is only written once per session.TouchInterval to keep the write load down.
+func (s *sessionRepository) Touch(ctx context.Context, id string) error {
+	query := `
+		UPDATE user_sessions SET last_seen_at = NOW()
+		WHERE id = ? AND last_seen_at < ?
+	`
+	if _, err := s.db.ExecContext(ctx, query, id, time.Now().UTC().Add(-session.TouchInterval)); err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+	return nil
+}
+
+// Revoke implements session.Repository.
+func (s *sessionRepository) Revoke(ctx context.Context, userId int, id string) error {
+	query := "UPDATE user_sessions SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL"
+	res, err := s.db.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errorpkg.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeAll implements session.Repository.
+func (s *sessionRepository) RevokeAll(ctx context.Context, userId int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM user_sessions WHERE user_id = ? AND revoked_at IS NULL", userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userId); err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return ids, nil
+}
@@ -3,58 +3,173 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/imnzr/user-authentication-go/internal/database"
 	"github.com/imnzr/user-authentication-go/internal/domain/user"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/pkg/pii"
 )
 
 type userRepository struct {
-	db *sql.DB
+	db      *database.DB
+	keyring *pii.Keyring
 }
 
-func NewUserRepository(db *sql.DB) user.Repository {
+// NewUserRepository reads users by id and email from replicas when there are any,
+// everything else goes to the primary
+func NewUserRepository(db *database.DB, keyring *pii.Keyring) user.Repository {
 	return &userRepository{
-		db: db,
+		db:      db,
+		keyring: keyring,
 	}
 }
 
-// Helper to extract transaction from context
-func getTxFromContext(ctx context.Context) (*sql.Tx, bool) {
-	tx, ok := ctx.Value("db_tx").(*sql.Tx)
-	return tx, ok
+// Encrypted columns, the field name is bound to each ciphertext
+const (
+	fieldUsername = "users.username"
+	fieldEmail    = "users.email"
+)
+
+// userColumns are read by scanUser. The plaintext username and email are only set on rows
+// the re-encryption job hasn't reached yet.
+const userColumns = `id, username, email, username_encrypted, email_encrypted, pii_data_key, pii_key_id,
+	password, COALESCE(status, 'pending'), role, password_reset_required, token_epoch, failed_login_attempts, locked_until`
+
+// emailMatch finds a user by blind index, or by plaintext email on rows not yet encrypted.
+// It takes the arguments from emailArgs.
+const emailMatch = "(email_bidx = ? OR (email_bidx IS NULL AND email = ?))"
+
+// EmailIndex implements user.Repository.
+func (u *userRepository) EmailIndex(email string) string {
+	return u.keyring.BlindIndex(email)
+}
+
+func (u *userRepository) emailArgs(email string) []interface{} {
+	return []interface{}{u.keyring.BlindIndex(email), email}
+}
+
+// queryRow runs on the transaction in the context when there is one, or on a replica
+func (u *userRepository) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query = u.db.Dialect.Rebind(query)
+	if tx, ok := database.TxFromContext(ctx); ok {
+		return tx.QueryRowContext(ctx, query, args...)
+	}
+	return u.db.Reader(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// writer is the transaction in the context, or the primary
+func (u *userRepository) writer(ctx context.Context) database.Querier {
+	if tx, ok := database.TxFromContext(ctx); ok {
+		return tx
+	}
+	return u.db.Writer(ctx)
+}
+
+func (u *userRepository) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return u.writer(ctx).ExecContext(ctx, u.db.Dialect.Rebind(query), args...)
+}
+
+// translateError turns driver errors into the domain errors callers branch on. Other errors
+// are returned as they are.
+func (u *userRepository) translateError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errorpkg.ErrUserNotFound
+	}
+	// Usernames are encrypted with a random data key per row, only the email is unique
+	if key, ok := u.db.Dialect.UniqueViolation(err); ok && strings.Contains(key, "email") {
+		return errorpkg.ErrEmailTaken
+	}
+	return err
+}
+
+func (u *userRepository) scanUser(row rowScanner) (*user.User, error) {
+	user := &user.User{}
+	var (
+		username, email                   sql.NullString
+		usernameEncrypted, emailEncrypted sql.NullString
+		dataKey, keyId                    sql.NullString
+	)
+
+	if err := row.Scan(
+		&user.Id, &username, &email, &usernameEncrypted, &emailEncrypted, &dataKey, &keyId,
+		&user.Password, &user.Status, &user.Role, &user.PasswordResetRequired, &user.TokenEpoch, &user.FailedLoginAttempts, &user.LockedUntil,
+	); err != nil {
+		return nil, err
+	}
+
+	if !dataKey.Valid {
+		user.Username, user.Email = username.String, email.String
+		return user, nil
+	}
+
+	key, err := u.keyring.OpenDataKey(keyId.String, dataKey.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data key of user %d: %w", user.Id, err)
+	}
+	if user.Username, err = key.Decrypt(fieldUsername, usernameEncrypted.String); err != nil {
+		return nil, fmt.Errorf("failed to decrypt username of user %d: %w", user.Id, err)
+	}
+	if user.Email, err = key.Decrypt(fieldEmail, emailEncrypted.String); err != nil {
+		return nil, fmt.Errorf("failed to decrypt email of user %d: %w", user.Id, err)
+	}
+	return user, nil
+}
+
+// encryptedPII is what gets stored for a user's username and email
+type encryptedPII struct {
+	username  string
+	email     string
+	emailBidx string
+	dataKey   string
+	keyId     string
+}
+
+func (u *userRepository) encryptPII(username string, email string) (*encryptedPII, error) {
+	key, err := u.keyring.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	encrypted := &encryptedPII{
+		emailBidx: u.keyring.BlindIndex(email),
+		dataKey:   key.Wrapped,
+		keyId:     key.KeyId,
+	}
+	if encrypted.username, err = key.Encrypt(fieldUsername, username); err != nil {
+		return nil, fmt.Errorf("failed to encrypt username: %w", err)
+	}
+	if encrypted.email, err = key.Encrypt(fieldEmail, email); err != nil {
+		return nil, fmt.Errorf("failed to encrypt email: %w", err)
+	}
+	return encrypted, nil
 }
 
 // Create implements user.Repository.
 func (u *userRepository) Create(ctx context.Context, user *user.User) error {
 	query := `
-		INSERT INTO users(username, email, password, created_at, updated_at)
-		VALUES (?,?,?,NOW(),NOW())
+		INSERT INTO users(username_encrypted, email_encrypted, email_bidx, pii_data_key, pii_key_id, password, created_at, updated_at)
+		VALUES (?,?,?,?,?,?,NOW(),NOW())
 	`
-	var result sql.Result
-	var err error
-
-	// Transaction on context ? using this
-	if tx, ok := getTxFromContext(ctx); ok {
-		result, err = tx.ExecContext(ctx, query,
-			user.Username,
-			user.Email,
-			user.Password,
-		)
-		// If don't have transaction on context
-	} else {
-		result, err = u.db.ExecContext(ctx, query,
-			user.Username,
-			user.Email,
-			user.Password,
-		)
-	}
+	encrypted, err := u.encryptPII(user.Username, user.Email)
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
+	args := []interface{}{
+		encrypted.username,
+		encrypted.email,
+		encrypted.emailBidx,
+		encrypted.dataKey,
+		encrypted.keyId,
+		user.Password,
+	}
 
-	id, err := result.LastInsertId()
+	// Runs on the transaction in the context when there is one
+	id, err := u.db.Dialect.InsertId(ctx, u.writer(ctx), u.db.Dialect.Rebind(query), args...)
 	if err != nil {
-		return fmt.Errorf("failed to get last insert ID: %w", err)
+		return fmt.Errorf("failed to create user: %w", u.translateError(err))
 	}
 	user.Id = int(id)
 	return nil
@@ -63,27 +178,11 @@ func (u *userRepository) Create(ctx context.Context, user *user.User) error {
 
 // GetByEmail implements user.Repository.
 func (u *userRepository) GetByEmail(ctx context.Context, email string) (*user.User, error) {
-	query := `
-		SELECT id, username, email, password FROM users WHERE email = ?
-	`
-	user := &user.User{}
-	var err error
-
-	if tx, ok := getTxFromContext(ctx); ok {
-		err = tx.QueryRowContext(ctx, query, email).Scan(
-			&user.Id, &user.Username, &user.Email, &user.Password,
-		)
-	} else {
-		err = u.db.QueryRowContext(ctx, query, email).Scan(
-			&user.Id, &user.Username, &user.Email, &user.Password,
-		)
-	}
+	query := "SELECT " + userColumns + " FROM users WHERE " + emailMatch
 
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found: %w", err)
-	}
+	user, err := u.scanUser(u.queryRow(ctx, query, u.emailArgs(email)...))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by email: %w", err)
+		return nil, fmt.Errorf("failed to get user by email: %w", u.translateError(err))
 	}
 
 	return user, nil
@@ -91,28 +190,11 @@ func (u *userRepository) GetByEmail(ctx context.Context, email string) (*user.Us
 
 // GetById implements user.Repository.
 func (u *userRepository) GetById(ctx context.Context, userId int) (*user.User, error) {
-	query := `
-		SELECT id, username, email, password FROM users WHERE id = ?
-	`
+	query := "SELECT " + userColumns + " FROM users WHERE id = ?"
 
-	user := &user.User{}
-	var err error
-
-	if tx, ok := getTxFromContext(ctx); ok {
-		err = tx.QueryRowContext(ctx, query, userId).Scan(
-			&user.Id, &user.Username, &user.Email, &user.Password,
-		)
-	} else {
-		err = u.db.QueryRowContext(ctx, query, userId).Scan(
-			&user.Id, &user.Username, &user.Email, &user.Password,
-		)
-	}
-
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
-	}
+	user, err := u.scanUser(u.queryRow(ctx, query, userId))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by id: %w", err)
+		return nil, fmt.Errorf("failed to get user by id: %w", u.translateError(err))
 	}
 
 	return user, nil
@@ -120,8 +202,8 @@ func (u *userRepository) GetById(ctx context.Context, userId int) (*user.User, e
 
 // ActivateByEmail implements user.Repository.
 func (u *userRepository) ActivateByEmail(ctx context.Context, email string) error {
-	query := "UPDATE users SET status='active' WHERE email=?"
-	res, err := u.db.ExecContext(ctx, query, email)
+	query := "UPDATE users SET status='active' WHERE " + emailMatch
+	res, err := u.exec(ctx, query, u.emailArgs(email)...)
 	if err != nil {
 		return err
 	}
@@ -131,16 +213,19 @@ func (u *userRepository) ActivateByEmail(ctx context.Context, email string) erro
 		return err
 	}
 	if rows == 0 {
-		return fmt.Errorf("no user found or already exist")
+		return errorpkg.ErrUserNotFound
 	}
 
 	return nil
 }
 
 // ResetPassword implements user.Repository.
-func (u *userRepository) ResetPassword(ctx context.Context, email string) error {
-	query := "UPDATE users SET password = ? WHERE email = ?"
-	res, err := u.db.ExecContext(ctx, query, email)
+func (u *userRepository) ResetPassword(ctx context.Context, email string, hashedPassword string) error {
+	query := `
+		UPDATE users SET password = ?, password_reset_required = FALSE,
+			failed_login_attempts = 0, locked_until = NULL
+		WHERE ` + emailMatch
+	res, err := u.exec(ctx, query, append([]interface{}{hashedPassword}, u.emailArgs(email)...)...)
 	if err != nil {
 		return err
 	}
@@ -150,8 +235,169 @@ func (u *userRepository) ResetPassword(ctx context.Context, email string) error
 		return err
 	}
 	if rows == 0 {
-		return fmt.Errorf("no user found or already exist")
+		return errorpkg.ErrUserNotFound
 	}
 
 	return nil
 }
+
+// UpdatePassword implements user.Repository.
+func (u *userRepository) UpdatePassword(ctx context.Context, userId int, hashedPassword string) error {
+	query := "UPDATE users SET password = ? WHERE id = ?"
+	if _, err := u.exec(ctx, query, hashedPassword, userId); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+// RequirePasswordReset implements user.Repository.
+func (u *userRepository) RequirePasswordReset(ctx context.Context, userId int) error {
+	query := "UPDATE users SET password_reset_required = TRUE WHERE id = ?"
+	if _, err := u.exec(ctx, query, userId); err != nil {
+		return fmt.Errorf("failed to require password reset: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateStatus implements user.Repository.
+func (u *userRepository) UpdateStatus(ctx context.Context, userId int, status string) error {
+	if _, err := u.exec(ctx, "UPDATE users SET status = ? WHERE id = ?", status, userId); err != nil {
+		return fmt.Errorf("failed to update user status: %w", err)
+	}
+	return nil
+}
+
+// GetTokenEpoch implements user.Repository.
+func (u *userRepository) GetTokenEpoch(ctx context.Context, userId int) (int, error) {
+	var epoch int
+	// Read from the primary, a lagging replica would still accept tokens revoked by a bump
+	err := u.db.Primary.QueryRowContext(ctx, u.db.Dialect.Rebind("SELECT token_epoch FROM users WHERE id = ?"), userId).Scan(&epoch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get token epoch: %w", u.translateError(err))
+	}
+	return epoch, nil
+}
+
+// IncrementTokenEpoch implements user.Repository.
+func (u *userRepository) IncrementTokenEpoch(ctx context.Context, userId int) (int, error) {
+	if _, err := u.exec(ctx, "UPDATE users SET token_epoch = token_epoch + 1 WHERE id = ?", userId); err != nil {
+		return 0, fmt.Errorf("failed to increment token epoch: %w", err)
+	}
+	return u.GetTokenEpoch(ctx, userId)
+}
+
+// IncrementFailedLogins implements user.Repository.
+func (u *userRepository) IncrementFailedLogins(ctx context.Context, userId int) (int, error) {
+	if _, err := u.exec(ctx, "UPDATE users SET failed_login_attempts = failed_login_attempts + 1 WHERE id = ?", userId); err != nil {
+		return 0, fmt.Errorf("failed to increment failed logins: %w", err)
+	}
+
+	var attempts int
+	if err := u.db.Primary.QueryRowContext(ctx, u.db.Dialect.Rebind("SELECT failed_login_attempts FROM users WHERE id = ?"), userId).Scan(&attempts); err != nil {
+		return 0, fmt.Errorf("failed to get failed logins: %w", err)
+	}
+	return attempts, nil
+}
+
+// SetLockedUntil implements user.Repository.
+func (u *userRepository) SetLockedUntil(ctx context.Context, userId int, until time.Time, resetAttempts bool) error {
+	query := "UPDATE users SET locked_until = ? WHERE id = ?"
+	if resetAttempts {
+		query = "UPDATE users SET locked_until = ?, failed_login_attempts = 0 WHERE id = ?"
+	}
+	if _, err := u.exec(ctx, query, until.UTC(), userId); err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+	return nil
+}
+
+// ClearLockout implements user.Repository.
+func (u *userRepository) ClearLockout(ctx context.Context, userId int) error {
+	query := "UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = ?"
+	if _, err := u.exec(ctx, query, userId); err != nil {
+		return fmt.Errorf("failed to clear lockout: %w", err)
+	}
+	return nil
+}
+
+// ListStalePII implements user.Repository.
+func (u *userRepository) ListStalePII(ctx context.Context, afterId int, limit int) ([]int, error) {
+	query := `
+		SELECT id FROM users
+		WHERE id > ? AND (pii_data_key IS NULL OR pii_key_id <> ?)
+		ORDER BY id LIMIT ?
+	`
+	rows, err := u.db.Primary.QueryContext(ctx, u.db.Dialect.Rebind(query), afterId, u.keyring.ActiveKeyId(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users to re-encrypt: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ReencryptPII implements user.Repository.
+func (u *userRepository) ReencryptPII(ctx context.Context, userId int) (bool, error) {
+	tx, err := u.db.Writer(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin re-encryption: %w", err)
+	}
+	defer tx.Rollback()
+
+	var username, email, dataKey, keyId sql.NullString
+	err = tx.QueryRowContext(ctx, u.db.Dialect.Rebind(u.db.Dialect.ForUpdate("SELECT username, email, pii_data_key, pii_key_id FROM users WHERE id = ?")), userId).Scan(
+		&username, &email, &dataKey, &keyId,
+	)
+	if err == sql.ErrNoRows {
+		return false, errorpkg.ErrUserNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	switch {
+	case !dataKey.Valid:
+		// Plaintext row from before encryption, the plaintext is cleared in the same update
+		encrypted, err := u.encryptPII(username.String, email.String)
+		if err != nil {
+			return false, err
+		}
+		query := `
+			UPDATE users SET username_encrypted = ?, email_encrypted = ?, email_bidx = ?,
+				pii_data_key = ?, pii_key_id = ?, username = NULL, email = NULL
+			WHERE id = ?
+		`
+		if _, err := tx.ExecContext(ctx, u.db.Dialect.Rebind(query),
+			encrypted.username, encrypted.email, encrypted.emailBidx, encrypted.dataKey, encrypted.keyId, userId,
+		); err != nil {
+			return false, fmt.Errorf("failed to encrypt user: %w", err)
+		}
+
+	case keyId.String != u.keyring.ActiveKeyId():
+		// Master key rotated, only the data key is wrapped again
+		key, err := u.keyring.Rewrap(keyId.String, dataKey.String)
+		if err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx, u.db.Dialect.Rebind("UPDATE users SET pii_data_key = ?, pii_key_id = ? WHERE id = ?"), key.Wrapped, key.KeyId, userId); err != nil {
+			return false, fmt.Errorf("failed to rewrap data key: %w", err)
+		}
+
+	default:
+		return false, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit re-encryption: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,177 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/domain/user"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/internal/repository"
+	"github.com/imnzr/user-authentication-go/internal/testutil"
+)
+
+func newUserRepository(t *testing.T) (user.Repository, *database.DB) {
+	t.Helper()
+
+	db := testutil.NewDB(t)
+	return repository.NewUserRepository(db, testutil.NewKeyring(t)), db
+}
+
+func createUser(t *testing.T, ctx context.Context, repo user.Repository, username string, email string) *user.User {
+	t.Helper()
+
+	u := &user.User{Username: username, Email: email, Password: "hash"}
+	if err := repo.Create(ctx, u); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return u
+}
+
+// storedPII is what the users table holds for the PII columns
+type storedPII struct {
+	username, email                   sql.NullString
+	usernameEncrypted, emailEncrypted sql.NullString
+	emailBidx                         sql.NullString
+}
+
+func readStoredPII(t *testing.T, db *database.DB, userId int) storedPII {
+	t.Helper()
+
+	var s storedPII
+	err := db.Primary.QueryRow(
+		"SELECT username, email, username_encrypted, email_encrypted, email_bidx FROM users WHERE id = ?", userId,
+	).Scan(&s.username, &s.email, &s.usernameEncrypted, &s.emailEncrypted, &s.emailBidx)
+	if err != nil {
+		t.Fatalf("failed to read user row: %v", err)
+	}
+	return s
+}
+
+func TestUserRepositoryEncryptsPII(t *testing.T) {
+	repo, db := newUserRepository(t)
+	ctx := context.Background()
+	created := createUser(t, ctx, repo, "alice", "Alice@Example.com")
+
+	stored := readStoredPII(t, db, created.Id)
+	if stored.username.Valid || stored.email.Valid {
+		t.Fatalf("plaintext columns are set: %q, %q", stored.username.String, stored.email.String)
+	}
+	for _, column := range []string{stored.usernameEncrypted.String, stored.emailEncrypted.String} {
+		if column == "" || strings.Contains(column, "alice") || strings.Contains(column, "Alice") {
+			t.Fatalf("encrypted column = %q", column)
+		}
+	}
+	if stored.emailBidx.String != repo.EmailIndex("alice@example.com") {
+		t.Fatalf("email_bidx = %q, want the blind index of the email", stored.emailBidx.String)
+	}
+
+	byId, err := repo.GetById(ctx, created.Id)
+	if err != nil {
+		t.Fatalf("GetById: %v", err)
+	}
+	if byId.Username != "alice" || byId.Email != "Alice@Example.com" {
+		t.Fatalf("GetById = %q, %q, want the values it was created with", byId.Username, byId.Email)
+	}
+
+	// The blind index ignores case and surrounding spaces like the plaintext column did
+	byEmail, err := repo.GetByEmail(ctx, "  ALICE@example.COM ")
+	if err != nil {
+		t.Fatalf("GetByEmail: %v", err)
+	}
+	if byEmail.Id != created.Id || byEmail.Email != "Alice@Example.com" {
+		t.Fatalf("GetByEmail = %d %q, want %d %q", byEmail.Id, byEmail.Email, created.Id, "Alice@Example.com")
+	}
+}
+
+func TestUserRepositoryEncryptsPlaintextRows(t *testing.T) {
+	repo, db := newUserRepository(t)
+	ctx := context.Background()
+
+	// A row from before PII encryption
+	result, err := db.Primary.Exec("INSERT INTO users(username, email, password) VALUES ('bob', 'bob@example.com', 'hash')")
+	if err != nil {
+		t.Fatalf("failed to insert plaintext user: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	userId := int(id)
+
+	stale, err := repo.ListStalePII(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("ListStalePII: %v", err)
+	}
+	if len(stale) != 1 || stale[0] != userId {
+		t.Fatalf("ListStalePII = %v, want [%d]", stale, userId)
+	}
+
+	// Still readable before it is re-encrypted
+	if u, err := repo.GetById(ctx, userId); err != nil || u.Email != "bob@example.com" {
+		t.Fatalf("GetById = %+v, %v, want the plaintext email", u, err)
+	}
+
+	changed, err := repo.ReencryptPII(ctx, userId)
+	if err != nil || !changed {
+		t.Fatalf("ReencryptPII = %v, %v, want true", changed, err)
+	}
+	if changed, err := repo.ReencryptPII(ctx, userId); err != nil || changed {
+		t.Fatalf("second ReencryptPII = %v, %v, want false", changed, err)
+	}
+
+	stored := readStoredPII(t, db, userId)
+	if stored.username.Valid || stored.email.Valid {
+		t.Fatal("plaintext columns were not cleared")
+	}
+	u, err := repo.GetByEmail(ctx, "bob@example.com")
+	if err != nil {
+		t.Fatalf("GetByEmail: %v", err)
+	}
+	if u.Id != userId || u.Username != "bob" {
+		t.Fatalf("GetByEmail = %d %q, want %d %q", u.Id, u.Username, userId, "bob")
+	}
+	if stale, _ := repo.ListStalePII(ctx, 0, 10); len(stale) != 0 {
+		t.Fatalf("ListStalePII = %v after re-encryption, want none", stale)
+	}
+}
+
+func TestUserRepositoryTranslatesErrors(t *testing.T) {
+	repo, _ := newUserRepository(t)
+	ctx := context.Background()
+	createUser(t, ctx, repo, "alice", "alice@example.com")
+
+	err := repo.Create(ctx, &user.User{Username: "other", Email: "ALICE@example.com", Password: "hash"})
+	if !errors.Is(err, errorpkg.ErrEmailTaken) {
+		t.Fatalf("Create with a taken email = %v, want %v", err, errorpkg.ErrEmailTaken)
+	}
+
+	// Usernames are not unique
+	createUser(t, ctx, repo, "alice", "alice2@example.com")
+
+	if _, err := repo.GetById(ctx, 999); !errors.Is(err, errorpkg.ErrUserNotFound) {
+		t.Fatalf("GetById of a missing user = %v, want %v", err, errorpkg.ErrUserNotFound)
+	}
+	if _, err := repo.GetByEmail(ctx, "nobody@example.com"); !errors.Is(err, errorpkg.ErrUserNotFound) {
+		t.Fatalf("GetByEmail of a missing user = %v, want %v", err, errorpkg.ErrUserNotFound)
+	}
+}
+
+func TestUserRepositoryCreateInTransaction(t *testing.T) {
+	repo, db := newUserRepository(t)
+	tm := database.NewTxManager(db)
+	ctx := context.Background()
+	errFailed := errors.New("failed")
+
+	err := tm.WithTransaction(ctx, func(ctx context.Context) error {
+		createUser(t, ctx, repo, "carol", "carol@example.com")
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("WithTransaction = %v, want %v", err, errFailed)
+	}
+
+	if _, err := repo.GetByEmail(ctx, "carol@example.com"); !errors.Is(err, errorpkg.ErrUserNotFound) {
+		t.Fatalf("GetByEmail after rollback = %v, want %v", err, errorpkg.ErrUserNotFound)
+	}
+}
@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/domain/webhook"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+)
+
+type webhookRepository struct {
+	db      database.Querier
+	dialect database.Dialect
+}
+
+func NewWebhookRepository(db *database.DB) webhook.Repository {
+	return &webhookRepository{
+		db:      database.Bind(db.Dialect, db.Primary),
+		dialect: db.Dialect,
+	}
+}
+
+func joinEvents(events []webhook.EventType) string {
+	parts := make([]string, len(events))
+	for i, e := range events {
+		parts[i] = string(e)
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitEvents(events string) []webhook.EventType {
+	var result []webhook.EventType
+	for _, e := range strings.Split(events, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			result = append(result, webhook.EventType(e))
+		}
+	}
+	return result
+}
+
+// CreateSubscription implements webhook.Repository.
+func (w *webhookRepository) CreateSubscription(ctx context.Context, sub *webhook.Subscription) error {
+	query := `
+		INSERT INTO webhook_subscriptions(url, secret, events, active, created_at, updated_at)
+		VALUES (?,?,?,?,NOW(),NOW())
+	`
+	id, err := w.dialect.InsertId(ctx, w.db, query, sub.URL, sub.Secret, joinEvents(sub.Events), sub.Active)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+	sub.Id = int(id)
+	return nil
+}
+
+// GetSubscription implements webhook.Repository.
+func (w *webhookRepository) GetSubscription(ctx context.Context, id int) (*webhook.Subscription, error) {
+	query := `
+		SELECT id, url, secret, events, active, created_at, updated_at
+		FROM webhook_subscriptions WHERE id = ?
+	`
+	sub := &webhook.Subscription{}
+	var events string
+
+	err := w.db.QueryRowContext(ctx, query, id).Scan(
+		&sub.Id, &sub.URL, &sub.Secret, &events, &sub.Active, &sub.CreatedAt, &sub.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errorpkg.ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+	sub.Events = splitEvents(events)
+
+	return sub, nil
+}
+
+// ListSubscriptions implements webhook.Repository.
+func (w *webhookRepository) ListSubscriptions(ctx context.Context) ([]*webhook.Subscription, error) {
+	query := `
+		SELECT id, url, secret, events, active, created_at, updated_at
+		FROM webhook_subscriptions ORDER BY id
+	`
+	rows, err := w.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []*webhook.Subscription
+	for rows.Next() {
+		sub := &webhook.Subscription{}
+		var events string
+		if err := rows.Scan(
+			&sub.Id, &sub.URL, &sub.Secret, &events, &sub.Active, &sub.CreatedAt, &sub.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		sub.Events = splitEvents(events)
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+// UpdateSubscriptionSecret implements webhook.Repository.
+func (w *webhookRepository) UpdateSubscriptionSecret(ctx context.Context, id int, secret string) error {
+	query := "UPDATE webhook_subscriptions SET secret = ?, updated_at = NOW() WHERE id = ?"
+	res, err := w.db.ExecContext(ctx, query, secret, id)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook secret: %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errorpkg.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// DeleteSubscription implements webhook.Repository.
+func (w *webhookRepository) DeleteSubscription(ctx context.Context, id int) error {
+	res, err := w.db.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errorpkg.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// CreateDelivery implements webhook.Repository.
+func (w *webhookRepository) CreateDelivery(ctx context.Context, delivery *webhook.Delivery) error {
+	query := `
+		INSERT INTO webhook_deliveries(subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at, updated_at)
+		VALUES (?,?,?,?,?,?,?,NOW(),NOW())
+	`
+	id, err := w.dialect.InsertId(ctx, w.db, query,
+		delivery.SubscriptionId,
+		delivery.EventId,
+		delivery.EventType,
+		delivery.Payload,
+		delivery.Status,
+		delivery.Attempts,
+		nextAttemptAt(delivery),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+	delivery.Id = int(id)
+	return nil
+}
+
+// UpdateDelivery implements webhook.Repository.
+func (w *webhookRepository) UpdateDelivery(ctx context.Context, delivery *webhook.Delivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, response_code = ?, last_error = ?, next_attempt_at = ?, updated_at = NOW()
+		WHERE id = ?
+	`
+	_, err := w.db.ExecContext(ctx, query,
+		delivery.Status,
+		delivery.Attempts,
+		sql.NullInt64{Int64: int64(delivery.ResponseCode), Valid: delivery.ResponseCode != 0},
+		sql.NullString{String: delivery.LastError, Valid: delivery.LastError != ""},
+		nextAttemptAt(delivery),
+		delivery.Id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// GetDelivery implements webhook.Repository.
+func (w *webhookRepository) GetDelivery(ctx context.Context, id int) (*webhook.Delivery, error) {
+	query := `
+		SELECT id, subscription_id, event_id, event_type, payload, status, attempts,
+			response_code, last_error, next_attempt_at, created_at, updated_at
+		FROM webhook_deliveries WHERE id = ?
+	`
+	delivery, err := scanDelivery(w.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, errorpkg.ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+
+	return delivery, nil
+}
+
+// ListDeliveries implements webhook.Repository.
+func (w *webhookRepository) ListDeliveries(ctx context.Context, subscriptionId int, limit int) ([]*webhook.Delivery, error) {
+	query := `
+		SELECT id, subscription_id, event_id, event_type, payload, status, attempts,
+			response_code, last_error, next_attempt_at, created_at, updated_at
+		FROM webhook_deliveries WHERE subscription_id = ?
+		ORDER BY id DESC LIMIT ?
+	`
+	rows, err := w.db.QueryContext(ctx, query, subscriptionId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*webhook.Delivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ListDueDeliveries implements webhook.Repository.
+func (w *webhookRepository) ListDueDeliveries(ctx context.Context, now time.Time, limit int) ([]int, error) {
+	query := `
+		SELECT id FROM webhook_deliveries
+		WHERE status IN (?,?) AND next_attempt_at <= ?
+		ORDER BY next_attempt_at LIMIT ?
+	`
+	rows, err := w.db.QueryContext(ctx, query, webhook.DeliveryPending, webhook.DeliveryRetrying, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ClaimDelivery implements webhook.Repository.
+func (w *webhookRepository) ClaimDelivery(ctx context.Context, id int, now time.Time, until time.Time) (bool, error) {
+	query := `
+		UPDATE webhook_deliveries SET next_attempt_at = ?
+		WHERE id = ? AND status IN (?,?) AND next_attempt_at <= ?
+	`
+	res, err := w.db.ExecContext(ctx, query,
+		until.UTC(), id, webhook.DeliveryPending, webhook.DeliveryRetrying, now.UTC(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// nextAttemptAt stores NULL for deliveries that are done, the sweeper never looks at them
+func nextAttemptAt(delivery *webhook.Delivery) sql.NullTime {
+	return sql.NullTime{Time: delivery.NextAttemptAt.UTC(), Valid: !delivery.NextAttemptAt.IsZero()}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDelivery(row rowScanner) (*webhook.Delivery, error) {
+	delivery := &webhook.Delivery{}
+	var responseCode sql.NullInt64
+	var lastError sql.NullString
+	var nextAttempt sql.NullTime
+
+	if err := row.Scan(
+		&delivery.Id,
+		&delivery.SubscriptionId,
+		&delivery.EventId,
+		&delivery.EventType,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&responseCode,
+		&lastError,
+		&nextAttempt,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	delivery.ResponseCode = int(responseCode.Int64)
+	delivery.LastError = lastError.String
+	delivery.NextAttemptAt = nextAttempt.Time
+
+	return delivery, nil
+}
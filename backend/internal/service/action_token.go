@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"math"
+
+	"github.com/golang-jwt/jwt/v5"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+	"github.com/imnzr/user-authentication-go/pkg/auth"
+)
+
+// verifyActionToken checks a single purpose token sent by email and returns the user it was issued for.
+// VerifyToken has already rejected it when it expired.
+func verifyActionToken(ctx context.Context, authManager auth.AuthManager, tokenString string, tokenType string) (int, error) {
+	userId, _, err := parseActionToken(ctx, authManager, tokenString, tokenType)
+	return userId, err
+}
+
+func parseActionToken(ctx context.Context, authManager auth.AuthManager, tokenString string, tokenType string) (int, jwt.MapClaims, error) {
+	claims, err := authManager.VerifyToken(ctx, tokenString)
+	if err != nil {
+		return 0, nil, errorpkg.ErrInvalidLink
+	}
+	if t, _ := claims["type"].(string); t != tokenType {
+		return 0, nil, errorpkg.ErrInvalidLink
+	}
+	userIdFloat, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, nil, errorpkg.ErrInvalidLink
+	}
+	return int(userIdFloat), claims, nil
+}
+
+// checkSingleUseToken is verifyActionToken for tokens with a jti, it also rejects one that was
+// already used. Nothing is consumed, see useSingleUseToken.
+func checkSingleUseToken(ctx context.Context, authManager auth.AuthManager, redisRepo redis.Client, tokenString string, tokenType string) (int, error) {
+	userId, claims, err := parseActionToken(ctx, authManager, tokenString, tokenType)
+	if err != nil {
+		return 0, err
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return 0, errorpkg.ErrInvalidLink
+	}
+
+	used, err := redisRepo.Exists(ctx, redis.UsedActionTokenKey(jti))
+	if err != nil {
+		return 0, errorpkg.ErrServiceUnavailable
+	}
+	if used {
+		return 0, errorpkg.ErrInvalidLink
+	}
+	return userId, nil
+}
+
+// useSingleUseToken verifies the token and marks its jti used until the token expires, so only
+// one request gets past it. Calling release makes the link work again, for an action that failed.
+// Without Redis there is no telling whether the token was used, so it fails closed.
+func useSingleUseToken(ctx context.Context, authManager auth.AuthManager, redisRepo redis.Client, tokenString string, tokenType string) (int, func(), error) {
+	userId, claims, err := parseActionToken(ctx, authManager, tokenString, tokenType)
+	if err != nil {
+		return 0, nil, err
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return 0, nil, errorpkg.ErrInvalidLink
+	}
+
+	key := redis.UsedActionTokenKey(jti)
+	ttl := int64(math.Ceil(remainingLifetime(claims).Seconds()))
+	first, err := redisRepo.SetNX(ctx, key, "used", ttl)
+	if err != nil {
+		return 0, nil, errorpkg.ErrServiceUnavailable
+	}
+	if !first {
+		return 0, nil, errorpkg.ErrInvalidLink
+	}
+
+	release := func() {
+		redisRepo.Del(context.Background(), key)
+	}
+	return userId, release, nil
+}
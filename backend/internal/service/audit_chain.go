@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"go.uber.org/zap"
+)
+
+// errChainBroken stops walking a chain at the first bad link
+var errChainBroken = errors.New("audit chain broken")
+
+func checkpointKeyId(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// VerifyChain implements audit.Service.
+func (s *auditService) VerifyChain(ctx context.Context, fromDay string, toDay string) (*audit.VerifyResult, error) {
+	heads, err := s.auditRepo.ListHeads(ctx, fromDay, toDay)
+	if err != nil {
+		return nil, err
+	}
+	checkpoints, err := s.auditRepo.ListCheckpoints(ctx, fromDay, toDay)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpointsByDay := make(map[string][]*audit.Checkpoint)
+	for _, checkpoint := range checkpoints {
+		checkpointsByDay[checkpoint.Day] = append(checkpointsByDay[checkpoint.Day], checkpoint)
+	}
+
+	result := &audit.VerifyResult{Days: []string{}, Valid: true}
+	fail := func(day string, eventId int64, reason string) (*audit.VerifyResult, error) {
+		result.Valid = false
+		result.Break = &audit.ChainBreak{Day: day, EventId: eventId, Reason: reason}
+		return result, nil
+	}
+
+	for _, head := range heads {
+		result.Days = append(result.Days, head.Day)
+
+		// Remember the hashes checkpoints point at
+		checkpointed := make(map[int64]string)
+		for _, checkpoint := range checkpointsByDay[head.Day] {
+			checkpointed[checkpoint.LastEventId] = ""
+		}
+
+		var (
+			prevHash    = audit.GenesisHash(head.Day)
+			lastEventId int64
+			count       int
+			broken      *audit.ChainBreak
+		)
+		err := s.auditRepo.WalkDay(ctx, head.Day, func(event *audit.Event) error {
+			count++
+			result.EventsChecked++
+
+			if event.PrevHash != prevHash {
+				broken = &audit.ChainBreak{Day: head.Day, EventId: event.Id, Reason: audit.BreakPrevHash}
+				return errChainBroken
+			}
+			hash, err := event.ComputeHash(event.PrevHash)
+			if err != nil {
+				return err
+			}
+			if hash != event.Hash {
+				broken = &audit.ChainBreak{Day: head.Day, EventId: event.Id, Reason: audit.BreakHash}
+				return errChainBroken
+			}
+
+			if _, ok := checkpointed[event.Id]; ok {
+				checkpointed[event.Id] = event.Hash
+			}
+			prevHash = event.Hash
+			lastEventId = event.Id
+			return nil
+		})
+		if errors.Is(err, errChainBroken) {
+			return fail(broken.Day, broken.EventId, broken.Reason)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Events removed from or added to the end of the chain
+		if head.LastHash != prevHash || head.LastEventId != lastEventId || head.EventCount != count {
+			return fail(head.Day, lastEventId, audit.BreakHead)
+		}
+
+		for _, checkpoint := range checkpointsByDay[head.Day] {
+			if s.signingKey != nil && !s.verifyCheckpoint(checkpoint) {
+				return fail(head.Day, checkpoint.LastEventId, audit.BreakCheckpointSignature)
+			}
+			if checkpointed[checkpoint.LastEventId] != checkpoint.LastHash || checkpoint.EventCount > count {
+				return fail(head.Day, checkpoint.LastEventId, audit.BreakCheckpoint)
+			}
+		}
+		delete(checkpointsByDay, head.Day)
+	}
+
+	// A checkpoint for a day with no chain means the whole day was removed
+	missing := make([]string, 0, len(checkpointsByDay))
+	for day := range checkpointsByDay {
+		missing = append(missing, day)
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fail(missing[0], checkpointsByDay[missing[0]][0].LastEventId, audit.BreakCheckpoint)
+	}
+
+	return result, nil
+}
+
+func (s *auditService) verifyCheckpoint(checkpoint *audit.Checkpoint) bool {
+	if checkpoint.KeyId != s.keyId {
+		// Signed with a key we don't have, verify it against the export of that key
+		return true
+	}
+	signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(s.signingKey.Public().(ed25519.PublicKey), checkpoint.SigningPayload(), signature)
+}
+
+// CreateCheckpoints implements audit.Service.
+func (s *auditService) CreateCheckpoints(ctx context.Context) ([]*audit.Checkpoint, error) {
+	if s.signingKey == nil {
+		return nil, errorpkg.ErrCheckpointsDisabled
+	}
+
+	// Yesterday's chain can still get its last events right after midnight
+	now := time.Now().UTC()
+	heads, err := s.auditRepo.ListHeads(ctx, audit.ChainDay(now.AddDate(0, 0, -1)), audit.ChainDay(now))
+	if err != nil {
+		return nil, err
+	}
+
+	var created []*audit.Checkpoint
+	for _, head := range heads {
+		if head.EventCount == 0 {
+			continue
+		}
+		latest, err := s.auditRepo.LatestCheckpoint(ctx, head.Day)
+		if err != nil {
+			return created, err
+		}
+		if latest != nil && latest.LastEventId == head.LastEventId {
+			continue
+		}
+
+		checkpoint := &audit.Checkpoint{
+			Day:         head.Day,
+			LastEventId: head.LastEventId,
+			LastHash:    head.LastHash,
+			EventCount:  head.EventCount,
+			CreatedAt:   time.Now().UTC().Truncate(time.Microsecond),
+			KeyId:       s.keyId,
+		}
+		checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.signingKey, checkpoint.SigningPayload()))
+
+		if err := s.auditRepo.InsertCheckpoint(ctx, checkpoint); err != nil {
+			return created, err
+		}
+		created = append(created, checkpoint)
+	}
+
+	return created, nil
+}
+
+// ExportCheckpoints implements audit.Service.
+func (s *auditService) ExportCheckpoints(ctx context.Context, fromDay string, toDay string) (*audit.CheckpointExport, error) {
+	if s.signingKey == nil {
+		return nil, errorpkg.ErrCheckpointsDisabled
+	}
+
+	checkpoints, err := s.auditRepo.ListCheckpoints(ctx, fromDay, toDay)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoints == nil {
+		checkpoints = []*audit.Checkpoint{}
+	}
+
+	return &audit.CheckpointExport{
+		Algorithm:   "ed25519",
+		KeyId:       s.keyId,
+		PublicKey:   base64.StdEncoding.EncodeToString(s.signingKey.Public().(ed25519.PublicKey)),
+		Checkpoints: checkpoints,
+	}, nil
+}
+
+func (s *auditService) checkpointLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.cfg.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			created, err := s.CreateCheckpoints(context.Background())
+			if err != nil {
+				s.logger.Error("failed to create audit checkpoints", zap.Error(err))
+			}
+			for _, checkpoint := range created {
+				s.logger.Info("audit checkpoint created",
+					zap.String("day", checkpoint.Day),
+					zap.Int64("last_event_id", checkpoint.LastEventId),
+					zap.String("last_hash", checkpoint.LastHash),
+				)
+			}
+		}
+	}
+}
+
+// Close implements audit.Service.
+func (s *auditService) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+	})
+}
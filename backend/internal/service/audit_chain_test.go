@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+)
+
+// recordEvents records n login events and returns their ids in chain order
+func recordEvents(t *testing.T, s audit.Service, db *database.DB, n int) []int64 {
+	t.Helper()
+
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		s.Record(ctx, audit.NewEvent(audit.ActionLogin, audit.OutcomeSuccess, audit.UserActor(i+1), i+1).
+			With("attempt", i).
+			With("ratio", 0.5).
+			With("method", "password"))
+	}
+
+	rows, err := db.Primary.Query("SELECT id FROM audit_events ORDER BY id")
+	if err != nil {
+		t.Fatalf("failed to list audit events: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("failed to scan audit event: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) != n {
+		t.Fatalf("%d audit events stored, want %d", len(ids), n)
+	}
+	return ids
+}
+
+// tamper edits the audit tables behind the application's back, the triggers that keep
+// audit_events append-only are dropped first like an attacker with database access would
+func tamper(t *testing.T, db *database.DB, statements ...string) {
+	t.Helper()
+
+	statements = append([]string{
+		"DROP TRIGGER audit_events_no_update",
+		"DROP TRIGGER audit_events_no_delete",
+	}, statements...)
+	for _, statement := range statements {
+		if _, err := db.Primary.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+}
+
+func verifyChain(t *testing.T, s audit.Service) *audit.VerifyResult {
+	t.Helper()
+
+	result, err := s.VerifyChain(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("VerifyChain: %v", err)
+	}
+	return result
+}
+
+func assertBreak(t *testing.T, result *audit.VerifyResult, reason string, eventId int64) {
+	t.Helper()
+
+	if result.Valid || result.Break == nil {
+		t.Fatalf("VerifyChain = %+v, want a %s break", result, reason)
+	}
+	if result.Break.Reason != reason || result.Break.EventId != eventId {
+		t.Fatalf("break = %+v, want %s at event %d", result.Break, reason, eventId)
+	}
+}
+
+func TestVerifyChainValid(t *testing.T) {
+	s, db := newAuditService(t, config.AuditConfig{})
+	recordEvents(t, s, db, 5)
+
+	result := verifyChain(t, s)
+	if !result.Valid || result.Break != nil {
+		t.Fatalf("VerifyChain = %+v, want valid", result)
+	}
+	if result.EventsChecked != 5 || len(result.Days) != 1 {
+		t.Fatalf("VerifyChain checked %d events over %v, want 5 over one day", result.EventsChecked, result.Days)
+	}
+}
+
+func TestAuditEventsAreAppendOnly(t *testing.T) {
+	s, db := newAuditService(t, config.AuditConfig{})
+	ids := recordEvents(t, s, db, 1)
+
+	if _, err := db.Primary.Exec("UPDATE audit_events SET outcome = 'failure' WHERE id = ?", ids[0]); err == nil {
+		t.Fatal("UPDATE of an audit event succeeded")
+	}
+	if _, err := db.Primary.Exec("DELETE FROM audit_events WHERE id = ?", ids[0]); err == nil {
+		t.Fatal("DELETE of an audit event succeeded")
+	}
+}
+
+func TestVerifyChainDetectsEditedEvent(t *testing.T) {
+	s, db := newAuditService(t, config.AuditConfig{})
+	ids := recordEvents(t, s, db, 5)
+
+	tamper(t, db, fmt.Sprintf(`UPDATE audit_events SET metadata = '{"attempt":99}' WHERE id = %d`, ids[2]))
+
+	assertBreak(t, verifyChain(t, s), audit.BreakHash, ids[2])
+}
+
+func TestVerifyChainDetectsRemovedEvent(t *testing.T) {
+	s, db := newAuditService(t, config.AuditConfig{})
+	ids := recordEvents(t, s, db, 5)
+
+	tamper(t, db, fmt.Sprintf("DELETE FROM audit_events WHERE id = %d", ids[2]))
+
+	// The event after the gap points at a hash that is gone
+	assertBreak(t, verifyChain(t, s), audit.BreakPrevHash, ids[3])
+}
+
+func TestVerifyChainDetectsTruncatedChain(t *testing.T) {
+	s, db := newAuditService(t, config.AuditConfig{})
+	ids := recordEvents(t, s, db, 5)
+
+	tamper(t, db, fmt.Sprintf("DELETE FROM audit_events WHERE id = %d", ids[4]))
+
+	// The rest of the chain is intact, only the head knows the last event is missing
+	assertBreak(t, verifyChain(t, s), audit.BreakHead, ids[3])
+}
+
+func TestVerifyChainDetectsTruncationBehindCheckpoint(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	s, db := newAuditService(t, config.AuditConfig{
+		CheckpointSigningKey: config.Secret(base64.StdEncoding.EncodeToString(seed)),
+	})
+	ids := recordEvents(t, s, db, 5)
+
+	checkpoints, err := s.CreateCheckpoints(context.Background())
+	if err != nil || len(checkpoints) != 1 {
+		t.Fatalf("CreateCheckpoints = %v, %v, want one checkpoint", checkpoints, err)
+	}
+	if result := verifyChain(t, s); !result.Valid {
+		t.Fatalf("VerifyChain with a checkpoint = %+v, want valid", result)
+	}
+
+	// Removing the last event and rewinding the head hides it from the chain alone
+	var lastHash string
+	if err := db.Primary.QueryRow("SELECT hash FROM audit_events WHERE id = ?", ids[3]).Scan(&lastHash); err != nil {
+		t.Fatal(err)
+	}
+	tamper(t, db,
+		fmt.Sprintf("DELETE FROM audit_events WHERE id = %d", ids[4]),
+		fmt.Sprintf("UPDATE audit_chain_heads SET last_event_id = %d, last_hash = '%s', event_count = 4", ids[3], lastHash),
+	)
+
+	assertBreak(t, verifyChain(t, s), audit.BreakCheckpoint, ids[4])
+}
+
+func TestVerifyChainDetectsForgedCheckpoint(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	s, db := newAuditService(t, config.AuditConfig{
+		CheckpointSigningKey: config.Secret(base64.StdEncoding.EncodeToString(seed)),
+	})
+	ids := recordEvents(t, s, db, 3)
+
+	if _, err := s.CreateCheckpoints(context.Background()); err != nil {
+		t.Fatalf("CreateCheckpoints: %v", err)
+	}
+	tamper(t, db, "UPDATE audit_checkpoints SET event_count = 2")
+
+	assertBreak(t, verifyChain(t, s), audit.BreakCheckpointSignature, ids[2])
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"strconv"
+	"sync"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"go.uber.org/zap"
+)
+
+const defaultAuditPageSize = 50
+
+type auditService struct {
+	auditRepo audit.Repository
+	// Optional, nil when events stay in the database only
+	exporter audit.Exporter
+	cfg      config.AuditConfig
+	logger   *zap.Logger
+
+	// Nil when no signing key is configured
+	signingKey ed25519.PrivateKey
+	keyId      string
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewAuditService starts periodic checkpoints when a signing key is configured
+func NewAuditService(auditRepo audit.Repository, exporter audit.Exporter, cfg config.AuditConfig, logger *zap.Logger) (audit.Service, error) {
+	s := &auditService{
+		auditRepo: auditRepo,
+		exporter:  exporter,
+		cfg:       cfg,
+		logger:    logger,
+		done:      make(chan struct{}),
+	}
+
+	if cfg.CheckpointSigningKey != "" {
+		seed, err := base64.StdEncoding.DecodeString(cfg.CheckpointSigningKey.Value())
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, errorpkg.ErrInvalidCheckpointKey
+		}
+		s.signingKey = ed25519.NewKeyFromSeed(seed)
+		s.keyId = checkpointKeyId(s.signingKey.Public().(ed25519.PublicKey))
+	}
+
+	if s.signingKey != nil && cfg.CheckpointInterval > 0 {
+		s.wg.Add(1)
+		go s.checkpointLoop()
+	}
+
+	return s, nil
+}
+
+// Record implements audit.Recorder.
+func (s *auditService) Record(ctx context.Context, event *audit.Event) {
+	info := audit.RequestInfoFrom(ctx)
+	if event.IPAddress == "" {
+		event.IPAddress = info.IPAddress
+	}
+	if event.UserAgent == "" {
+		event.UserAgent = info.UserAgent
+	}
+	if event.RequestId == "" {
+		event.RequestId = info.RequestId
+	}
+	if event.Actor == "" {
+		event.Actor = audit.ActorAnonymous
+	}
+
+	if err := s.auditRepo.Insert(ctx, event); err != nil {
+		// Keep the event in the application log so it isn't lost entirely
+		s.logger.Error("failed to record audit event",
+			zap.String("action", event.Action),
+			zap.String("outcome", event.Outcome),
+			zap.String("actor", event.Actor),
+			zap.Any("target_id", event.TargetId),
+			zap.String("request_id", event.RequestId),
+			zap.Error(err),
+		)
+	}
+
+	if s.exporter != nil {
+		s.exporter.Export(event)
+	}
+}
+
+// List implements audit.Service.
+func (s *auditService) List(ctx context.Context, filter audit.Filter, cursor string) (*audit.Page, error) {
+	if cursor != "" {
+		beforeId, err := decodeAuditCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.BeforeId = beforeId
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > audit.MaxPageSize {
+		filter.Limit = audit.MaxPageSize
+	}
+
+	// One extra row tells whether there is a next page
+	pageSize := filter.Limit
+	filter.Limit++
+
+	events, err := s.auditRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &audit.Page{Events: events}
+	if len(events) > pageSize {
+		page.Events = events[:pageSize]
+		page.NextCursor = encodeAuditCursor(page.Events[pageSize-1].Id)
+	}
+	if page.Events == nil {
+		page.Events = []*audit.Event{}
+	}
+
+	return page, nil
+}
+
+// Cursors are opaque to clients so the paging scheme can change
+func encodeAuditCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeAuditCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errorpkg.ErrInvalidAuditCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errorpkg.ErrInvalidAuditCursor
+	}
+	return id, nil
+}
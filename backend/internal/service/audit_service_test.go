@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/internal/repository"
+	"github.com/imnzr/user-authentication-go/internal/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newAuditService(t *testing.T, cfg config.AuditConfig) (audit.Service, *database.DB) {
+	t.Helper()
+
+	db := testutil.NewDB(t)
+	s, err := NewAuditService(repository.NewAuditRepository(db), nil, cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewAuditService: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, db
+}
+
+// exportRecorder keeps every exported event
+type exportRecorder struct {
+	mu     sync.Mutex
+	events []*audit.Event
+}
+
+func (e *exportRecorder) Export(event *audit.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+// failingAuditRepository refuses every insert
+type failingAuditRepository struct {
+	audit.Repository
+}
+
+func (failingAuditRepository) Insert(ctx context.Context, event *audit.Event) error {
+	return errors.New("disk full")
+}
+
+func listAudit(t *testing.T, s audit.Service, filter audit.Filter, cursor string) *audit.Page {
+	t.Helper()
+
+	page, err := s.List(context.Background(), filter, cursor)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return page
+}
+
+func TestAuditRecordFillsInTheRequest(t *testing.T) {
+	s, _ := newAuditService(t, config.AuditConfig{})
+	ctx := context.WithValue(context.Background(), audit.RequestInfoKey, audit.RequestInfo{
+		IPAddress: "203.0.113.7",
+		UserAgent: "laptop",
+		RequestId: "req-1",
+	})
+
+	s.Record(ctx, audit.NewEvent(audit.ActionLogin, audit.OutcomeFailure, audit.Actor{}, 0).With("reason", "unknown_email"))
+	s.Record(ctx, audit.NewEvent(audit.ActionLogout, audit.OutcomeSuccess, audit.UserActor(7), 7))
+
+	events := listAudit(t, s, audit.Filter{}, "").Events
+	if len(events) != 2 {
+		t.Fatalf("%d events stored, want 2", len(events))
+	}
+	logout, login := events[0], events[1]
+	for _, event := range events {
+		if event.IPAddress != "203.0.113.7" || event.UserAgent != "laptop" || event.RequestId != "req-1" {
+			t.Fatalf("event %s has request %q %q %q", event.Action, event.IPAddress, event.UserAgent, event.RequestId)
+		}
+	}
+	if login.Actor != audit.ActorAnonymous || login.TargetId != nil || login.Metadata["reason"] != "unknown_email" {
+		t.Fatalf("login event = %+v", login)
+	}
+	if logout.Actor != "user:7" || *logout.ActorId != 7 || *logout.TargetId != 7 {
+		t.Fatalf("logout event = %+v", logout)
+	}
+}
+
+func TestAuditRecordExportsEvenWhenInsertFails(t *testing.T) {
+	db := testutil.NewDB(t)
+	exporter := &exportRecorder{}
+	core, logs := observer.New(zapcore.ErrorLevel)
+	s, err := NewAuditService(failingAuditRepository{repository.NewAuditRepository(db)}, exporter, config.AuditConfig{}, zap.New(core))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Record(context.Background(), audit.NewEvent(audit.ActionPasswordChanged, audit.OutcomeSuccess, audit.UserActor(3), 3))
+
+	// The event is neither lost nor blocks the action
+	if len(exporter.events) != 1 || exporter.events[0].Action != audit.ActionPasswordChanged {
+		t.Fatalf("exported %v, want the event", exporter.events)
+	}
+	logged := logs.FilterMessage("failed to record audit event").All()
+	if len(logged) != 1 || logged[0].ContextMap()["action"] != audit.ActionPasswordChanged {
+		t.Fatalf("logged %v, want the failed event", logs.All())
+	}
+}
+
+func TestAuditListFilters(t *testing.T) {
+	s, _ := newAuditService(t, config.AuditConfig{})
+	ctx := context.Background()
+	s.Record(ctx, audit.NewEvent(audit.ActionLogin, audit.OutcomeSuccess, audit.UserActor(1), 1))
+	s.Record(ctx, audit.NewEvent(audit.ActionLogin, audit.OutcomeFailure, audit.AnonymousActor, 1))
+	s.Record(ctx, audit.NewEvent(audit.ActionAccountSuspended, audit.OutcomeSuccess, audit.AdminActor(9), 2))
+
+	one, nine := 1, 9
+	hourAgo, inAnHour := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	cases := []struct {
+		name   string
+		filter audit.Filter
+		want   int
+	}{
+		{"all", audit.Filter{}, 3},
+		{"action", audit.Filter{Action: audit.ActionLogin}, 2},
+		{"outcome", audit.Filter{Action: audit.ActionLogin, Outcome: audit.OutcomeFailure}, 1},
+		{"actor", audit.Filter{ActorId: &nine}, 1},
+		{"target", audit.Filter{TargetId: &one}, 2},
+		{"since", audit.Filter{Since: &hourAgo}, 3},
+		{"until", audit.Filter{Until: &hourAgo}, 0},
+		{"window", audit.Filter{Since: &hourAgo, Until: &inAnHour}, 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if events := listAudit(t, s, tc.filter, "").Events; len(events) != tc.want {
+				t.Fatalf("%d events, want %d", len(events), tc.want)
+			}
+		})
+	}
+}
+
+func TestAuditListPages(t *testing.T) {
+	s, _ := newAuditService(t, config.AuditConfig{})
+	for i := 1; i <= 5; i++ {
+		s.Record(context.Background(), audit.NewEvent(audit.ActionLogin, audit.OutcomeSuccess, audit.UserActor(i), i))
+	}
+
+	var targets []int
+	cursor := ""
+	for pages := 1; ; pages++ {
+		page := listAudit(t, s, audit.Filter{Limit: 2}, cursor)
+		for _, event := range page.Events {
+			targets = append(targets, *event.TargetId)
+		}
+		if page.NextCursor == "" {
+			if pages != 3 {
+				t.Fatalf("%d pages, want 3", pages)
+			}
+			break
+		}
+		cursor = page.NextCursor
+	}
+	// Newest first, every event exactly once
+	want := []int{5, 4, 3, 2, 1}
+	if len(targets) != len(want) {
+		t.Fatalf("paged through %v, want %v", targets, want)
+	}
+	for i := range want {
+		if targets[i] != want[i] {
+			t.Fatalf("paged through %v, want %v", targets, want)
+		}
+	}
+
+	// An exact last page has no cursor
+	if page := listAudit(t, s, audit.Filter{Limit: 5}, ""); page.NextCursor != "" {
+		t.Fatalf("NextCursor = %q after the last event", page.NextCursor)
+	}
+	// Nothing found is an empty list, not null
+	if page := listAudit(t, s, audit.Filter{Action: audit.ActionSignup}, ""); page.Events == nil || len(page.Events) != 0 {
+		t.Fatalf("Events = %v, want empty", page.Events)
+	}
+}
+
+func TestAuditListRejectsBadCursors(t *testing.T) {
+	s, _ := newAuditService(t, config.AuditConfig{})
+
+	for _, cursor := range []string{"not base64!", encodeAuditCursor(0), "YWJj"} {
+		if _, err := s.List(context.Background(), audit.Filter{}, cursor); !errors.Is(err, errorpkg.ErrInvalidAuditCursor) {
+			t.Fatalf("List(%q) = %v, want %v", cursor, err, errorpkg.ErrInvalidAuditCursor)
+		}
+	}
+}
+
+func TestAuditListCapsThePageSize(t *testing.T) {
+	s, _ := newAuditService(t, config.AuditConfig{})
+	for i := 0; i < audit.MaxPageSize+1; i++ {
+		s.Record(context.Background(), audit.NewEvent(audit.ActionLogin, audit.OutcomeSuccess, audit.AnonymousActor, 0))
+	}
+
+	page := listAudit(t, s, audit.Filter{Limit: 10 * audit.MaxPageSize}, "")
+	if len(page.Events) != audit.MaxPageSize || page.NextCursor == "" {
+		t.Fatalf("%d events and cursor %q, want %d and a next page", len(page.Events), page.NextCursor, audit.MaxPageSize)
+	}
+	if page := listAudit(t, s, audit.Filter{}, ""); len(page.Events) != defaultAuditPageSize {
+		t.Fatalf("%d events by default, want %d", len(page.Events), defaultAuditPageSize)
+	}
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	"github.com/imnzr/user-authentication-go/pkg/syslog"
+)
+
+// Payload formats
+const (
+	SyslogFormatCEF  = "cef"
+	SyslogFormatJSON = "json"
+)
+
+// CEF header values identifying this service
+const (
+	cefVendor  = "imnzr"
+	cefProduct = "user-authentication-go"
+	cefVersion = "1.0"
+)
+
+var cefNames = map[string]string{
+	audit.ActionSignup:           "User signup",
+	audit.ActionEmailVerified:    "Email verified",
+	audit.ActionLogin:            "User login",
+	audit.ActionLogout:           "User logout",
+	audit.ActionLogoutAll:        "All sessions revoked",
+	audit.ActionPasswordForgot:   "Password reset requested",
+	audit.ActionPasswordReset:    "Password reset",
+	audit.ActionPasswordChanged:  "Password changed",
+	audit.ActionAccountLocked:    "Account locked",
+	audit.ActionAccountUnlocked:  "Account unlocked",
+	audit.ActionAccountSuspended: "Account suspended",
+	audit.ActionSessionRevoked:   "Session revoked",
+
+	audit.ActionWebhookCreated:       "Webhook subscription created",
+	audit.ActionWebhookDeleted:       "Webhook subscription deleted",
+	audit.ActionWebhookSecretRotated: "Webhook secret rotated",
+	audit.ActionWebhookReplayed:      "Webhook delivery replayed",
+}
+
+type syslogExporter struct {
+	writer  *syslog.Writer
+	format  string
+	actions []string
+}
+
+func NewSyslogExporter(writer *syslog.Writer, cfg config.SyslogConfig) (audit.Exporter, error) {
+	if cfg.Format != SyslogFormatCEF && cfg.Format != SyslogFormatJSON {
+		return nil, fmt.Errorf("unsupported syslog format %q", cfg.Format)
+	}
+	return &syslogExporter{
+		writer:  writer,
+		format:  cfg.Format,
+		actions: cfg.Actions,
+	}, nil
+}
+
+// Export implements audit.Exporter.
+func (e *syslogExporter) Export(event *audit.Event) {
+	if !e.wanted(event.Action) {
+		return
+	}
+
+	var body []byte
+	if e.format == SyslogFormatJSON {
+		encoded, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		body = encoded
+	} else {
+		body = []byte(formatCEF(event))
+	}
+
+	e.writer.Send(syslogSeverity(event), event.Action, body)
+}
+
+func (e *syslogExporter) wanted(action string) bool {
+	if len(e.actions) == 0 {
+		return true
+	}
+	for _, prefix := range e.actions {
+		if strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func syslogSeverity(event *audit.Event) int {
+	switch {
+	case event.Action == audit.ActionAccountLocked, event.Action == audit.ActionAccountSuspended:
+		return syslog.SeverityWarning
+	// A new subscription starts sending user data to another system
+	case event.Outcome == audit.OutcomeFailure, event.Action == audit.ActionWebhookCreated:
+		return syslog.SeverityNotice
+	}
+	return syslog.SeverityInfo
+}
+
+// cefSeverity uses the CEF 0-10 scale
+func cefSeverity(event *audit.Event) int {
+	switch {
+	case event.Action == audit.ActionAccountLocked:
+		return 7
+	case event.Action == audit.ActionAccountSuspended:
+		return 6
+	case event.Outcome == audit.OutcomeFailure, event.Action == audit.ActionWebhookCreated:
+		return 5
+	}
+	return 3
+}
+
+// formatCEF renders the event in ArcSight Common Event Format
+func formatCEF(event *audit.Event) string {
+	name := cefNames[event.Action]
+	if name == "" {
+		name = event.Action
+	}
+
+	ext := []string{
+		"rt=" + strconv.FormatInt(event.CreatedAt.UnixMilli(), 10),
+		"act=" + cefExtension(event.Action),
+		"outcome=" + cefExtension(event.Outcome),
+		"suser=" + cefExtension(event.Actor),
+	}
+	if event.Id != 0 {
+		ext = append(ext, "externalId="+strconv.FormatInt(event.Id, 10))
+	}
+	if event.ActorId != nil {
+		ext = append(ext, "suid="+strconv.Itoa(*event.ActorId))
+	}
+	if event.TargetId != nil {
+		ext = append(ext, "duid="+strconv.Itoa(*event.TargetId))
+	}
+	if event.IPAddress != "" {
+		ext = append(ext, "src="+cefExtension(event.IPAddress))
+	}
+	if event.UserAgent != "" {
+		ext = append(ext, "requestClientApplication="+cefExtension(event.UserAgent))
+	}
+	if event.RequestId != "" {
+		ext = append(ext, "cs1Label=requestId", "cs1="+cefExtension(event.RequestId))
+	}
+	if reason, ok := event.Metadata["reason"].(string); ok {
+		ext = append(ext, "cs2Label=reason", "cs2="+cefExtension(reason))
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeader(cefVendor),
+		cefHeader(cefProduct),
+		cefHeader(cefVersion),
+		cefHeader(event.Action),
+		cefHeader(name),
+		cefSeverity(event),
+		strings.Join(ext, " "),
+	)
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+func cefHeader(value string) string {
+	return cefHeaderEscaper.Replace(value)
+}
+
+func cefExtension(value string) string {
+	return cefExtensionEscaper.Replace(value)
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	"github.com/imnzr/user-authentication-go/pkg/syslog"
+)
+
+// udpCollector receives what an exporter sends over UDP
+type udpCollector struct {
+	conn net.PacketConn
+}
+
+func newSyslogExporter(t *testing.T, cfg config.SyslogConfig) (audit.Exporter, *udpCollector) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	writer, err := syslog.New(syslog.Config{
+		Network:    syslog.NetworkUDP,
+		Address:    conn.LocalAddr().String(),
+		AppName:    "auth",
+		Facility:   syslog.FacilityAuthPriv,
+		BufferSize: 16,
+	}, nil)
+	if err != nil {
+		t.Fatalf("syslog.New: %v", err)
+	}
+	t.Cleanup(writer.Close)
+
+	exporter, err := NewSyslogExporter(writer, cfg)
+	if err != nil {
+		t.Fatalf("NewSyslogExporter: %v", err)
+	}
+	return exporter, &udpCollector{conn: conn}
+}
+
+// next returns the priority and body of the next message, empty when none arrives
+func (c *udpCollector) next(t *testing.T, wait time.Duration) (string, string) {
+	t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(wait))
+	buf := make([]byte, 8192)
+	n, _, err := c.conn.ReadFrom(buf)
+	if err != nil {
+		return "", ""
+	}
+	message := string(buf[:n])
+	priority := message[1:strings.Index(message, ">")]
+	_, body, _ := strings.Cut(message, " - ")
+	return priority, body
+}
+
+func testAuditEvent() *audit.Event {
+	event := audit.NewEvent(audit.ActionLogin, audit.OutcomeFailure, audit.AnonymousActor, 42).
+		With("reason", "invalid_password")
+	event.Id = 7
+	event.IPAddress = "203.0.113.7"
+	event.UserAgent = "curl/8.0 a=b|c\\d\nnext"
+	event.RequestId = "req-1"
+	event.CreatedAt = time.UnixMilli(1700000000123)
+	return event
+}
+
+func TestFormatCEF(t *testing.T) {
+	got := formatCEF(testAuditEvent())
+
+	want := `CEF:0|imnzr|user-authentication-go|1.0|auth.login|User login|5|` +
+		`rt=1700000000123 act=auth.login outcome=failure suser=anonymous externalId=7 duid=42 src=203.0.113.7 ` +
+		`requestClientApplication=curl/8.0 a\=b|c\\d\nnext cs1Label=requestId cs1=req-1 cs2Label=reason cs2=invalid_password`
+	if got != want {
+		t.Fatalf("formatCEF =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatCEFEscapesTheHeader(t *testing.T) {
+	event := audit.NewEvent("custom|action\nx", audit.OutcomeSuccess, audit.UserActor(1), 0)
+
+	// Unknown actions are named after themselves, a pipe in them can't start a new field
+	got := formatCEF(event)
+	if strings.Contains(got, "\n") || !strings.Contains(got, `|custom\|action x|custom\|action x|3|`) {
+		t.Fatalf("formatCEF = %q", got)
+	}
+}
+
+func TestCEFSeverity(t *testing.T) {
+	cases := []struct {
+		event *audit.Event
+		cef   int
+		sys   int
+	}{
+		{audit.NewEvent(audit.ActionAccountLocked, audit.OutcomeSuccess, audit.SystemActor, 1), 7, syslog.SeverityWarning},
+		{audit.NewEvent(audit.ActionAccountSuspended, audit.OutcomeSuccess, audit.AdminActor(2), 1), 6, syslog.SeverityWarning},
+		{audit.NewEvent(audit.ActionLogin, audit.OutcomeFailure, audit.AnonymousActor, 0), 5, syslog.SeverityNotice},
+		{audit.NewEvent(audit.ActionWebhookCreated, audit.OutcomeSuccess, audit.AdminActor(2), 0), 5, syslog.SeverityNotice},
+		{audit.NewEvent(audit.ActionLogin, audit.OutcomeSuccess, audit.UserActor(1), 1), 3, syslog.SeverityInfo},
+	}
+	for _, tc := range cases {
+		if got := cefSeverity(tc.event); got != tc.cef {
+			t.Fatalf("cefSeverity(%s %s) = %d, want %d", tc.event.Action, tc.event.Outcome, got, tc.cef)
+		}
+		if got := syslogSeverity(tc.event); got != tc.sys {
+			t.Fatalf("syslogSeverity(%s %s) = %d, want %d", tc.event.Action, tc.event.Outcome, got, tc.sys)
+		}
+	}
+}
+
+func TestSyslogExporterSendsCEF(t *testing.T) {
+	exporter, collector := newSyslogExporter(t, config.SyslogConfig{Format: SyslogFormatCEF})
+
+	event := testAuditEvent()
+	exporter.Export(event)
+
+	priority, body := collector.next(t, 5*time.Second)
+	// authpriv (10) * 8 + notice (5)
+	if priority != "85" || body != formatCEF(event) {
+		t.Fatalf("message <%s> %q", priority, body)
+	}
+}
+
+func TestSyslogExporterSendsJSON(t *testing.T) {
+	exporter, collector := newSyslogExporter(t, config.SyslogConfig{Format: SyslogFormatJSON})
+
+	exporter.Export(testAuditEvent())
+
+	_, body := collector.next(t, 5*time.Second)
+	var got audit.Event
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("body %q is not JSON: %v", body, err)
+	}
+	if got.Id != 7 || got.Action != audit.ActionLogin || *got.TargetId != 42 || got.Metadata["reason"] != "invalid_password" {
+		t.Fatalf("event = %+v", got)
+	}
+}
+
+func TestSyslogExporterFiltersActions(t *testing.T) {
+	exporter, collector := newSyslogExporter(t, config.SyslogConfig{Format: SyslogFormatCEF, Actions: []string{"account.", "webhook."}})
+
+	exporter.Export(audit.NewEvent(audit.ActionLogin, audit.OutcomeSuccess, audit.UserActor(1), 1))
+	exporter.Export(audit.NewEvent(audit.ActionAccountLocked, audit.OutcomeSuccess, audit.SystemActor, 1))
+
+	if _, body := collector.next(t, 5*time.Second); !strings.Contains(body, "|account.locked|") {
+		t.Fatalf("first message = %q, want the lock", body)
+	}
+	if _, body := collector.next(t, 100*time.Millisecond); body != "" {
+		t.Fatalf("unexpected message %q", body)
+	}
+}
+
+func TestNewSyslogExporterRejectsUnknownFormats(t *testing.T) {
+	if _, err := NewSyslogExporter(nil, config.SyslogConfig{Format: "leef"}); err == nil {
+		t.Fatal("NewSyslogExporter accepted an unknown format")
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/domain/device"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/pkg/auth"
+	"github.com/imnzr/user-authentication-go/pkg/mailer"
+	"go.uber.org/zap"
+)
+
+type deviceService struct {
+	deviceRepo  device.Repository
+	authManager auth.AuthManager
+	mailer      mailer.Mailer
+	baseURL     string
+	logger      *zap.Logger
+}
+
+func NewDeviceService(deviceRepo device.Repository, authManager auth.AuthManager, mailer mailer.Mailer, cfg *config.Config, logger *zap.Logger) device.Service {
+	return &deviceService{
+		deviceRepo:  deviceRepo,
+		authManager: authManager,
+		mailer:      mailer,
+		baseURL:     cfg.Server.BaseURL,
+		logger:      logger,
+	}
+}
+
+// RecordLogin implements device.Service.
+func (s *deviceService) RecordLogin(ctx context.Context, userId int, email string, ipAddress string, userAgent string) error {
+	fingerprint := device.Fingerprint(ipAddress, userAgent)
+
+	known, err := s.deviceRepo.GetByFingerprint(ctx, userId, fingerprint)
+	if err == nil {
+		return s.deviceRepo.Touch(ctx, known.Id)
+	}
+	if !errors.Is(err, errorpkg.ErrDeviceNotFound) {
+		return err
+	}
+
+	// The first device a user ever logs in from is trusted without an alert
+	count, err := s.deviceRepo.CountByUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	newDevice := &device.KnownDevice{
+		UserId:      userId,
+		Fingerprint: fingerprint,
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+	}
+	if err := s.deviceRepo.Create(ctx, newDevice); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		s.sendNewDeviceAlert(userId, email, ipAddress, userAgent, time.Now().UTC())
+	}
+
+	return nil
+}
+
+// ForgetAll implements device.Service.
+func (s *deviceService) ForgetAll(ctx context.Context, userId int) error {
+	return s.deviceRepo.DeleteByUser(ctx, userId)
+}
+
+// sendNewDeviceAlert mails in the background so a slow SMTP server never delays the login
+func (s *deviceService) sendNewDeviceAlert(userId int, email, ipAddress, userAgent string, loginAt time.Time) {
+	go func() {
+		ctx := context.Background()
+
+		token, err := s.authManager.GenerateDeviceRevokeToken(ctx, userId)
+		if err != nil {
+			s.logger.Error("failed to generate device revoke token", zap.Int("user_id", userId), zap.Error(err))
+			return
+		}
+		notMeLink := fmt.Sprintf("%s/api/v1/auth/not-me/%s", s.baseURL, token)
+
+		body := fmt.Sprintf(
+			"We noticed a new sign-in to your account.\n\n"+
+				"When: %s\n"+
+				"IP address: %s\n"+
+				"Device: %s\n\n"+
+				"If this was you, you can ignore this email.\n\n"+
+				"If this wasn't you, open the link below and confirm. It signs out every session and requires a password reset:\n%s\n",
+			loginAt.Format(time.RFC1123),
+			ipAddress,
+			userAgent,
+			notMeLink,
+		)
+
+		if err := s.mailer.Send(ctx, email, "New sign-in to your account", body); err != nil {
+			s.logger.Error("failed to send new device alert", zap.Int("user_id", userId), zap.Error(err))
+		}
+	}()
+}
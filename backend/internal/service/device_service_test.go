@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/domain/device"
+	"github.com/imnzr/user-authentication-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+func TestFingerprint(t *testing.T) {
+	laptop := device.Fingerprint("203.0.113.7", "Firefox")
+
+	if got := device.Fingerprint("203.0.113.7", "Firefox"); got != laptop {
+		t.Fatal("the same device has two fingerprints")
+	}
+	if device.Fingerprint("203.0.113.8", "Firefox") == laptop || device.Fingerprint("203.0.113.7", "Chrome") == laptop {
+		t.Fatal("another IP or user-agent has the same fingerprint")
+	}
+	// The raw IP and user-agent are not stored in the fingerprint
+	if len(laptop) != 64 || strings.Contains(laptop, "203.0.113.7") {
+		t.Fatalf("fingerprint %q is not a hex sha-256", laptop)
+	}
+}
+
+func assertNoMail(t *testing.T, mails chanMailer) {
+	t.Helper()
+
+	select {
+	case mail := <-mails:
+		t.Fatalf("unexpected mail %q", mail.subject)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDeviceServiceAlertsOnNewDevices(t *testing.T) {
+	f := newUserFixture(t, testConfig())
+	alice := f.createUser(t, "alice@example.com")
+	bob := f.createUser(t, "bob@example.com")
+	mails := make(chanMailer, 4)
+	devices := NewDeviceService(repository.NewDeviceRepository(f.db), f.authManager, mails, f.cfg, zap.NewNop())
+	ctx := context.Background()
+
+	record := func(ip, userAgent string) {
+		t.Helper()
+		if err := devices.RecordLogin(ctx, alice.Id, alice.Email, ip, userAgent); err != nil {
+			t.Fatalf("RecordLogin: %v", err)
+		}
+	}
+
+	// The first device ever is trusted, seeing it again is not news either
+	record("203.0.113.7", "laptop")
+	record("203.0.113.7", "laptop")
+	assertNoMail(t, mails)
+
+	record("198.51.100.2", "phone")
+	alert := waitForMail(t, mails, "New sign-in to your account")
+	if alert.to != alice.Email || !strings.Contains(alert.body, "198.51.100.2") || !strings.Contains(alert.body, "phone") {
+		t.Fatalf("alert = %+v", alert)
+	}
+	claims, err := f.authManager.VerifyToken(ctx, linkToken(t, alert.body, "/api/v1/auth/not-me/"))
+	if err != nil {
+		t.Fatalf("not-me link: %v", err)
+	}
+	if claims["type"] != "device_revoke" || claims["user_id"] != float64(alice.Id) || claims["jti"] == "" {
+		t.Fatalf("not-me claims = %v", claims)
+	}
+
+	// Another user's devices are their own
+	if err := devices.RecordLogin(ctx, bob.Id, bob.Email, "198.51.100.2", "phone"); err != nil {
+		t.Fatal(err)
+	}
+	assertNoMail(t, mails)
+
+	// Forgotten devices alert again, except the first one which is trusted anew
+	if err := devices.ForgetAll(ctx, alice.Id); err != nil {
+		t.Fatalf("ForgetAll: %v", err)
+	}
+	record("198.51.100.2", "phone")
+	assertNoMail(t, mails)
+	record("203.0.113.7", "laptop")
+	waitForMail(t, mails, "New sign-in to your account")
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	"github.com/imnzr/user-authentication-go/internal/domain/lockout"
+	"github.com/imnzr/user-authentication-go/internal/domain/user"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+	"github.com/imnzr/user-authentication-go/pkg/auth"
+	"github.com/imnzr/user-authentication-go/pkg/mailer"
+	"go.uber.org/zap"
+)
+
+type lockoutService struct {
+	userRepo    user.Repository
+	authManager auth.AuthManager
+	redisRepo   redis.Client
+	mailer      mailer.Mailer
+	audit       audit.Recorder
+	cfg         config.LockoutConfig
+	baseURL     string
+	logger      *zap.Logger
+}
+
+func NewLockoutService(userRepo user.Repository, authManager auth.AuthManager, redisRepo redis.Client, mailer mailer.Mailer, recorder audit.Recorder, cfg *config.Config, logger *zap.Logger) lockout.Service {
+	return &lockoutService{
+		userRepo:    userRepo,
+		authManager: authManager,
+		redisRepo:   redisRepo,
+		mailer:      mailer,
+		audit:       recorder,
+		cfg:         cfg.Lockout,
+		baseURL:     cfg.Server.BaseURL,
+		logger:      logger,
+	}
+}
+
+// Check implements lockout.Service.
+func (s *lockoutService) Check(ctx context.Context, u *user.User) error {
+	if u.LockedUntil == nil {
+		return nil
+	}
+	return lockoutError(*u.LockedUntil, u.FailedLoginAttempts)
+}
+
+// lockoutError is what Check answers while a sign-in has to wait until lockedUntil
+func lockoutError(lockedUntil time.Time, attempts int) error {
+	wait := time.Until(lockedUntil)
+	if wait <= 0 {
+		return nil
+	}
+
+	// A lock is always set together with an attempts reset, a delay never is
+	if attempts == 0 {
+		return &errorpkg.RetryAfterError{Err: errorpkg.ErrAccountLocked, RetryAfter: wait}
+	}
+	return &errorpkg.RetryAfterError{Err: errorpkg.ErrLoginThrottled, RetryAfter: wait}
+}
+
+// RecordFailure implements lockout.Service.
+func (s *lockoutService) RecordFailure(ctx context.Context, u *user.User) error {
+	attempts, err := s.userRepo.IncrementFailedLogins(ctx, u.Id)
+	if err != nil {
+		return err
+	}
+
+	wait, locks := s.schedule(attempts)
+	if locks {
+		until := time.Now().Add(wait)
+		if err := s.userRepo.SetLockedUntil(ctx, u.Id, until, true); err != nil {
+			return err
+		}
+		s.audit.Record(ctx, audit.NewEvent(audit.ActionAccountLocked, audit.OutcomeSuccess, audit.SystemActor, u.Id).
+			With("failed_attempts", attempts).
+			With("locked_until", until.UTC()))
+		s.sendUnlockEmail(u.Id, u.Email, until)
+		return nil
+	}
+
+	if wait > 0 {
+		return s.userRepo.SetLockedUntil(ctx, u.Id, time.Now().Add(wait), false)
+	}
+
+	return nil
+}
+
+// CheckEmail implements lockout.Service.
+// Without Redis an unknown email is not throttled, the lookup error is only logged.
+func (s *lockoutService) CheckEmail(ctx context.Context, emailIndex string) error {
+	lockedUntil, err := s.redisRepo.Get(ctx, redis.LoginLockedUntilKey(emailIndex))
+	if err != nil {
+		if !redis.IsNil(err) {
+			s.logger.Warn("failed to check sign-in throttle", zap.Error(err))
+		}
+		return nil
+	}
+	until, err := strconv.ParseInt(lockedUntil, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	attempts := 0
+	if count, err := s.redisRepo.Get(ctx, redis.LoginFailuresKey(emailIndex)); err == nil {
+		attempts, _ = strconv.Atoi(count)
+	}
+	return lockoutError(time.Unix(0, until), attempts)
+}
+
+// RecordEmailFailure implements lockout.Service.
+func (s *lockoutService) RecordEmailFailure(ctx context.Context, emailIndex string) error {
+	failuresKey := redis.LoginFailuresKey(emailIndex)
+	attempts, err := s.redisRepo.Incr(ctx, failuresKey, int64(math.Ceil(s.cfg.Cooldown.Seconds())))
+	if err != nil {
+		return err
+	}
+
+	wait, locks := s.schedule(int(attempts))
+	if wait <= 0 {
+		return nil
+	}
+	until := strconv.FormatInt(time.Now().Add(wait).UnixNano(), 10)
+	if err := s.redisRepo.Set(ctx, redis.LoginLockedUntilKey(emailIndex), until, int64(math.Ceil(wait.Seconds()))); err != nil {
+		return err
+	}
+	if locks {
+		return s.redisRepo.Del(ctx, failuresKey)
+	}
+	return nil
+}
+
+// schedule is how long sign-in waits after the given number of failed attempts and whether
+// that wait is a lock, which starts the count again
+func (s *lockoutService) schedule(attempts int) (time.Duration, bool) {
+	if attempts >= s.cfg.Threshold {
+		return s.cfg.Cooldown, true
+	}
+	if attempts >= s.cfg.DelayAfter {
+		return s.delay(attempts), false
+	}
+	return 0, false
+}
+
+// delay doubles for every failed attempt past DelayAfter up to MaxDelay
+func (s *lockoutService) delay(attempts int) time.Duration {
+	wait := s.cfg.BaseDelay
+	for i := s.cfg.DelayAfter; i < attempts; i++ {
+		wait *= 2
+		if wait >= s.cfg.MaxDelay {
+			return s.cfg.MaxDelay
+		}
+	}
+	return wait
+}
+
+// RecordSuccess implements lockout.Service.
+func (s *lockoutService) RecordSuccess(ctx context.Context, u *user.User) error {
+	if u.FailedLoginAttempts == 0 && u.LockedUntil == nil {
+		return nil
+	}
+	return s.userRepo.ClearLockout(ctx, u.Id)
+}
+
+// Unlock implements lockout.Service.
+func (s *lockoutService) Unlock(ctx context.Context, userId int, actor audit.Actor) error {
+	if _, err := s.userRepo.GetById(ctx, userId); err != nil {
+		return err
+	}
+	if err := s.userRepo.ClearLockout(ctx, userId); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionAccountUnlocked, audit.OutcomeSuccess, actor, userId))
+	return nil
+}
+
+// CheckUnlockToken implements lockout.Service.
+func (s *lockoutService) CheckUnlockToken(ctx context.Context, tokenString string) error {
+	_, err := checkSingleUseToken(ctx, s.authManager, s.redisRepo, tokenString, "account_unlock")
+	return err
+}
+
+// UnlockWithToken implements lockout.Service.
+func (s *lockoutService) UnlockWithToken(ctx context.Context, tokenString string) (err error) {
+	userId, release, err := useSingleUseToken(ctx, s.authManager, s.redisRepo, tokenString, "account_unlock")
+	if err != nil {
+		return err
+	}
+	// The user can follow the link again when the unlock failed
+	defer func() {
+		if err != nil {
+			release()
+		}
+	}()
+
+	if err := s.Unlock(ctx, userId, audit.EmailLinkActor); err != nil {
+		if errors.Is(err, errorpkg.ErrUserNotFound) {
+			return errorpkg.ErrInvalidLink
+		}
+		return err
+	}
+	return nil
+}
+
+// sendUnlockEmail mails in the background so the failed login is not delayed
+func (s *lockoutService) sendUnlockEmail(userId int, email string, until time.Time) {
+	go func() {
+		ctx := context.Background()
+
+		token, err := s.authManager.GenerateUnlockToken(ctx, userId)
+		if err != nil {
+			s.logger.Error("failed to generate unlock token", zap.Int("user_id", userId), zap.Error(err))
+			return
+		}
+		unlockLink := fmt.Sprintf("%s/api/v1/auth/unlock/%s", s.baseURL, token)
+
+		body := fmt.Sprintf(
+			"Your account was locked after too many failed sign-in attempts.\n\n"+
+				"It unlocks automatically at %s.\n\n"+
+				"If it was you, you can open the link below and confirm to unlock it now:\n%s\n\n"+
+				"If it wasn't you, someone may be guessing your password. Consider resetting it.\n",
+			until.UTC().Format(time.RFC1123),
+			unlockLink,
+		)
+
+		if err := s.mailer.Send(ctx, email, "Your account has been locked", body); err != nil {
+			s.logger.Error("failed to send unlock email", zap.Int("user_id", userId), zap.Error(err))
+		}
+	}()
+}
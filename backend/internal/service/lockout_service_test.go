@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	"github.com/imnzr/user-authentication-go/internal/domain/lockout"
+	"github.com/imnzr/user-authentication-go/internal/domain/user"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+	"go.uber.org/zap"
+)
+
+var errClearLockout = errors.New("clear lockout failed")
+
+// clearFailure fails the next ClearLockout when fail is set
+type clearFailure struct {
+	user.Repository
+	fail bool
+}
+
+func (r *clearFailure) ClearLockout(ctx context.Context, userId int) error {
+	if r.fail {
+		r.fail = false
+		return errClearLockout
+	}
+	return r.Repository.ClearLockout(ctx, userId)
+}
+
+type lockoutFixture struct {
+	*userFixture
+	lockout lockout.Service
+	repo    *clearFailure
+	user    *user.User
+}
+
+func newLockoutFixture(t *testing.T) *lockoutFixture {
+	t.Helper()
+
+	f := &lockoutFixture{userFixture: newUserFixture(t, testConfig())}
+	f.repo = &clearFailure{Repository: f.users}
+	f.lockout = NewLockoutService(f.repo, f.authManager, f.redis, f.mails, f.recorder, f.cfg, zap.NewNop())
+	f.user = f.createUser(t, "alice@example.com")
+	return f
+}
+
+// current reads the user again, the service works on what sign-in loaded
+func (f *lockoutFixture) current(t *testing.T) *user.User {
+	t.Helper()
+	return f.reload(t, f.user.Id)
+}
+
+func (f *lockoutFixture) fail(t *testing.T, times int) {
+	t.Helper()
+
+	for i := 0; i < times; i++ {
+		if err := f.lockout.RecordFailure(context.Background(), f.current(t)); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+}
+
+func (f *lockoutFixture) unlockToken(t *testing.T) string {
+	t.Helper()
+
+	f.fail(t, f.cfg.Lockout.Threshold)
+	mail := waitForMail(t, f.mails, "Your account has been locked")
+	if mail.to != f.user.Email {
+		t.Fatalf("unlock mail sent to %q", mail.to)
+	}
+	return linkToken(t, mail.body, "/api/v1/auth/unlock/")
+}
+
+func assertRetryAfter(t *testing.T, err error, want error, min time.Duration, max time.Duration) {
+	t.Helper()
+
+	var retryErr *errorpkg.RetryAfterError
+	if !errors.Is(err, want) || !errors.As(err, &retryErr) {
+		t.Fatalf("Check = %v, want %v", err, want)
+	}
+	if retryErr.RetryAfter < min || retryErr.RetryAfter > max {
+		t.Fatalf("RetryAfter = %v, want between %v and %v", retryErr.RetryAfter, min, max)
+	}
+}
+
+func TestLockoutDelaysThenLocks(t *testing.T) {
+	f := newLockoutFixture(t)
+	ctx := context.Background()
+
+	f.fail(t, 1)
+	if err := f.lockout.Check(ctx, f.current(t)); err != nil {
+		t.Fatalf("Check after 1 failure = %v, want nil", err)
+	}
+
+	// Past DelayAfter the delay doubles with every attempt up to MaxDelay
+	f.fail(t, 1)
+	assertRetryAfter(t, f.lockout.Check(ctx, f.current(t)), errorpkg.ErrLoginThrottled, 0, time.Second)
+	f.fail(t, 1)
+	assertRetryAfter(t, f.lockout.Check(ctx, f.current(t)), errorpkg.ErrLoginThrottled, time.Second, 2*time.Second)
+	f.fail(t, 1)
+	assertRetryAfter(t, f.lockout.Check(ctx, f.current(t)), errorpkg.ErrLoginThrottled, 3*time.Second, 4*time.Second)
+
+	f.fail(t, 1)
+	locked := f.current(t)
+	if locked.FailedLoginAttempts != 0 {
+		t.Fatalf("FailedLoginAttempts = %d after the lock, want 0", locked.FailedLoginAttempts)
+	}
+	assertRetryAfter(t, f.lockout.Check(ctx, locked), errorpkg.ErrAccountLocked, 14*time.Minute, 15*time.Minute)
+
+	if actions := f.recorder.actions(); len(actions) != 1 || actions[0] != audit.ActionAccountLocked {
+		t.Fatalf("audit actions = %v, want [%s]", actions, audit.ActionAccountLocked)
+	}
+	waitForMail(t, f.mails, "Your account has been locked")
+}
+
+func TestLockoutClearedBySuccess(t *testing.T) {
+	f := newLockoutFixture(t)
+	ctx := context.Background()
+
+	f.fail(t, 3)
+	if err := f.lockout.RecordSuccess(ctx, f.current(t)); err != nil {
+		t.Fatalf("RecordSuccess: %v", err)
+	}
+
+	u := f.current(t)
+	if u.FailedLoginAttempts != 0 || u.LockedUntil != nil {
+		t.Fatalf("after RecordSuccess attempts = %d, locked until %v, want cleared", u.FailedLoginAttempts, u.LockedUntil)
+	}
+	if err := f.lockout.Check(ctx, u); err != nil {
+		t.Fatalf("Check = %v, want nil", err)
+	}
+}
+
+func TestLockoutExpires(t *testing.T) {
+	f := newLockoutFixture(t)
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	if err := f.users.SetLockedUntil(ctx, f.user.Id, past, true); err != nil {
+		t.Fatalf("SetLockedUntil: %v", err)
+	}
+	if err := f.lockout.Check(ctx, f.current(t)); err != nil {
+		t.Fatalf("Check of an expired lock = %v, want nil", err)
+	}
+}
+
+func TestUnlockWithToken(t *testing.T) {
+	f := newLockoutFixture(t)
+	ctx := context.Background()
+	token := f.unlockToken(t)
+
+	// Opening the link changes nothing and can be repeated
+	for i := 0; i < 2; i++ {
+		if err := f.lockout.CheckUnlockToken(ctx, token); err != nil {
+			t.Fatalf("CheckUnlockToken: %v", err)
+		}
+	}
+	if f.lockout.Check(ctx, f.current(t)) == nil {
+		t.Fatal("checking the link unlocked the account")
+	}
+
+	if err := f.lockout.UnlockWithToken(ctx, "not-a-token"); !errors.Is(err, errorpkg.ErrInvalidLink) {
+		t.Fatalf("UnlockWithToken of a bad token = %v, want %v", err, errorpkg.ErrInvalidLink)
+	}
+	if err := f.lockout.UnlockWithToken(ctx, token); err != nil {
+		t.Fatalf("UnlockWithToken: %v", err)
+	}
+	if err := f.lockout.Check(ctx, f.current(t)); err != nil {
+		t.Fatalf("Check after unlock = %v, want nil", err)
+	}
+
+	actions := f.recorder.actions()
+	if len(actions) != 2 || actions[1] != audit.ActionAccountUnlocked {
+		t.Fatalf("audit actions = %v, want the unlock last", actions)
+	}
+	if actor := f.recorder.events[1].Actor; actor != audit.ActorEmailLink {
+		t.Fatalf("unlock actor = %q, want %q", actor, audit.ActorEmailLink)
+	}
+}
+
+func TestUnlockTokenWorksOnce(t *testing.T) {
+	f := newLockoutFixture(t)
+	ctx := context.Background()
+	token := f.unlockToken(t)
+
+	if err := f.lockout.UnlockWithToken(ctx, token); err != nil {
+		t.Fatalf("UnlockWithToken: %v", err)
+	}
+
+	// Locked again, the old link must not lift the new lock
+	f.fail(t, f.cfg.Lockout.Threshold)
+	if err := f.lockout.UnlockWithToken(ctx, token); !errors.Is(err, errorpkg.ErrInvalidLink) {
+		t.Fatalf("second UnlockWithToken = %v, want %v", err, errorpkg.ErrInvalidLink)
+	}
+	if err := f.lockout.CheckUnlockToken(ctx, token); !errors.Is(err, errorpkg.ErrInvalidLink) {
+		t.Fatalf("CheckUnlockToken of a used link = %v, want %v", err, errorpkg.ErrInvalidLink)
+	}
+	assertRetryAfter(t, f.lockout.Check(ctx, f.current(t)), errorpkg.ErrAccountLocked, 14*time.Minute, 15*time.Minute)
+}
+
+func TestUnlockTokenIsReleasedWhenTheUnlockFails(t *testing.T) {
+	f := newLockoutFixture(t)
+	ctx := context.Background()
+	token := f.unlockToken(t)
+
+	f.repo.fail = true
+	if err := f.lockout.UnlockWithToken(ctx, token); !errors.Is(err, errClearLockout) {
+		t.Fatalf("UnlockWithToken = %v, want %v", err, errClearLockout)
+	}
+	// The user can follow the link again
+	if err := f.lockout.UnlockWithToken(ctx, token); err != nil {
+		t.Fatalf("UnlockWithToken after a failure: %v", err)
+	}
+	if err := f.lockout.Check(ctx, f.current(t)); err != nil {
+		t.Fatalf("Check after unlock = %v, want nil", err)
+	}
+}
+
+func TestUnlockRejectsOtherTokens(t *testing.T) {
+	f := newLockoutFixture(t)
+	ctx := context.Background()
+
+	notMe, err := f.authManager.GenerateDeviceRevokeToken(ctx, f.user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.lockout.UnlockWithToken(ctx, notMe); !errors.Is(err, errorpkg.ErrInvalidLink) {
+		t.Fatalf("UnlockWithToken of a not-me token = %v, want %v", err, errorpkg.ErrInvalidLink)
+	}
+}
+
+func TestEmailLockoutFollowsTheAccountSchedule(t *testing.T) {
+	f := newLockoutFixture(t)
+	ctx := context.Background()
+	emailIndex := f.users.EmailIndex("nobody@example.com")
+
+	for attempt := 1; attempt <= f.cfg.Lockout.Threshold; attempt++ {
+		f.fail(t, 1)
+		if err := f.lockout.RecordEmailFailure(ctx, emailIndex); err != nil {
+			t.Fatalf("RecordEmailFailure: %v", err)
+		}
+
+		accountErr := f.lockout.Check(ctx, f.current(t))
+		emailErr := f.lockout.CheckEmail(ctx, emailIndex)
+		if accountErr == nil || emailErr == nil {
+			if accountErr != emailErr {
+				t.Fatalf("after %d failures Check = %v, CheckEmail = %v", attempt, accountErr, emailErr)
+			}
+			continue
+		}
+
+		var accountRetry, emailRetry *errorpkg.RetryAfterError
+		errors.As(accountErr, &accountRetry)
+		if !errors.As(emailErr, &emailRetry) || !errors.Is(emailErr, accountRetry.Err) {
+			t.Fatalf("after %d failures Check = %v, CheckEmail = %v", attempt, accountErr, emailErr)
+		}
+		if diff := accountRetry.RetryAfter - emailRetry.RetryAfter; diff > time.Second || diff < -time.Second {
+			t.Fatalf("after %d failures RetryAfter = %v and %v", attempt, accountRetry.RetryAfter, emailRetry.RetryAfter)
+		}
+	}
+
+	assertRetryAfter(t, f.lockout.CheckEmail(ctx, emailIndex), errorpkg.ErrAccountLocked, 14*time.Minute, 15*time.Minute)
+	// Nothing is mailed for an email without an account
+	waitForMail(t, f.mails, "Your account has been locked")
+	assertNoMail(t, f.mails)
+
+	// The lock expires with its key
+	if err := f.redis.Del(ctx, redis.LoginLockedUntilKey(emailIndex)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.lockout.CheckEmail(ctx, emailIndex); err != nil {
+		t.Fatalf("CheckEmail after the lock = %v, want nil", err)
+	}
+}
+
+func TestLoginThrottlesKnownAndUnknownEmailsAlike(t *testing.T) {
+	cfg := testConfig()
+	cfg.Lockout.DelayAfter = 2
+	cfg.Lockout.BaseDelay = 200 * time.Millisecond
+	cfg.Lockout.MaxDelay = 200 * time.Millisecond
+	cfg.Lockout.Threshold = 4
+	f := newUserFixture(t, cfg)
+	f.createUser(t, "alice@example.com")
+
+	attempt := func(email string) error {
+		_, err := f.login(email, "wrong password", "laptop")
+		return err
+	}
+	step := func(name string, want error) {
+		t.Helper()
+		known, unknown := attempt("alice@example.com"), attempt("nobody@example.com")
+		if !errors.Is(known, want) || !errors.Is(unknown, want) {
+			t.Fatalf("%s: known email = %v, unknown email = %v, want %v for both", name, known, unknown, want)
+		}
+		var knownRetry, unknownRetry *errorpkg.RetryAfterError
+		if errors.As(known, &knownRetry) != errors.As(unknown, &unknownRetry) {
+			t.Fatalf("%s: only one answer carries Retry-After", name)
+		}
+	}
+
+	step("first failure", errorpkg.ErrInvalidCredentials)
+	step("second failure", errorpkg.ErrInvalidCredentials)
+	step("during the delay", errorpkg.ErrLoginThrottled)
+	time.Sleep(cfg.Lockout.BaseDelay + 50*time.Millisecond)
+	step("third failure", errorpkg.ErrInvalidCredentials)
+	time.Sleep(cfg.Lockout.BaseDelay + 50*time.Millisecond)
+	step("fourth failure", errorpkg.ErrInvalidCredentials)
+	step("locked", errorpkg.ErrAccountLocked)
+
+	// The right password doesn't get past the lock either
+	if _, err := f.login("alice@example.com", testPassword, "laptop"); !errors.Is(err, errorpkg.ErrAccountLocked) {
+		t.Fatalf("login with the right password = %v, want %v", err, errorpkg.ErrAccountLocked)
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/domain/user"
+	"go.uber.org/zap"
+)
+
+type PIIReencryptResult struct {
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+}
+
+// PIIReencryptor encrypts users stored before PII encryption and rewraps data keys after the
+// master key is rotated. Rows are locked one at a time, so it can run next to the server.
+type PIIReencryptor struct {
+	userRepo  user.Repository
+	batchSize int
+	logger    *zap.Logger
+}
+
+func NewPIIReencryptor(userRepo user.Repository, cfg config.PIIConfig, logger *zap.Logger) *PIIReencryptor {
+	batchSize := cfg.ReencryptBatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &PIIReencryptor{
+		userRepo:  userRepo,
+		batchSize: batchSize,
+		logger:    logger,
+	}
+}
+
+// Run walks every stale user once. Users that fail are logged and skipped, running again retries them.
+func (r *PIIReencryptor) Run(ctx context.Context) (*PIIReencryptResult, error) {
+	result := &PIIReencryptResult{}
+
+	afterId := 0
+	for {
+		ids, err := r.userRepo.ListStalePII(ctx, afterId, r.batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			updated, err := r.userRepo.ReencryptPII(ctx, id)
+			if err != nil {
+				r.logger.Error("failed to re-encrypt user", zap.Int("user_id", id), zap.Error(err))
+				result.Failed++
+				continue
+			}
+			if updated {
+				result.Updated++
+			}
+		}
+		afterId = ids[len(ids)-1]
+	}
+
+	r.logger.Info("pii re-encryption finished", zap.Int("updated", result.Updated), zap.Int("failed", result.Failed))
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/domain/revocation"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+	"github.com/imnzr/user-authentication-go/pkg/lru"
+	"go.uber.org/zap"
+)
+
+// Kept when a token carries no usable expiry, so the entry still goes away eventually
+const minRevocationTTL = time.Minute
+
+// revocationStore keeps recent revocations in process as well as in Redis, so tokens signed
+// out shortly before an outage stay revoked while Redis is unreachable
+type revocationStore struct {
+	redisRepo redis.Client
+	recent    *lru.Cache
+	policy    string
+	logger    *zap.Logger
+}
+
+func NewRevocationStore(redisRepo redis.Client, cfg config.RedisFailureConfig, logger *zap.Logger) revocation.Store {
+	return &revocationStore{
+		redisRepo: redisRepo,
+		recent:    lru.New(cfg.RevocationCacheSize),
+		policy:    cfg.Revocation,
+		logger:    logger,
+	}
+}
+
+// remainingLifetime is how long the token is still accepted, VerifyToken rejects it after exp
+func remainingLifetime(claims jwt.MapClaims) time.Duration {
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return minRevocationTTL
+	}
+	if ttl := time.Until(exp.Time); ttl > minRevocationTTL {
+		return ttl
+	}
+	return minRevocationTTL
+}
+
+// Revoke implements revocation.Store.
+func (s *revocationStore) Revoke(ctx context.Context, token string, claims jwt.MapClaims) error {
+	ttl := remainingLifetime(claims)
+	key := redis.RevokedTokenKey(revocation.TokenId(token, claims))
+	s.recent.Add(key, time.Now().Add(ttl))
+
+	// Rounded up, the entry must not expire before the token does
+	if err := s.redisRepo.Set(ctx, key, "revoked", int64(math.Ceil(ttl.Seconds()))); err != nil {
+		// Fail open settles for the local entry, other instances won't see the revocation
+		if s.policy == config.FailOpen {
+			s.logger.Warn("failed to store revocation in redis, revoked on this instance only", zap.Error(err))
+			return nil
+		}
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked implements revocation.Store.
+func (s *revocationStore) IsRevoked(ctx context.Context, token string, claims jwt.MapClaims) (bool, error) {
+	key := redis.RevokedTokenKey(revocation.TokenId(token, claims))
+	if s.recent.Contains(key) {
+		return true, nil
+	}
+
+	revoked, err := s.redisRepo.Exists(ctx, key)
+	if err != nil {
+		if s.policy == config.FailOpen {
+			return false, nil
+		}
+		return false, err
+	}
+	if !revoked {
+		return false, nil
+	}
+
+	// Remember revocations made by other instances too
+	s.recent.Add(key, time.Now().Add(remainingLifetime(claims)))
+	return true, nil
+}
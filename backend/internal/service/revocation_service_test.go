@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/domain/revocation"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+	"go.uber.org/zap"
+)
+
+var errRedisDown = errors.New("redis is down")
+
+// downRedis fails every call a revocation makes, like an unreachable Redis
+type downRedis struct {
+	redis.Client
+}
+
+func (downRedis) Set(ctx context.Context, key string, value string, ttlSeconds int64) error {
+	return errRedisDown
+}
+
+func (downRedis) Exists(ctx context.Context, key string) (bool, error) {
+	return false, errRedisDown
+}
+
+func newRevocationStore(client redis.Client, policy string) revocation.Store {
+	return NewRevocationStore(client, config.RedisFailureConfig{Revocation: policy, RevocationCacheSize: 16}, zap.NewNop())
+}
+
+// tokenClaims are claims as VerifyToken returns them, numbers decode to float64
+func tokenClaims(jti string, expiresIn time.Duration) jwt.MapClaims {
+	return jwt.MapClaims{
+		"jti": jti,
+		"exp": float64(time.Now().Add(expiresIn).Unix()),
+	}
+}
+
+func TestRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	client := redis.NewMemoryClient()
+	store := newRevocationStore(client, config.FailClosed)
+	claims := tokenClaims("a", 10*time.Minute)
+
+	if revoked, err := store.IsRevoked(ctx, "token-a", claims); err != nil || revoked {
+		t.Fatalf("IsRevoked before Revoke = %v, %v, want false", revoked, err)
+	}
+	if err := store.Revoke(ctx, "token-a", claims); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if revoked, err := store.IsRevoked(ctx, "token-a", claims); err != nil || !revoked {
+		t.Fatalf("IsRevoked after Revoke = %v, %v, want true", revoked, err)
+	}
+	if revoked, _ := store.IsRevoked(ctx, "token-b", tokenClaims("b", 10*time.Minute)); revoked {
+		t.Fatal("another token is revoked")
+	}
+
+	// Another instance only has Redis
+	other := newRevocationStore(client, config.FailClosed)
+	if revoked, err := other.IsRevoked(ctx, "token-a", claims); err != nil || !revoked {
+		t.Fatalf("IsRevoked on another instance = %v, %v, want true", revoked, err)
+	}
+}
+
+func TestRevocationStoreKeysTokensWithoutJti(t *testing.T) {
+	ctx := context.Background()
+	client := redis.NewMemoryClient()
+	store := newRevocationStore(client, config.FailClosed)
+	claims := jwt.MapClaims{"exp": float64(time.Now().Add(time.Minute).Unix())}
+
+	if err := store.Revoke(ctx, "token-a", claims); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if revoked, _ := store.IsRevoked(ctx, "token-b", claims); revoked {
+		t.Fatal("a token with the same claims is revoked")
+	}
+
+	// The raw token is never used as a key
+	if exists, _ := client.Exists(ctx, redis.RevokedTokenKey("token-a")); exists {
+		t.Fatal("the raw token is stored")
+	}
+	if exists, _ := client.Exists(ctx, redis.RevokedTokenKey(revocation.TokenId("token-a", claims))); !exists {
+		t.Fatal("the revocation is not in redis")
+	}
+}
+
+func TestRevocationStoreWhileRedisIsDown(t *testing.T) {
+	ctx := context.Background()
+	claims := tokenClaims("a", 10*time.Minute)
+
+	t.Run("fail closed", func(t *testing.T) {
+		store := newRevocationStore(downRedis{}, config.FailClosed)
+
+		if err := store.Revoke(ctx, "token-a", claims); !errors.Is(err, errRedisDown) {
+			t.Fatalf("Revoke = %v, want %v", err, errRedisDown)
+		}
+		// Revoked here still counts, the lookup never reaches Redis
+		if revoked, err := store.IsRevoked(ctx, "token-a", claims); err != nil || !revoked {
+			t.Fatalf("IsRevoked of a token revoked here = %v, %v, want true", revoked, err)
+		}
+		if _, err := store.IsRevoked(ctx, "token-b", tokenClaims("b", time.Minute)); !errors.Is(err, errRedisDown) {
+			t.Fatalf("IsRevoked of another token = %v, want %v", err, errRedisDown)
+		}
+	})
+
+	t.Run("fail open", func(t *testing.T) {
+		store := newRevocationStore(downRedis{}, config.FailOpen)
+
+		if err := store.Revoke(ctx, "token-a", claims); err != nil {
+			t.Fatalf("Revoke = %v, want nil", err)
+		}
+		if revoked, err := store.IsRevoked(ctx, "token-a", claims); err != nil || !revoked {
+			t.Fatalf("IsRevoked of a token revoked here = %v, %v, want true", revoked, err)
+		}
+		if revoked, err := store.IsRevoked(ctx, "token-b", tokenClaims("b", time.Minute)); err != nil || revoked {
+			t.Fatalf("IsRevoked of another token = %v, %v, want false", revoked, err)
+		}
+	})
+}
+
+func TestRemainingLifetime(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"until exp", tokenClaims("a", time.Hour), 59 * time.Minute, time.Hour},
+		{"expired", tokenClaims("a", -time.Hour), minRevocationTTL, minRevocationTTL},
+		{"expiring soon", tokenClaims("a", time.Second), minRevocationTTL, minRevocationTTL},
+		{"no exp", jwt.MapClaims{"jti": "a"}, minRevocationTTL, minRevocationTTL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := remainingLifetime(tt.claims); got < tt.min || got > tt.max {
+				t.Fatalf("remainingLifetime = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	"github.com/imnzr/user-authentication-go/internal/domain/session"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+)
+
+type sessionService struct {
+	sessionRepo session.Repository
+	redisRepo   redis.Client
+	audit       audit.Recorder
+	cfg         *config.Config
+}
+
+func NewSessionService(sessionRepo session.Repository, redisRepo redis.Client, recorder audit.Recorder, cfg *config.Config) session.Service {
+	return &sessionService{
+		sessionRepo: sessionRepo,
+		redisRepo:   redisRepo,
+		audit:       recorder,
+		cfg:         cfg,
+	}
+}
+
+// Create implements session.Service.
+func (s *sessionService) Create(ctx context.Context, userId int, ipAddress string, userAgent string) (*session.Session, error) {
+	sess := &session.Session{
+		Id:        uuid.NewString(),
+		UserId:    userId,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+	}
+	if err := s.sessionRepo.Create(ctx, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// List implements session.Service.
+func (s *sessionService) List(ctx context.Context, userId int) ([]*session.Session, error) {
+	return s.sessionRepo.ListActiveByUser(ctx, userId)
+}
+
+// Revoke implements session.Service.
+func (s *sessionService) Revoke(ctx context.Context, userId int, sessionId string) error {
+	if err := s.sessionRepo.Revoke(ctx, userId, sessionId); err != nil {
+		return err
+	}
+	if err := s.markRevoked(ctx, sessionId); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionSessionRevoked, audit.OutcomeSuccess, audit.UserActor(userId), userId).
+		With("session_id", sessionId))
+	return nil
+}
+
+// RevokeAll implements session.Service.
+func (s *sessionService) RevokeAll(ctx context.Context, userId int) error {
+	ids, err := s.sessionRepo.RevokeAll(ctx, userId)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.markRevoked(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markRevoked lets the middleware reject the session's access and refresh tokens until
+// the longest of them has expired anyway. Tokens are only issued at login and VerifyToken
+// rejects them after exp, so none of them outlives the entry.
+func (s *sessionService) markRevoked(ctx context.Context, sessionId string) error {
+	lifetime := max(s.cfg.JSONWebToken.AccessTokenDuration, s.cfg.JSONWebToken.RefreshTokenDuration)
+	ttl := int64(math.Ceil(lifetime.Seconds()))
+	if err := s.redisRepo.Set(ctx, redis.SessionRevokedKey(sessionId), "revoked", ttl); err != nil {
+		return fmt.Errorf("failed to revoke session tokens: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked implements session.Service.
+func (s *sessionService) IsRevoked(ctx context.Context, sessionId string) (bool, error) {
+	return s.redisRepo.Exists(ctx, redis.SessionRevokedKey(sessionId))
+}
+
+// Touch implements session.Service.
+// The middleware calls it on every request, only the first call per session.TouchInterval
+// reaches the primary. last_seen_at is informational, while Redis is down it just lags.
+func (s *sessionService) Touch(ctx context.Context, sessionId string) error {
+	ttl := int64(math.Ceil(session.TouchInterval.Seconds()))
+	first, err := s.redisRepo.SetNX(ctx, redis.SessionTouchedKey(sessionId), "touched", ttl)
+	if err != nil || !first {
+		return nil
+	}
+	return s.sessionRepo.Touch(ctx, sessionId)
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	"github.com/imnzr/user-authentication-go/internal/domain/session"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/internal/repository"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+)
+
+// touchCounter counts the Touch calls that reach the repository
+type touchCounter struct {
+	session.Repository
+
+	mu      sync.Mutex
+	touches int
+}
+
+func (c *touchCounter) Touch(ctx context.Context, id string) error {
+	c.mu.Lock()
+	c.touches++
+	c.mu.Unlock()
+	return c.Repository.Touch(ctx, id)
+}
+
+func (c *touchCounter) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.touches
+}
+
+type sessionFixture struct {
+	*userFixture
+	sessions session.Service
+	repo     *touchCounter
+}
+
+func newSessionFixture(t *testing.T) *sessionFixture {
+	t.Helper()
+
+	f := &sessionFixture{userFixture: newUserFixture(t, testConfig())}
+	f.repo = &touchCounter{Repository: repository.NewSessionRepository(f.db)}
+	f.sessions = NewSessionService(f.repo, f.redis, f.recorder, f.cfg)
+	return f
+}
+
+func (f *sessionFixture) create(t *testing.T, userId int, userAgent string) *session.Session {
+	t.Helper()
+
+	sess, err := f.sessions.Create(context.Background(), userId, "203.0.113.7", userAgent)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return sess
+}
+
+func (f *sessionFixture) list(t *testing.T, userId int) []string {
+	t.Helper()
+
+	sessions, err := f.sessions.List(context.Background(), userId)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	agents := make([]string, len(sessions))
+	for i, sess := range sessions {
+		agents[i] = sess.UserAgent
+	}
+	return agents
+}
+
+func (f *sessionFixture) assertRevoked(t *testing.T, sessionId string, want bool) {
+	t.Helper()
+
+	revoked, err := f.sessions.IsRevoked(context.Background(), sessionId)
+	if err != nil {
+		t.Fatalf("IsRevoked: %v", err)
+	}
+	if revoked != want {
+		t.Fatalf("IsRevoked(%s) = %v, want %v", sessionId, revoked, want)
+	}
+}
+
+func TestSessionsListAndRevoke(t *testing.T) {
+	f := newSessionFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	bob := f.createUser(t, "bob@example.com")
+
+	laptop := f.create(t, alice.Id, "laptop")
+	phone := f.create(t, alice.Id, "phone")
+	bobs := f.create(t, bob.Id, "tablet")
+
+	if got := f.list(t, alice.Id); len(got) != 2 {
+		t.Fatalf("List = %v, want alice's two sessions", got)
+	}
+
+	// Nobody revokes another user's session
+	if err := f.sessions.Revoke(ctx, alice.Id, bobs.Id); !errors.Is(err, errorpkg.ErrSessionNotFound) {
+		t.Fatalf("Revoke of another user's session = %v, want %v", err, errorpkg.ErrSessionNotFound)
+	}
+	f.assertRevoked(t, bobs.Id, false)
+
+	if err := f.sessions.Revoke(ctx, alice.Id, laptop.Id); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	f.assertRevoked(t, laptop.Id, true)
+	f.assertRevoked(t, phone.Id, false)
+	if got := f.list(t, alice.Id); len(got) != 1 || got[0] != "phone" {
+		t.Fatalf("List after Revoke = %v, want [phone]", got)
+	}
+	if err := f.sessions.Revoke(ctx, alice.Id, laptop.Id); !errors.Is(err, errorpkg.ErrSessionNotFound) {
+		t.Fatalf("second Revoke = %v, want %v", err, errorpkg.ErrSessionNotFound)
+	}
+
+	actions := f.recorder.actions()
+	if len(actions) != 1 || actions[0] != audit.ActionSessionRevoked {
+		t.Fatalf("audit actions = %v, want one revocation", actions)
+	}
+
+	if err := f.sessions.RevokeAll(ctx, alice.Id); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+	f.assertRevoked(t, phone.Id, true)
+	f.assertRevoked(t, bobs.Id, false)
+	if got := f.list(t, alice.Id); len(got) != 0 {
+		t.Fatalf("List after RevokeAll = %v", got)
+	}
+}
+
+func TestSessionTouchIsThrottled(t *testing.T) {
+	f := newSessionFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	sess := f.create(t, alice.Id, "laptop")
+	other := f.create(t, alice.Id, "phone")
+
+	for i := 0; i < 5; i++ {
+		if err := f.sessions.Touch(ctx, sess.Id); err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+	}
+	if n := f.repo.count(); n != 1 {
+		t.Fatalf("%d touches reached the database, want 1", n)
+	}
+
+	// Each session has its own interval
+	f.sessions.Touch(ctx, other.Id)
+	if n := f.repo.count(); n != 2 {
+		t.Fatalf("%d touches reached the database, want 2", n)
+	}
+
+	// Once the interval has passed the next request writes again
+	if err := f.redis.Del(ctx, redis.SessionTouchedKey(sess.Id)); err != nil {
+		t.Fatal(err)
+	}
+	f.sessions.Touch(ctx, sess.Id)
+	if n := f.repo.count(); n != 3 {
+		t.Fatalf("%d touches reached the database, want 3", n)
+	}
+}
+
+func TestSessionRepositoryTouchMovesLastSeen(t *testing.T) {
+	f := newSessionFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	sess := f.create(t, alice.Id, "laptop")
+
+	lastSeen := func() time.Time {
+		t.Helper()
+		var at time.Time
+		if err := f.db.Primary.QueryRow("SELECT last_seen_at FROM user_sessions WHERE id = ?", sess.Id).Scan(&at); err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+
+	past := time.Now().UTC().Add(-2 * session.TouchInterval)
+	if _, err := f.db.Primary.Exec("UPDATE user_sessions SET last_seen_at = ? WHERE id = ?", past, sess.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.repo.Touch(ctx, sess.Id); err != nil {
+		t.Fatalf("Touch: %v", err)
+	}
+	touched := lastSeen()
+	if !touched.After(past.Add(session.TouchInterval)) {
+		t.Fatalf("last_seen_at = %v, want about now", touched)
+	}
+
+	// Within the interval the row is left alone
+	if err := f.repo.Touch(ctx, sess.Id); err != nil {
+		t.Fatalf("Touch: %v", err)
+	}
+	if again := lastSeen(); !again.Equal(touched) {
+		t.Fatalf("last_seen_at moved from %v to %v within the interval", touched, again)
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/domain/user"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+	"go.uber.org/zap"
+)
+
+// Kept short, it is how long a Bump that could neither update nor drop the cached epoch
+// leaves the revoked tokens working
+const tokenEpochCacheTTL = int64(time.Minute / time.Second)
+
+type tokenEpochService struct {
+	userRepo  user.Repository
+	redisRepo redis.Client
+	logger    *zap.Logger
+}
+
+// NewTokenEpochService keeps users.token_epoch in MySQL and caches it in Redis
+func NewTokenEpochService(userRepo user.Repository, redisRepo redis.Client, logger *zap.Logger) user.TokenEpochStore {
+	return &tokenEpochService{
+		userRepo:  userRepo,
+		redisRepo: redisRepo,
+		logger:    logger,
+	}
+}
+
+// Current implements user.TokenEpochStore.
+func (s *tokenEpochService) Current(ctx context.Context, userId int) (int, error) {
+	key := redis.TokenEpochKey(userId)
+
+	if val, err := s.redisRepo.Get(ctx, key); err == nil {
+		if epoch, err := strconv.Atoi(val); err == nil {
+			return epoch, nil
+		}
+	}
+
+	epoch, err := s.userRepo.GetTokenEpoch(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only fills an empty cache. A Bump that ran after the read above has already cached the
+	// newer epoch, overwriting it would let revoked tokens back in until the entry expires.
+	if _, err := s.redisRepo.SetNX(ctx, key, strconv.Itoa(epoch), tokenEpochCacheTTL); err != nil {
+		s.logger.Warn("failed to cache token epoch", zap.Int("user_id", userId), zap.Error(err))
+	}
+
+	return epoch, nil
+}
+
+// Bump implements user.TokenEpochStore.
+func (s *tokenEpochService) Bump(ctx context.Context, userId int) (int, error) {
+	epoch, err := s.userRepo.IncrementTokenEpoch(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	// A stale cache would keep old tokens alive, drop it if it cannot be updated. When both
+	// fail the entry expires within tokenEpochCacheTTL.
+	key := redis.TokenEpochKey(userId)
+	if err := s.redisRepo.Set(ctx, key, strconv.Itoa(epoch), tokenEpochCacheTTL); err != nil {
+		if delErr := s.redisRepo.Del(ctx, key); delErr != nil {
+			return 0, fmt.Errorf("failed to update token epoch cache: %w", err)
+		}
+	}
+
+	return epoch, nil
+}
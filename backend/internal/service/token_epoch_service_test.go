@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/imnzr/user-authentication-go/internal/domain/user"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+	"go.uber.org/zap"
+)
+
+// epochReads counts the token epoch reads that reach the database
+type epochReads struct {
+	user.Repository
+
+	mu    sync.Mutex
+	reads int
+}
+
+func (r *epochReads) GetTokenEpoch(ctx context.Context, userId int) (int, error) {
+	r.mu.Lock()
+	r.reads++
+	r.mu.Unlock()
+	return r.Repository.GetTokenEpoch(ctx, userId)
+}
+
+func (r *epochReads) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reads
+}
+
+var errRedisWrite = errors.New("redis write failed")
+
+// cacheSpy records the TTLs epochs are cached with and can fail every write
+type cacheSpy struct {
+	redis.Client
+
+	mu         sync.Mutex
+	ttls       []int64
+	failWrites bool
+}
+
+func (c *cacheSpy) Set(ctx context.Context, key string, value string, ttlSeconds int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failWrites {
+		return errRedisWrite
+	}
+	c.ttls = append(c.ttls, ttlSeconds)
+	return c.Client.Set(ctx, key, value, ttlSeconds)
+}
+
+func (c *cacheSpy) SetNX(ctx context.Context, key string, value string, ttlSeconds int64) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failWrites {
+		return false, errRedisWrite
+	}
+	c.ttls = append(c.ttls, ttlSeconds)
+	return c.Client.SetNX(ctx, key, value, ttlSeconds)
+}
+
+func (c *cacheSpy) Del(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failWrites {
+		return errRedisWrite
+	}
+	return c.Client.Del(ctx, key)
+}
+
+type epochFixture struct {
+	*userFixture
+	epochs user.TokenEpochStore
+	reads  *epochReads
+	cache  *cacheSpy
+	user   *user.User
+}
+
+func newEpochFixture(t *testing.T) *epochFixture {
+	t.Helper()
+
+	f := &epochFixture{userFixture: newUserFixture(t, testConfig())}
+	f.reads = &epochReads{Repository: f.users}
+	f.cache = &cacheSpy{Client: f.redis}
+	f.epochs = NewTokenEpochService(f.reads, f.cache, zap.NewNop())
+	f.user = f.createUser(t, "alice@example.com")
+	return f
+}
+
+func (f *epochFixture) current(t *testing.T) int {
+	t.Helper()
+
+	epoch, err := f.epochs.Current(context.Background(), f.user.Id)
+	if err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	return epoch
+}
+
+func TestTokenEpochIsCached(t *testing.T) {
+	f := newEpochFixture(t)
+
+	for i := 0; i < 3; i++ {
+		if epoch := f.current(t); epoch != 0 {
+			t.Fatalf("Current = %d, want 0", epoch)
+		}
+	}
+	if n := f.reads.count(); n != 1 {
+		t.Fatalf("%d reads reached the database, want 1", n)
+	}
+
+	cached, err := f.redis.Get(context.Background(), redis.TokenEpochKey(f.user.Id))
+	if err != nil || cached != "0" {
+		t.Fatalf("cached epoch = %q, %v", cached, err)
+	}
+}
+
+func TestTokenEpochBump(t *testing.T) {
+	f := newEpochFixture(t)
+	ctx := context.Background()
+	f.current(t)
+
+	for want := 1; want <= 2; want++ {
+		epoch, err := f.epochs.Bump(ctx, f.user.Id)
+		if err != nil {
+			t.Fatalf("Bump: %v", err)
+		}
+		if epoch != want || f.current(t) != want {
+			t.Fatalf("Bump = %d, Current = %d, want %d", epoch, f.current(t), want)
+		}
+	}
+	// The bump updated the cache, nothing was read again
+	if n := f.reads.count(); n != 1 {
+		t.Fatalf("%d reads reached the database, want 1", n)
+	}
+	if stored := f.reload(t, f.user.Id).TokenEpoch; stored != 2 {
+		t.Fatalf("users.token_epoch = %d, want 2", stored)
+	}
+}
+
+func TestTokenEpochCacheIsShortLived(t *testing.T) {
+	f := newEpochFixture(t)
+	f.current(t)
+	if _, err := f.epochs.Bump(context.Background(), f.user.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cached epoch a failed Bump couldn't replace keeps revoked tokens working until it expires
+	for _, ttl := range f.cache.ttls {
+		if ttl <= 0 || ttl > 60 {
+			t.Fatalf("epoch cached for %ds, want at most a minute", ttl)
+		}
+	}
+	if len(f.cache.ttls) != 2 {
+		t.Fatalf("%d cache writes, want the fill and the bump", len(f.cache.ttls))
+	}
+}
+
+func TestTokenEpochBumpWhenTheCacheCannotBeUpdated(t *testing.T) {
+	f := newEpochFixture(t)
+	ctx := context.Background()
+	f.current(t)
+
+	f.cache.failWrites = true
+	if _, err := f.epochs.Bump(ctx, f.user.Id); err == nil {
+		t.Fatal("Bump reported success with the old epoch still cached")
+	}
+	// The database is the source of truth and has the new epoch
+	if stored := f.reload(t, f.user.Id).TokenEpoch; stored != 1 {
+		t.Fatalf("users.token_epoch = %d, want 1", stored)
+	}
+
+	// Once the stale entry expires the new epoch is read back
+	f.cache.failWrites = false
+	if err := f.redis.Del(ctx, redis.TokenEpochKey(f.user.Id)); err != nil {
+		t.Fatal(err)
+	}
+	if epoch := f.current(t); epoch != 1 {
+		t.Fatalf("Current = %d, want 1", epoch)
+	}
+	cached, _ := f.redis.Get(ctx, redis.TokenEpochKey(f.user.Id))
+	if cached != strconv.Itoa(1) {
+		t.Fatalf("cached epoch = %q, want 1", cached)
+	}
+}
@@ -2,20 +2,31 @@ package service
 
 import (
 	"context"
-	"database/sql"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"time"
+	"math/big"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/imnzr/user-authentication-go/internal/config"
 	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	"github.com/imnzr/user-authentication-go/internal/domain/device"
+	"github.com/imnzr/user-authentication-go/internal/domain/lockout"
+	"github.com/imnzr/user-authentication-go/internal/domain/revocation"
+	"github.com/imnzr/user-authentication-go/internal/domain/session"
 	"github.com/imnzr/user-authentication-go/internal/domain/user"
+	"github.com/imnzr/user-authentication-go/internal/domain/webhook"
 	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
 	"github.com/imnzr/user-authentication-go/internal/repository/redis"
 	"github.com/imnzr/user-authentication-go/pkg/auth"
+	"github.com/imnzr/user-authentication-go/pkg/mailer"
+	"github.com/imnzr/user-authentication-go/pkg/password"
 	"github.com/imnzr/user-authentication-go/pkg/request"
 	"github.com/imnzr/user-authentication-go/pkg/response"
-	"golang.org/x/crypto/bcrypt"
+	"go.uber.org/zap"
 )
 
 type service struct {
@@ -23,15 +34,102 @@ type service struct {
 	txManager   database.TxManager
 	authManager auth.AuthManager
 	redisRepo   redis.Client
+	events      webhook.Publisher
+	audit       audit.Recorder
+	devices     device.Service
+	sessions    session.Service
+	epochs      user.TokenEpochStore
+	revocations revocation.Store
+	lockout     lockout.Service
+	policy      *password.Policy
+	hasher      password.Hasher
+	mailer      mailer.Mailer
+	cfg         *config.Config
+	logger      *zap.Logger
+
+	// Hash of a random password, compared against when the account doesn't exist
+	dummyHash string
 }
 
-func NewUserService(userRepo user.Repository, txManager database.TxManager, authManager auth.AuthManager, redisRepo redis.Client) user.Service {
+const forgotPasswordTTL = int64(10 * 60)
+
+func NewUserService(userRepo user.Repository, txManager database.TxManager, authManager auth.AuthManager, redisRepo redis.Client, events webhook.Publisher, recorder audit.Recorder, devices device.Service, sessions session.Service, epochs user.TokenEpochStore, revocations revocation.Store, lockout lockout.Service, policy *password.Policy, hasher password.Hasher, mailer mailer.Mailer, cfg *config.Config, logger *zap.Logger) user.Service {
 	return &service{
 		userRepo:    userRepo,
 		txManager:   txManager,
 		authManager: authManager,
 		redisRepo:   redisRepo,
+		events:      events,
+		audit:       recorder,
+		devices:     devices,
+		sessions:    sessions,
+		epochs:      epochs,
+		revocations: revocations,
+		lockout:     lockout,
+		policy:      policy,
+		hasher:      hasher,
+		mailer:      mailer,
+		cfg:         cfg,
+		logger:      logger,
+		dummyHash:   newDummyHash(hasher, logger),
+	}
+}
+
+func newDummyHash(hasher password.Hasher, logger *zap.Logger) string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		logger.Error("failed to generate dummy password, logins won't take constant time", zap.Error(err))
+		return ""
+	}
+	hashed, err := hasher.Hash(hex.EncodeToString(secret))
+	if err != nil {
+		logger.Error("failed to hash dummy password, logins won't take constant time", zap.Error(err))
+		return ""
 	}
+	return hashed
+}
+
+// equalizeTiming does the same password work as a real login for an account that
+// doesn't exist, so response times don't reveal which emails are registered
+func (s *service) equalizeTiming(pw string) error {
+	if s.dummyHash == "" {
+		return nil
+	}
+	_, _, err := s.hasher.Verify(pw, s.dummyHash)
+	return err
+}
+
+// sendMail mails in the background so the response time doesn't depend on whether a mail was sent
+func (s *service) sendMail(to string, subject string, body string) {
+	go func() {
+		if err := s.mailer.Send(context.Background(), to, subject, body); err != nil {
+			s.logger.Error("failed to send mail", zap.String("subject", subject), zap.Error(err))
+		}
+	}()
+}
+
+func (s *service) sendVerificationEmail(ctx context.Context, email string) error {
+	token, err := s.authManager.GenerateTokenVerif(ctx, email)
+	if err != nil {
+		return fmt.Errorf("error generate token: %w", err)
+	}
+	verifyLink := fmt.Sprintf("%s/api/v1/auth/verify/%s", s.cfg.Server.BaseURL, token)
+
+	s.sendMail(email, "Verify your email", fmt.Sprintf(
+		"Welcome! Confirm your email address to activate your account:\n%s\n", verifyLink,
+	))
+	return nil
+}
+
+// sendAccountExistsEmail tells the owner someone tried to sign up with their address,
+// the signup response itself stays the same as for a new account
+func (s *service) sendAccountExistsEmail(email string) {
+	s.sendMail(email, "You already have an account", fmt.Sprintf(
+		"Someone tried to create an account with this email address, but you already have one.\n\n"+
+			"If it was you, sign in instead or reset your password at:\n%s/api/v1/auth/forgot-password\n\n"+
+			"If it wasn't you, you can ignore this email.\n",
+		s.cfg.Server.BaseURL,
+	))
 }
 
 func (s *service) ValidateCreateUser(req request.UserCreateRequest) error {
@@ -41,8 +139,8 @@ func (s *service) ValidateCreateUser(req request.UserCreateRequest) error {
 	if req.Email == "" {
 		return fmt.Errorf("invalid email")
 	}
-	if req.Password == "" {
-		return fmt.Errorf("invalid password")
+	if err := s.policy.Validate(req.Password, req.Username, req.Email); err != nil {
+		return err
 	}
 
 	return nil
@@ -54,42 +152,54 @@ func (s *service) Create(ctx context.Context, req *request.UserCreateRequest) (*
 		return nil, err
 	}
 
-	var createdUser *user.User
+	// Hashed before the transaction so it holds no locks during the slow part, and also for an
+	// existing account so both take as long
+	hashPassword, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash user password: %w", err)
+	}
+
+	var (
+		createdUser *user.User
+		exists      bool
+	)
+
+	err = s.txManager.WithTransaction(ctx, func(txCtx context.Context) error {
+		// Runs again from scratch when the transaction is retried
+		createdUser, exists = nil, false
 
-	err := s.txManager.WithTransaction(ctx, func(txCtx context.Context) error {
 		// Check if user already exists
-		existing, err := s.userRepo.GetByEmail(ctx, req.Email)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		existing, err := s.userRepo.GetByEmail(txCtx, req.Email)
+		if err != nil && !errors.Is(err, errorpkg.ErrUserNotFound) {
 			return err
 		}
-		if existing != nil {
-			return fmt.Errorf("user already exists")
-		}
 
-		// Hash a password
-		hashPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-		if err != nil {
-			return fmt.Errorf("failed to hash user password: %w", err)
+		if existing != nil {
+			exists = true
+			createdUser = existing
+			return nil
 		}
 
 		// Create user
 		newUser := &user.User{
 			Username: req.Username,
 			Email:    req.Email,
-			Password: string(hashPassword),
+			Password: hashPassword,
 			Status:   "pending",
 		}
 
-		if err := s.userRepo.Create(ctx, newUser); err != nil {
-			return fmt.Errorf("failed to create user: %w", err)
+		// A concurrent signup can register the email between the check and the insert. The
+		// savepoint keeps the transaction usable after the failed insert, Postgres aborts it.
+		err = s.txManager.WithTransaction(txCtx, func(ctx context.Context) error {
+			return s.userRepo.Create(ctx, newUser)
+		})
+		if errors.Is(err, errorpkg.ErrEmailTaken) {
+			exists = true
+			return nil
 		}
-
-		token, err := s.authManager.GenerateTokenVerif(ctx, newUser.Email)
 		if err != nil {
-			return fmt.Errorf("error generate token: %w", err)
+			return fmt.Errorf("failed to create user: %w", err)
 		}
-		verifyLink := fmt.Sprintf("http://localhost:8080/api/v1/auth/verify/%s", token)
-		fmt.Println("Verification link: ", verifyLink)
 
 		createdUser = newUser
 
@@ -100,6 +210,28 @@ func (s *service) Create(ctx context.Context, req *request.UserCreateRequest) (*
 		return nil, err
 	}
 
+	if exists {
+		var existingId int
+		if createdUser != nil {
+			existingId = createdUser.Id
+		}
+		s.audit.Record(ctx, audit.NewEvent(audit.ActionSignup, audit.OutcomeFailure, audit.AnonymousActor, existingId).
+			With("reason", "email_already_registered"))
+		s.sendAccountExistsEmail(req.Email)
+		return nil, nil
+	}
+
+	if err := s.sendVerificationEmail(ctx, createdUser.Email); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionSignup, audit.OutcomeSuccess, audit.UserActor(createdUser.Id), createdUser.Id))
+
+	// Deliveries are stored in plaintext, payloads carry ids and no PII
+	s.events.Publish(ctx, webhook.EventUserSignedUp, map[string]interface{}{
+		"user_id": createdUser.Id,
+	})
+
 	return createdUser, nil
 }
 
@@ -118,8 +250,15 @@ func (s *service) VerifyEmail(ctx context.Context, tokenString string) (jwt.MapC
 
 	claims, err := s.authManager.VerifyToken(ctx, tokenString)
 	if err != nil {
+		s.audit.Record(ctx, audit.NewEvent(audit.ActionEmailVerified, audit.OutcomeFailure, audit.EmailLinkActor, 0).
+			With("reason", "invalid_token"))
 		return nil, fmt.Errorf("failed to verify token: %w", err)
 	}
+	if tokenType, _ := claims["type"].(string); tokenType != "email_verify" {
+		s.audit.Record(ctx, audit.NewEvent(audit.ActionEmailVerified, audit.OutcomeFailure, audit.EmailLinkActor, 0).
+			With("reason", "wrong_token_type"))
+		return nil, errorpkg.ErrInvalidLink
+	}
 
 	email, ok := claims["email"].(string)
 	if !ok {
@@ -130,36 +269,122 @@ func (s *service) VerifyEmail(ctx context.Context, tokenString string) (jwt.MapC
 		return nil, err
 	}
 
+	if verified, err := s.userRepo.GetByEmail(ctx, email); err == nil {
+		s.audit.Record(ctx, audit.NewEvent(audit.ActionEmailVerified, audit.OutcomeSuccess, audit.EmailLinkActor, verified.Id))
+		s.events.Publish(ctx, webhook.EventUserVerified, map[string]interface{}{
+			"user_id": verified.Id,
+		})
+	}
+
 	return claims, nil
 
 }
 
 // LoginUser implements user.Service.
 func (s *service) LoginUser(ctx context.Context, req *request.UserLoginRequest) (*response.TokenResponse, error) {
+	// A replica a moment behind would miss a lock or a failed attempt just recorded, and
+	// could let a guess through that the primary already refuses
+	ctx = database.WithPrimaryReads(ctx)
+
 	user, err := s.userRepo.GetByEmail(ctx, req.Email)
-	if err != nil {
+	if err != nil || user == nil {
+		if err := s.equalizeTiming(req.Password); err != nil {
+			return nil, fmt.Errorf("failed to verify password: %w", err)
+		}
+
+		// Throttled on the same schedule as an account, a lock would otherwise only ever
+		// show up for registered emails
+		emailIndex := s.userRepo.EmailIndex(req.Email)
+		unknownFailed := func(reason string) {
+			s.audit.Record(ctx, audit.NewEvent(audit.ActionLogin, audit.OutcomeFailure, audit.AnonymousActor, 0).
+				With("reason", reason).
+				With("email_bidx", emailIndex))
+		}
+		if err := s.lockout.CheckEmail(ctx, emailIndex); err != nil {
+			unknownFailed("locked")
+			return nil, err
+		}
+		unknownFailed("unknown_email")
+		if err := s.lockout.RecordEmailFailure(ctx, emailIndex); err != nil {
+			s.logger.Error("failed to record failed login", zap.String("email_bidx", emailIndex), zap.Error(err))
+		}
 		return nil, errorpkg.ErrInvalidCredentials
 	}
-	if user == nil {
-		return nil, errorpkg.ErrInvalidCredentials
+
+	loginFailed := func(reason string) {
+		s.audit.Record(ctx, audit.NewEvent(audit.ActionLogin, audit.OutcomeFailure, audit.AnonymousActor, user.Id).
+			With("reason", reason))
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	// The password is checked even for a locked account, a faster answer would tell callers
+	// the email is registered. Unknown emails get the same lock on the same schedule.
+	match, needsRehash, err := s.hasher.Verify(req.Password, user.Password)
 	if err != nil {
+		return nil, fmt.Errorf("failed to verify password: %w", err)
+	}
+	if err := s.lockout.Check(ctx, user); err != nil {
+		loginFailed("locked")
+		return nil, err
+	}
+	if !match {
+		loginFailed("invalid_password")
+		if err := s.lockout.RecordFailure(ctx, user); err != nil {
+			s.logger.Error("failed to record failed login", zap.Int("user_id", user.Id), zap.Error(err))
+		}
 		return nil, errorpkg.ErrInvalidCredentials
 	}
 
+	// Migrate the stored hash to the current algorithm and parameters while we know the password
+	if needsRehash {
+		if rehashed, err := s.hasher.Hash(req.Password); err != nil {
+			s.logger.Error("failed to rehash password", zap.Int("user_id", user.Id), zap.Error(err))
+		} else if err := s.userRepo.UpdatePassword(ctx, user.Id, rehashed); err != nil {
+			s.logger.Error("failed to store rehashed password", zap.Int("user_id", user.Id), zap.Error(err))
+		}
+	}
+
+	if err := s.lockout.RecordSuccess(ctx, user); err != nil {
+		s.logger.Error("failed to reset failed logins", zap.Int("user_id", user.Id), zap.Error(err))
+	}
+
+	if user.Status == "suspended" {
+		loginFailed("suspended")
+		return nil, errorpkg.ErrAccountSuspended
+	}
+	if user.PasswordResetRequired {
+		loginFailed("password_reset_required")
+		return nil, errorpkg.ErrPasswordResetRequired
+	}
+
+	// A failure here must not block the login
+	if err := s.devices.RecordLogin(ctx, user.Id, user.Email, req.IPAddress, req.UserAgent); err != nil {
+		s.logger.Error("failed to record login device", zap.Int("user_id", user.Id), zap.Error(err))
+	}
+
+	// Every login starts a new session, both tokens carry its id
+	sess, err := s.sessions.Create(ctx, user.Id, req.IPAddress, req.UserAgent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
 	// Generate Access Token
-	accessToken, err := s.authManager.GenerateAccessToken(ctx, user.Id, user.Email)
+	accessToken, err := s.authManager.GenerateAccessToken(ctx, user.Id, user.Email, sess.Id, user.TokenEpoch)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 	// Generate Refresh Token
-	refreshToken, err := s.authManager.GenerateRefreshToken(ctx, user.Id)
+	refreshToken, err := s.authManager.GenerateRefreshToken(ctx, user.Id, sess.Id, user.TokenEpoch)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionLogin, audit.OutcomeSuccess, audit.UserActor(user.Id), user.Id).
+		With("session_id", sess.Id))
+
+	s.events.Publish(ctx, webhook.EventUserLoggedIn, map[string]interface{}{
+		"user_id": user.Id,
+	})
+
 	return &response.TokenResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
@@ -170,7 +395,7 @@ func (s *service) LoginUser(ctx context.Context, req *request.UserLoginRequest)
 func (s *service) GetUserProfile(ctx context.Context, userId int) (*response.UserProfileResponse, error) {
 	user, err := s.userRepo.GetById(ctx, userId)
 	if err != nil {
-		return nil, fmt.Errorf("user profile not found")
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
 	}
 	response := response.UserProfileResponse{
 		Username: user.Username,
@@ -181,35 +406,228 @@ func (s *service) GetUserProfile(ctx context.Context, userId int) (*response.Use
 }
 
 // LogoutUser implements user.Service.
-func (s *service) LogoutUser(ctx context.Context, token string, exp int64) error {
-	ttl := time.Until(time.Unix(exp, 0))
-	if ttl <= 0 {
-		ttl = time.Minute // fallback biar ada TTL
+func (s *service) LogoutUser(ctx context.Context, userId int, sessionId string, token string, claims jwt.MapClaims) error {
+	if err := s.sessions.Revoke(ctx, userId, sessionId); err != nil {
+		return err
 	}
 
-	err := s.redisRepo.Set(ctx, token, "blacklisted", int64(ttl.Seconds()))
-	if err != nil {
-		fmt.Printf("Failed set blacklist: %v\n", err)
+	// The handler logs the error
+	if err := s.revocations.Revoke(ctx, token, claims); err != nil {
 		return err
 	}
 
-	fmt.Printf("Blacklisted token %s with TTL %v\n", token, ttl)
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionLogout, audit.OutcomeSuccess, audit.UserActor(userId), userId).
+		With("session_id", sessionId))
 	return nil
 }
 
 // ForgotPassword implements user.Service.
 func (s *service) ForgotPassword(ctx context.Context, email string) error {
-	panic("unimplemented")
-	// user, err := s.userRepo.GetByEmail(ctx, email)
-	// if err != nil {
-	// 	return fmt.Errorf("User with email %s not found", email)
-	// }
-
-	// code := fmt.Sprintf("%05d", rand.Intn(100000))
-	// key := "Forgot:" + email
-	// ttl := int64(10 * 60)
-
-	// if err := s.redisRepo.Set(ctx, key, code, ttl); err != nil {
-	// 	return fmt.Errorf("failed to save code to redis: %w", err)
-	// }
+	existing, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, errorpkg.ErrUserNotFound) {
+		return err
+	}
+
+	// Unknown emails go through the same work and get the same response, the code is
+	// stored but never sent, so neither timing nor a Redis outage tells them apart
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return fmt.Errorf("failed to generate reset code: %w", err)
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	if err := s.redisRepo.Set(ctx, redis.ForgotPasswordKey(s.userRepo.EmailIndex(email)), code, forgotPasswordTTL); err != nil {
+		s.logger.Error("failed to save reset code", zap.Error(err))
+		// Fail open answers as usual, the code just never arrives
+		if s.cfg.RedisFailure.OTP == config.FailOpen {
+			return nil
+		}
+		return errorpkg.ErrServiceUnavailable
+	}
+	if existing == nil {
+		return nil
+	}
+
+	s.sendMail(email, "Reset your password", fmt.Sprintf("Your password reset code is %s. It expires in 10 minutes.", code))
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionPasswordForgot, audit.OutcomeSuccess, audit.AnonymousActor, existing.Id))
+
+	return nil
+}
+
+// ResendVerification implements user.Service.
+func (s *service) ResendVerification(ctx context.Context, email string) error {
+	// Unknown and already verified accounts get the same response, nothing is sent
+	existing, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil || existing.Status != user.StatusPending {
+		return nil
+	}
+	return s.sendVerificationEmail(ctx, existing.Email)
+}
+
+// ResetPassword implements user.Service.
+func (s *service) ResetPassword(ctx context.Context, req *request.ResetPasswordRequest) error {
+	if req.Email == "" || req.Code == "" {
+		return errorpkg.ErrInvalidResetCode
+	}
+
+	// Keyed by blind index, so the code is found whatever case the email is typed in
+	emailIndex := s.userRepo.EmailIndex(req.Email)
+	code, err := s.redisRepo.Get(ctx, redis.ForgotPasswordKey(emailIndex))
+	if redis.IsFailure(err) {
+		// A code can't be checked without Redis, whatever the policy
+		return errorpkg.ErrServiceUnavailable
+	}
+	if err != nil || subtle.ConstantTimeCompare([]byte(code), []byte(req.Code)) != 1 {
+		s.audit.Record(ctx, audit.NewEvent(audit.ActionPasswordReset, audit.OutcomeFailure, audit.AnonymousActor, 0).
+			With("reason", "invalid_code").
+			With("email_bidx", emailIndex))
+		return errorpkg.ErrInvalidResetCode
+	}
+
+	resetUser, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if errors.Is(err, errorpkg.ErrUserNotFound) {
+		// The code stored for an email without an account
+		return errorpkg.ErrInvalidResetCode
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Validate(req.Password, resetUser.Username, resetUser.Email); err != nil {
+		return err
+	}
+
+	hashPassword, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		return fmt.Errorf("failed to hash user password: %w", err)
+	}
+
+	if err := s.userRepo.ResetPassword(ctx, req.Email, hashPassword); err != nil {
+		return err
+	}
+
+	// Whoever knew the old password must not keep a session
+	if err := s.revokeAll(ctx, resetUser.Id); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionPasswordReset, audit.OutcomeSuccess, audit.EmailLinkActor, resetUser.Id))
+
+	// Code is single use
+	if err := s.redisRepo.Del(ctx, redis.ForgotPasswordKey(emailIndex)); err != nil {
+		s.logger.Error("failed to delete reset code", zap.Int("user_id", resetUser.Id), zap.Error(err))
+	}
+
+	return nil
+}
+
+// ChangePassword implements user.Service.
+func (s *service) ChangePassword(ctx context.Context, userId int, req *request.ChangePasswordRequest) error {
+	current, err := s.userRepo.GetById(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	match, _, err := s.hasher.Verify(req.CurrentPassword, current.Password)
+	if err != nil {
+		return fmt.Errorf("failed to verify password: %w", err)
+	}
+	if !match {
+		s.audit.Record(ctx, audit.NewEvent(audit.ActionPasswordChanged, audit.OutcomeFailure, audit.UserActor(userId), userId).
+			With("reason", "invalid_password"))
+		return errorpkg.ErrInvalidCredentials
+	}
+
+	if err := s.policy.Validate(req.NewPassword, current.Username, current.Email); err != nil {
+		return err
+	}
+
+	hashPassword, err := s.hasher.Hash(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash user password: %w", err)
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, userId, hashPassword); err != nil {
+		return err
+	}
+
+	if err := s.revokeAll(ctx, userId); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionPasswordChanged, audit.OutcomeSuccess, audit.UserActor(userId), userId))
+	return nil
+}
+
+// CheckUnrecognizedLogin implements user.Service.
+func (s *service) CheckUnrecognizedLogin(ctx context.Context, tokenString string) error {
+	_, err := checkSingleUseToken(ctx, s.authManager, s.redisRepo, tokenString, "device_revoke")
+	return err
+}
+
+// ReportUnrecognizedLogin implements user.Service.
+func (s *service) ReportUnrecognizedLogin(ctx context.Context, tokenString string) (err error) {
+	userId, release, err := useSingleUseToken(ctx, s.authManager, s.redisRepo, tokenString, "device_revoke")
+	if err != nil {
+		return err
+	}
+	// The user can follow the link again when securing the account failed halfway
+	defer func() {
+		if err != nil {
+			release()
+		}
+	}()
+
+	user, err := s.userRepo.GetById(ctx, userId)
+	if err != nil {
+		return errorpkg.ErrInvalidLink
+	}
+
+	if err := s.revokeAll(ctx, user.Id); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionLogoutAll, audit.OutcomeSuccess, audit.EmailLinkActor, user.Id).
+		With("reason", "unrecognized_login"))
+
+	if err := s.userRepo.RequirePasswordReset(ctx, user.Id); err != nil {
+		return err
+	}
+
+	if err := s.devices.ForgetAll(ctx, user.Id); err != nil {
+		return err
+	}
+
+	return s.ForgotPassword(ctx, user.Email)
+}
+
+// LogoutAll implements user.Service.
+func (s *service) LogoutAll(ctx context.Context, userId int) error {
+	if err := s.revokeAll(ctx, userId); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionLogoutAll, audit.OutcomeSuccess, audit.UserActor(userId), userId))
+	return nil
+}
+
+// revokeAll signs the user out everywhere, callers record why
+func (s *service) revokeAll(ctx context.Context, userId int) error {
+	if _, err := s.epochs.Bump(ctx, userId); err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+	return s.sessions.RevokeAll(ctx, userId)
+}
+
+// SuspendUser implements user.Service.
+func (s *service) SuspendUser(ctx context.Context, userId int, adminId int) error {
+	if _, err := s.userRepo.GetById(ctx, userId); err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdateStatus(ctx, userId, user.StatusSuspended); err != nil {
+		return err
+	}
+	if err := s.revokeAll(ctx, userId); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionAccountSuspended, audit.OutcomeSuccess, audit.AdminActor(adminId), userId))
+	return nil
 }
@@ -0,0 +1,513 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/domain/user"
+	"github.com/imnzr/user-authentication-go/internal/domain/webhook"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/internal/repository"
+	"github.com/imnzr/user-authentication-go/internal/repository/redis"
+	"github.com/imnzr/user-authentication-go/internal/testutil"
+	"github.com/imnzr/user-authentication-go/pkg/auth"
+	"github.com/imnzr/user-authentication-go/pkg/password"
+	"github.com/imnzr/user-authentication-go/pkg/request"
+	"github.com/imnzr/user-authentication-go/pkg/response"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type sentMail struct {
+	to, subject, body string
+}
+
+// chanMailer hands every mail to the test, mails are sent in the background
+type chanMailer chan sentMail
+
+func (m chanMailer) Send(ctx context.Context, to string, subject string, body string) error {
+	m <- sentMail{to: to, subject: subject, body: body}
+	return nil
+}
+
+func waitForMail(t *testing.T, mails chanMailer, subject string) sentMail {
+	t.Helper()
+
+	for {
+		select {
+		case mail := <-mails:
+			if mail.subject == subject {
+				return mail
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %q mail was sent", subject)
+			return sentMail{}
+		}
+	}
+}
+
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(ctx context.Context, eventType webhook.EventType, data map[string]interface{}) {
+}
+
+// testHasher can make Hash fail, as a saturated hash pool does
+type testHasher struct {
+	password.Hasher
+	failHash atomic.Bool
+}
+
+func (h *testHasher) Hash(pw string) (string, error) {
+	if h.failHash.Load() {
+		return "", password.ErrHasherBusy
+	}
+	return h.Hasher.Hash(pw)
+}
+
+const testPassword = "correct horse battery staple"
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Server: config.ServerConfig{BaseURL: "http://localhost"},
+		JSONWebToken: config.JWTConfig{
+			JWTSecretKey:         "test-secret-key-that-is-long-enough",
+			AccessTokenDuration:  time.Minute,
+			RefreshTokenDuration: time.Hour,
+		},
+		RedisFailure: config.RedisFailureConfig{
+			Revocation:          config.FailClosed,
+			RateLimit:           config.FailOpen,
+			OTP:                 config.FailClosed,
+			RevocationCacheSize: 100,
+		},
+		Lockout: config.LockoutConfig{
+			DelayAfter: 2,
+			BaseDelay:  time.Second,
+			MaxDelay:   4 * time.Second,
+			Threshold:  5,
+			Cooldown:   15 * time.Minute,
+		},
+		Password: config.PasswordConfig{
+			MinLength:         8,
+			MaxLength:         64,
+			HashAlgorithm:     password.AlgorithmArgon2id,
+			Argon2Memory:      64,
+			Argon2Iterations:  1,
+			Argon2Parallelism: 1,
+		},
+	}
+}
+
+// userFixture is the user service over SQLite and the in-memory Redis, with the real
+// collaborators it is wired with in the router
+type userFixture struct {
+	cfg         *config.Config
+	db          *database.DB
+	service     user.Service
+	users       user.Repository
+	redis       redis.Client
+	cache       *cacheSpy
+	authManager auth.AuthManager
+	hasher      *testHasher
+	mails       chanMailer
+	recorder    *memoryRecorder
+	logs        *observer.ObservedLogs
+}
+
+func newUserFixture(t *testing.T, cfg *config.Config) *userFixture {
+	t.Helper()
+
+	return newUserFixtureOn(t, cfg, testutil.NewDB(t))
+}
+
+// newUserFixtureOn runs the fixture on db, a migrated database
+func newUserFixtureOn(t *testing.T, cfg *config.Config, db *database.DB) *userFixture {
+	t.Helper()
+
+	hasher, err := password.NewHasher(cfg.Password)
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	policy, err := password.NewPolicy(cfg.Password)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	f := &userFixture{
+		cfg:         cfg,
+		db:          db,
+		cache:       &cacheSpy{Client: redis.NewMemoryClient()},
+		authManager: auth.NewJWTManager(*cfg),
+		hasher:      &testHasher{Hasher: hasher},
+		mails:       make(chanMailer, 16),
+		recorder:    &memoryRecorder{},
+	}
+	f.redis = f.cache
+	f.users = repository.NewUserRepository(f.db, testutil.NewKeyring(t))
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	f.logs = logs
+	logger := zap.New(core)
+	devices := NewDeviceService(repository.NewDeviceRepository(f.db), f.authManager, f.mails, cfg, logger)
+	sessions := NewSessionService(repository.NewSessionRepository(f.db), f.redis, f.recorder, cfg)
+	epochs := NewTokenEpochService(f.users, f.redis, logger)
+	revocations := NewRevocationStore(f.redis, cfg.RedisFailure, logger)
+	lockoutService := NewLockoutService(f.users, f.authManager, f.redis, f.mails, f.recorder, cfg, logger)
+	f.service = NewUserService(f.users, database.NewTxManager(f.db), f.authManager, f.redis, nopPublisher{}, f.recorder,
+		devices, sessions, epochs, revocations, lockoutService, policy, f.hasher, f.mails, cfg, logger)
+	return f
+}
+
+// createUser stores an active account whose password is testPassword
+func (f *userFixture) createUser(t *testing.T, email string) *user.User {
+	t.Helper()
+
+	hashed, err := f.hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	u := &user.User{Username: strings.Split(email, "@")[0], Email: email, Password: hashed, Status: user.StatusActive}
+	if err := f.users.Create(context.Background(), u); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return u
+}
+
+func (f *userFixture) reload(t *testing.T, userId int) *user.User {
+	t.Helper()
+
+	u, err := f.users.GetById(context.Background(), userId)
+	if err != nil {
+		t.Fatalf("GetById: %v", err)
+	}
+	return u
+}
+
+func (f *userFixture) login(email string, pw string, userAgent string) (*response.TokenResponse, error) {
+	return f.service.LoginUser(context.Background(), &request.UserLoginRequest{
+		Email:     email,
+		Password:  pw,
+		IPAddress: "203.0.113.7",
+		UserAgent: userAgent,
+	})
+}
+
+// linkToken pulls the token out of the first link in a mail body
+func linkToken(t *testing.T, body string, path string) string {
+	t.Helper()
+
+	match := regexp.MustCompile(regexp.QuoteMeta(path) + `([A-Za-z0-9_.-]+)`).FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("no %s link in %q", path, body)
+	}
+	return match[1]
+}
+
+func TestVerifyEmail(t *testing.T) {
+	f := newUserFixture(t, testConfig())
+	ctx := context.Background()
+
+	if _, err := f.service.Create(ctx, &request.UserCreateRequest{Username: "bob", Email: "bob@example.com", Password: testPassword}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	token := linkToken(t, waitForMail(t, f.mails, "Verify your email").body, "/api/v1/auth/verify/")
+
+	if _, err := f.service.VerifyEmail(ctx, token); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	verified, err := f.users.GetByEmail(ctx, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified.Status != user.StatusActive {
+		t.Fatalf("status = %q, want %q", verified.Status, user.StatusActive)
+	}
+}
+
+func TestVerifyEmailRejectsOtherTokens(t *testing.T) {
+	f := newUserFixture(t, testConfig())
+	ctx := context.Background()
+
+	pending := &user.User{Username: "carol", Email: "carol@example.com", Password: "hash", Status: user.StatusPending}
+	if err := f.users.Create(ctx, pending); err != nil {
+		t.Fatal(err)
+	}
+
+	// An access token carries the email too, it must not activate the account
+	accessToken, err := f.authManager.GenerateAccessToken(ctx, pending.Id, pending.Email, "sid", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.VerifyEmail(ctx, accessToken); !errors.Is(err, errorpkg.ErrInvalidLink) {
+		t.Fatalf("VerifyEmail with an access token = %v, want %v", err, errorpkg.ErrInvalidLink)
+	}
+	if _, err := f.service.VerifyEmail(ctx, "not-a-token"); err == nil {
+		t.Fatal("VerifyEmail accepted a malformed token")
+	}
+
+	if status := f.reload(t, pending.Id).Status; status != user.StatusPending {
+		t.Fatalf("status = %q, want the account still pending", status)
+	}
+}
+
+func TestReportUnrecognizedLogin(t *testing.T) {
+	f := newUserFixture(t, testConfig())
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+
+	// The first device is trusted, the second one is alerted with a "this wasn't me" link
+	if _, err := f.login(alice.Email, testPassword, "laptop"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	tokens, err := f.login(alice.Email, testPassword, "phone")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	alert := waitForMail(t, f.mails, "New sign-in to your account")
+	if alert.to != alice.Email || !strings.Contains(alert.body, "phone") {
+		t.Fatalf("alert = %+v", alert)
+	}
+	token := linkToken(t, alert.body, "/api/v1/auth/not-me/")
+
+	// Opening the link changes nothing and can be repeated
+	for i := 0; i < 2; i++ {
+		if err := f.service.CheckUnrecognizedLogin(ctx, token); err != nil {
+			t.Fatalf("CheckUnrecognizedLogin: %v", err)
+		}
+	}
+	if f.reload(t, alice.Id).PasswordResetRequired {
+		t.Fatal("checking the link required a password reset")
+	}
+
+	if err := f.service.ReportUnrecognizedLogin(ctx, token); err != nil {
+		t.Fatalf("ReportUnrecognizedLogin: %v", err)
+	}
+
+	secured := f.reload(t, alice.Id)
+	if !secured.PasswordResetRequired {
+		t.Fatal("no password reset required after the report")
+	}
+	claims, err := f.authManager.VerifyToken(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch := int(claims["epoch"].(float64)); secured.TokenEpoch <= epoch {
+		t.Fatalf("token epoch %d not bumped past %d", secured.TokenEpoch, epoch)
+	}
+	if revoked, err := NewSessionService(repository.NewSessionRepository(f.db), f.redis, f.recorder, f.cfg).IsRevoked(ctx, claims["sid"].(string)); err != nil || !revoked {
+		t.Fatalf("IsRevoked = %v, %v, want the session revoked", revoked, err)
+	}
+	waitForMail(t, f.mails, "Reset your password")
+
+	// The link works once
+	if err := f.service.ReportUnrecognizedLogin(ctx, token); !errors.Is(err, errorpkg.ErrInvalidLink) {
+		t.Fatalf("second ReportUnrecognizedLogin = %v, want %v", err, errorpkg.ErrInvalidLink)
+	}
+	if err := f.service.CheckUnrecognizedLogin(ctx, token); !errors.Is(err, errorpkg.ErrInvalidLink) {
+		t.Fatalf("CheckUnrecognizedLogin of a used link = %v, want %v", err, errorpkg.ErrInvalidLink)
+	}
+}
+
+func TestReportUnrecognizedLoginRejectsOtherTokens(t *testing.T) {
+	f := newUserFixture(t, testConfig())
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+
+	unlock, err := f.authManager.GenerateUnlockToken(ctx, alice.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := f.authManager.GenerateAccessToken(ctx, alice.Id, alice.Email, "sid", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{unlock, access, "not-a-token"} {
+		if err := f.service.ReportUnrecognizedLogin(ctx, token); !errors.Is(err, errorpkg.ErrInvalidLink) {
+			t.Fatalf("ReportUnrecognizedLogin = %v, want %v", err, errorpkg.ErrInvalidLink)
+		}
+	}
+	if f.reload(t, alice.Id).PasswordResetRequired {
+		t.Fatal("a token of another type secured the account")
+	}
+}
+
+// outdatedUser stores an account whose password was hashed with bcrypt, before argon2id
+func (f *userFixture) outdatedUser(t *testing.T, email string) *user.User {
+	t.Helper()
+
+	bcryptHasher, err := password.NewHasher(config.PasswordConfig{HashAlgorithm: password.AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed, err := bcryptHasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &user.User{Username: "legacy", Email: email, Password: hashed, Status: user.StatusActive}
+	if err := f.users.Create(context.Background(), u); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return u
+}
+
+func TestLoginRehashesOutdatedPasswords(t *testing.T) {
+	f := newUserFixture(t, testConfig())
+	legacy := f.outdatedUser(t, "legacy@example.com")
+
+	if _, err := f.login(legacy.Email, testPassword, "laptop"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	stored := f.reload(t, legacy.Id).Password
+	if !strings.HasPrefix(stored, "$argon2id$") {
+		t.Fatalf("stored hash %q, want it migrated to argon2id", stored)
+	}
+
+	// The new hash works and is current, the next login leaves it alone
+	if _, err := f.login(legacy.Email, testPassword, "laptop"); err != nil {
+		t.Fatalf("login with the rehashed password: %v", err)
+	}
+	if again := f.reload(t, legacy.Id).Password; again != stored {
+		t.Fatal("a current hash was replaced")
+	}
+
+	// A wrong password never triggers a rehash
+	other := f.outdatedUser(t, "other@example.com")
+	f.login(other.Email, "wrong password", "laptop")
+	if kept := f.reload(t, other.Id).Password; kept != other.Password {
+		t.Fatal("a failed login replaced the stored hash")
+	}
+}
+
+func TestLoginLogsAFailedRehash(t *testing.T) {
+	f := newUserFixture(t, testConfig())
+	legacy := f.outdatedUser(t, "legacy@example.com")
+
+	f.hasher.failHash.Store(true)
+	if _, err := f.login(legacy.Email, testPassword, "laptop"); err != nil {
+		t.Fatalf("login = %v, a failed rehash must not block it", err)
+	}
+	if kept := f.reload(t, legacy.Id).Password; kept != legacy.Password {
+		t.Fatal("the stored hash changed although rehashing failed")
+	}
+
+	logged := f.logs.FilterMessage("failed to rehash password").All()
+	if len(logged) != 1 || logged[0].ContextMap()["user_id"] != int64(legacy.Id) {
+		t.Fatalf("logged %v, want the failed rehash with the user id", f.logs.All())
+	}
+}
+
+func resetCode(t *testing.T, body string) string {
+	t.Helper()
+
+	match := regexp.MustCompile(`code is (\d{6})`).FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("no reset code in %q", body)
+	}
+	return match[1]
+}
+
+func TestForgotPassword(t *testing.T) {
+	f := newUserFixture(t, testConfig())
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+
+	if err := f.service.ForgotPassword(ctx, alice.Email); err != nil {
+		t.Fatalf("ForgotPassword: %v", err)
+	}
+	code := resetCode(t, waitForMail(t, f.mails, "Reset your password").body)
+	// The code is stored under the email's blind index, never the address itself
+	if _, err := f.redis.Get(ctx, redis.ForgotPasswordKey(alice.Email)); err == nil {
+		t.Fatal("the reset code is keyed by the plaintext email")
+	}
+
+	// Emails match whatever case they are typed in
+	err := f.service.ResetPassword(ctx, &request.ResetPasswordRequest{Email: "Alice@Example.COM", Code: code, Password: "a brand new passphrase"})
+	if err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if _, err := f.login(alice.Email, "a brand new passphrase", "laptop"); err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+}
+
+func TestForgotPasswordTreatsUnknownEmailsAlike(t *testing.T) {
+	f := newUserFixture(t, testConfig())
+	ctx := context.Background()
+	const unknown = "nobody@example.com"
+
+	if err := f.service.ForgotPassword(ctx, unknown); err != nil {
+		t.Fatalf("ForgotPassword: %v", err)
+	}
+	assertNoMail(t, f.mails)
+
+	// The code is stored as for an account, so the request costs the same, but it opens nothing
+	code, err := f.redis.Get(ctx, redis.ForgotPasswordKey(f.users.EmailIndex(unknown)))
+	if err != nil {
+		t.Fatalf("no code stored for an unknown email: %v", err)
+	}
+	err = f.service.ResetPassword(ctx, &request.ResetPasswordRequest{Email: unknown, Code: code, Password: "a brand new passphrase"})
+	if !errors.Is(err, errorpkg.ErrInvalidResetCode) {
+		t.Fatalf("ResetPassword = %v, want %v", err, errorpkg.ErrInvalidResetCode)
+	}
+}
+
+func TestForgotPasswordWhileRedisIsDown(t *testing.T) {
+	for _, mode := range []string{config.FailClosed, config.FailOpen} {
+		t.Run(mode, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.RedisFailure.OTP = mode
+			f := newUserFixture(t, cfg)
+			alice := f.createUser(t, "alice@example.com")
+			f.cache.failWrites = true
+
+			// Registered or not, the answer is the same
+			for _, email := range []string{alice.Email, "nobody@example.com"} {
+				err := f.service.ForgotPassword(context.Background(), email)
+				if mode == config.FailClosed && !errors.Is(err, errorpkg.ErrServiceUnavailable) {
+					t.Fatalf("ForgotPassword(%s) = %v, want %v", email, err, errorpkg.ErrServiceUnavailable)
+				}
+				if mode == config.FailOpen && err != nil {
+					t.Fatalf("ForgotPassword(%s) = %v, want nil", email, err)
+				}
+			}
+			assertNoMail(t, f.mails)
+		})
+	}
+}
+
+func TestForgotPasswordReportsDatabaseErrors(t *testing.T) {
+	f := newUserFixture(t, testConfig())
+	f.db.Close()
+
+	err := f.service.ForgotPassword(context.Background(), "alice@example.com")
+	if err == nil || errors.Is(err, errorpkg.ErrUserNotFound) {
+		t.Fatalf("ForgotPassword = %v, want the database error", err)
+	}
+}
+
+func TestLoginReadsTheAccountFromThePrimary(t *testing.T) {
+	// The replica has none of the primary's rows, like one lagging behind the signup
+	f := newUserFixtureOn(t, testConfig(), testutil.NewReplicatedDB(t))
+	alice := f.createUser(t, "alice@example.com")
+
+	if _, err := f.login(alice.Email, testPassword, "laptop"); err != nil {
+		t.Fatalf("login = %v, the account was read from the replica", err)
+	}
+
+	// A lock set a moment ago on the primary holds at once
+	lockedUntil := time.Now().UTC().Add(time.Hour)
+	if _, err := f.db.Primary.Exec("UPDATE users SET locked_until = ? WHERE id = ?", lockedUntil, alice.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.login(alice.Email, testPassword, "laptop"); !errors.Is(err, errorpkg.ErrAccountLocked) {
+		t.Fatalf("login of a locked account = %v, want %v", err, errorpkg.ErrAccountLocked)
+	}
+}
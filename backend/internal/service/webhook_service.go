@@ -0,0 +1,534 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/domain/audit"
+	"github.com/imnzr/user-authentication-go/internal/domain/webhook"
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/imnzr/user-authentication-go/pkg/request"
+	"go.uber.org/zap"
+)
+
+const (
+	webhookSignatureHeader = "X-Webhook-Signature"
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+type webhookService struct {
+	webhookRepo webhook.Repository
+	audit       audit.Recorder
+	cfg         config.WebhookConfig
+	httpClient  *http.Client
+	logger      *zap.Logger
+
+	queue chan int
+	done  chan struct{}
+	// Held for reading while a fan-out is started, Close takes it for writing before waiting
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewWebhookService(webhookRepo webhook.Repository, recorder audit.Recorder, cfg config.WebhookConfig, logger *zap.Logger) webhook.Service {
+	s := &webhookService{
+		webhookRepo: webhookRepo,
+		audit:       recorder,
+		cfg:         cfg,
+		httpClient:  newWebhookClient(cfg),
+		logger:      logger,
+		queue:       make(chan int, cfg.QueueSize),
+		done:        make(chan struct{}),
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	s.wg.Add(1)
+	go s.sweeper()
+
+	return s
+}
+
+// SignPayload returns the value of the signature header for a payload.
+// Receivers recompute HMAC-SHA256(secret, "<timestamp>.<body>") and compare it with v1.
+func SignPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// newWebhookClient refuses to connect to private and loopback addresses unless they are
+// allowed. The check runs on the address actually dialed, so it also covers redirects and
+// names that resolve to an internal address, whatever they resolved to when validated.
+func newWebhookClient(cfg config.WebhookConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.AllowPrivateNetworks {
+		dialer := &net.Dialer{Timeout: cfg.Timeout, KeepAlive: 30 * time.Second, Control: refusePrivateAddress}
+		transport.DialContext = dialer.DialContext
+		// A proxy would be the address checked instead of the receiver
+		transport.Proxy = nil
+	}
+	return &http.Client{Timeout: cfg.Timeout, Transport: transport}
+}
+
+var errWebhookPrivateAddress = errors.New("webhook target is a private or loopback address")
+
+func refusePrivateAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !isPublicAddress(addr) {
+		return fmt.Errorf("%w: %s", errWebhookPrivateAddress, host)
+	}
+	return nil
+}
+
+// Ranges net/netip has no predicate for that still don't reach the internet
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// isPublicAddress rejects loopback, RFC 1918 and unique local, link-local (which holds the
+// cloud metadata endpoints), multicast and unspecified addresses
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateWebhookURL refuses what can be told from the URL alone, a host name that resolves to
+// an internal address is refused when a delivery dials it
+func (s *webhookService) validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return errorpkg.ErrWebhookInvalidURL
+	}
+	if s.cfg.AllowPrivateNetworks {
+		return nil
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", errorpkg.ErrWebhookInvalidURL, errWebhookPrivateAddress)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !isPublicAddress(addr) {
+		return fmt.Errorf("%w: %s", errorpkg.ErrWebhookInvalidURL, errWebhookPrivateAddress)
+	}
+	return nil
+}
+
+func (s *webhookService) validateWebhookRequest(req *request.WebhookSubscriptionRequest) ([]webhook.EventType, error) {
+	if err := s.validateWebhookURL(req.URL); err != nil {
+		return nil, err
+	}
+	if len(req.Events) == 0 {
+		return nil, errorpkg.ErrWebhookInvalidEvent
+	}
+
+	events := make([]webhook.EventType, 0, len(req.Events))
+	for _, e := range req.Events {
+		eventType := webhook.EventType(e)
+		if eventType != webhook.EventAll && !isKnownEvent(eventType) {
+			return nil, fmt.Errorf("%w: %s", errorpkg.ErrWebhookInvalidEvent, e)
+		}
+		events = append(events, eventType)
+	}
+
+	return events, nil
+}
+
+// webhookHost is what the audit trail keeps of a URL, the path and query often carry a token
+func webhookHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.Host
+}
+
+func isKnownEvent(eventType webhook.EventType) bool {
+	for _, known := range webhook.KnownEvents {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateSubscription implements webhook.Service.
+// The secret is only returned here and on rotation, it is never listed again.
+func (s *webhookService) CreateSubscription(ctx context.Context, req *request.WebhookSubscriptionRequest, adminId int) (*webhook.Subscription, string, error) {
+	events, err := s.validateWebhookRequest(req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	sub := &webhook.Subscription{
+		URL:    req.URL,
+		Secret: secret,
+		Events: events,
+		Active: true,
+	}
+	if err := s.webhookRepo.CreateSubscription(ctx, sub); err != nil {
+		return nil, "", err
+	}
+
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionWebhookCreated, audit.OutcomeSuccess, audit.AdminActor(adminId), 0).
+		With("subscription_id", sub.Id).
+		With("host", webhookHost(sub.URL)).
+		With("events", req.Events))
+
+	return sub, secret, nil
+}
+
+// ListSubscriptions implements webhook.Service.
+func (s *webhookService) ListSubscriptions(ctx context.Context) ([]*webhook.Subscription, error) {
+	return s.webhookRepo.ListSubscriptions(ctx)
+}
+
+// DeleteSubscription implements webhook.Service.
+func (s *webhookService) DeleteSubscription(ctx context.Context, id int, adminId int) error {
+	if err := s.webhookRepo.DeleteSubscription(ctx, id); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionWebhookDeleted, audit.OutcomeSuccess, audit.AdminActor(adminId), 0).
+		With("subscription_id", id))
+	return nil
+}
+
+// RotateSecret implements webhook.Service.
+func (s *webhookService) RotateSecret(ctx context.Context, id int, adminId int) (string, error) {
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := s.webhookRepo.UpdateSubscriptionSecret(ctx, id, secret); err != nil {
+		return "", err
+	}
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionWebhookSecretRotated, audit.OutcomeSuccess, audit.AdminActor(adminId), 0).
+		With("subscription_id", id))
+	return secret, nil
+}
+
+// ListDeliveries implements webhook.Service.
+func (s *webhookService) ListDeliveries(ctx context.Context, subscriptionId int, limit int) ([]*webhook.Delivery, error) {
+	if _, err := s.webhookRepo.GetSubscription(ctx, subscriptionId); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	return s.webhookRepo.ListDeliveries(ctx, subscriptionId, limit)
+}
+
+// ReplayDelivery implements webhook.Service.
+// A replay is logged as a new delivery with the same event id so receivers can deduplicate.
+func (s *webhookService) ReplayDelivery(ctx context.Context, deliveryId int, adminId int) (*webhook.Delivery, error) {
+	original, err := s.webhookRepo.GetDelivery(ctx, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+
+	replay := &webhook.Delivery{
+		SubscriptionId: original.SubscriptionId,
+		EventId:        original.EventId,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		Status:         webhook.DeliveryPending,
+		NextAttemptAt:  time.Now().Add(s.cfg.DeliveryLease),
+	}
+	if err := s.webhookRepo.CreateDelivery(ctx, replay); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, audit.NewEvent(audit.ActionWebhookReplayed, audit.OutcomeSuccess, audit.AdminActor(adminId), 0).
+		With("subscription_id", replay.SubscriptionId).
+		With("delivery_id", original.Id).
+		With("replay_id", replay.Id).
+		With("event_id", replay.EventId))
+	s.enqueue(replay.Id)
+
+	return replay, nil
+}
+
+// Publish implements webhook.Publisher.
+// Fan-out happens in the background so a slow database never delays the caller.
+func (s *webhookService) Publish(ctx context.Context, eventType webhook.EventType, data map[string]interface{}) {
+	event := webhook.Event{
+		Id:         uuid.NewString(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		s.logger.Warn("webhook service is closed, event dropped",
+			zap.String("event_id", event.Id),
+			zap.String("event_type", string(event.Type)),
+		)
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.fanOut(context.Background(), event); err != nil {
+			s.logger.Error("failed to publish webhook event",
+				zap.String("event_id", event.Id),
+				zap.String("event_type", string(event.Type)),
+				zap.Error(err),
+			)
+		}
+	}()
+}
+
+func (s *webhookService) fanOut(ctx context.Context, event webhook.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	subs, err := s.webhookRepo.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		if !sub.Matches(event.Type) {
+			continue
+		}
+		delivery := &webhook.Delivery{
+			SubscriptionId: sub.Id,
+			EventId:        event.Id,
+			EventType:      event.Type,
+			Payload:        string(payload),
+			Status:         webhook.DeliveryPending,
+			// Queued right away, the sweeper only takes it if no worker finished it by then
+			NextAttemptAt: time.Now().Add(s.cfg.DeliveryLease),
+		}
+		if err := s.webhookRepo.CreateDelivery(ctx, delivery); err != nil {
+			return err
+		}
+		s.enqueue(delivery.Id)
+	}
+
+	return nil
+}
+
+func (s *webhookService) enqueue(deliveryId int) {
+	select {
+	case <-s.done:
+	case s.queue <- deliveryId:
+	default:
+		// Delivery stays pending in the log, the sweeper hands it out again once its lease ends
+		s.logger.Warn("webhook queue is full, delivery postponed", zap.Int("delivery_id", deliveryId))
+	}
+}
+
+// sweeper queues the deliveries that are due from the database. Retries are scheduled there
+// instead of in memory, so neither a restart nor a full queue loses them.
+func (s *webhookService) sweeper() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.sweep(context.Background())
+		}
+	}
+}
+
+func (s *webhookService) sweep(ctx context.Context) {
+	free := cap(s.queue) - len(s.queue)
+	if free <= 0 {
+		return
+	}
+
+	now := time.Now()
+	ids, err := s.webhookRepo.ListDueDeliveries(ctx, now, free)
+	if err != nil {
+		s.logger.Error("failed to list due webhook deliveries", zap.Error(err))
+		return
+	}
+
+	for _, id := range ids {
+		// Another instance sweeping the same table may have taken it
+		claimed, err := s.webhookRepo.ClaimDelivery(ctx, id, now, now.Add(s.cfg.DeliveryLease))
+		if err != nil {
+			s.logger.Error("failed to claim webhook delivery", zap.Int("delivery_id", id), zap.Error(err))
+			return
+		}
+		if claimed {
+			s.enqueue(id)
+		}
+	}
+}
+
+func (s *webhookService) worker() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.done:
+			return
+		case id := <-s.queue:
+			s.deliver(id)
+		}
+	}
+}
+
+func (s *webhookService) deliver(deliveryId int) {
+	ctx := context.Background()
+
+	delivery, err := s.webhookRepo.GetDelivery(ctx, deliveryId)
+	if err != nil {
+		s.logger.Error("failed to load webhook delivery", zap.Int("delivery_id", deliveryId), zap.Error(err))
+		return
+	}
+	// Handed out again after its lease while an earlier attempt was still running
+	if delivery.Status == webhook.DeliverySucceeded || delivery.Status == webhook.DeliveryFailed {
+		return
+	}
+
+	sub, err := s.webhookRepo.GetSubscription(ctx, delivery.SubscriptionId)
+	if err != nil || !sub.Active {
+		delivery.Status = webhook.DeliveryFailed
+		delivery.LastError = "subscription is no longer active"
+		delivery.NextAttemptAt = time.Time{}
+		s.saveDelivery(ctx, delivery)
+		return
+	}
+
+	delivery.Attempts++
+	delivery.ResponseCode, err = s.send(ctx, sub, delivery)
+	if err == nil {
+		delivery.Status = webhook.DeliverySucceeded
+		delivery.LastError = ""
+		delivery.NextAttemptAt = time.Time{}
+		s.saveDelivery(ctx, delivery)
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= s.cfg.MaxAttempts {
+		delivery.Status = webhook.DeliveryFailed
+		delivery.NextAttemptAt = time.Time{}
+		s.saveDelivery(ctx, delivery)
+		return
+	}
+
+	// The sweeper picks it up once the backoff is over
+	delivery.Status = webhook.DeliveryRetrying
+	delivery.NextAttemptAt = time.Now().Add(s.backoff(delivery.Attempts))
+	s.saveDelivery(ctx, delivery)
+}
+
+func (s *webhookService) send(ctx context.Context, sub *webhook.Subscription, delivery *webhook.Delivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, string(delivery.EventType))
+	req.Header.Set(webhookDeliveryHeader, strconv.Itoa(delivery.Id))
+	req.Header.Set(webhookSignatureHeader, SignPayload(sub.Secret, time.Now().Unix(), body))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff doubles the wait for every failed attempt up to BackoffMax
+func (s *webhookService) backoff(attempt int) time.Duration {
+	wait := s.cfg.BackoffBase
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if wait >= s.cfg.BackoffMax {
+			return s.cfg.BackoffMax
+		}
+	}
+	return wait
+}
+
+func (s *webhookService) saveDelivery(ctx context.Context, delivery *webhook.Delivery) {
+	if err := s.webhookRepo.UpdateDelivery(ctx, delivery); err != nil {
+		s.logger.Error("failed to update webhook delivery", zap.Int("delivery_id", delivery.Id), zap.Error(err))
+	}
+}
+
+// Close implements webhook.Service. Events published after it are dropped.
+func (s *webhookService) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
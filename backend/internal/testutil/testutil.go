@@ -0,0 +1,130 @@
+// Package testutil sets up the in-memory backends tests run against, SQLite and the
+// in-memory Redis client, so they need no database or Redis server
+package testutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"github.com/imnzr/user-authentication-go/internal/database"
+	"github.com/imnzr/user-authentication-go/internal/database/migrate"
+	"github.com/imnzr/user-authentication-go/pkg/pii"
+)
+
+// NewDB opens a migrated in-memory SQLite database that is closed when the test ends
+func NewDB(t testing.TB) *database.DB {
+	t.Helper()
+
+	db := openDB(t, sqliteConfig())
+	migrateDB(t, db)
+	return db
+}
+
+// NewEmptyDB opens an in-memory SQLite database without any tables
+func NewEmptyDB(t testing.TB) *database.DB {
+	t.Helper()
+
+	return openDB(t, sqliteConfig())
+}
+
+// NewReplicatedDB is NewDB with one replica that never gets any of the primary's tables or
+// rows, so anything read from it instead of the primary fails
+func NewReplicatedDB(t testing.TB) *database.DB {
+	t.Helper()
+
+	cfg := sqliteConfig()
+	cfg.Replicas = []config.MySQLConnection{{Host: "replica", Port: 3306, Database: ":memory:"}}
+	cfg.Replica = config.ReplicaConfig{HealthCheckInterval: time.Hour, HealthCheckTimeout: time.Second}
+	db := openDB(t, cfg)
+	migrateDB(t, db)
+	return db
+}
+
+func sqliteConfig() *config.DatabaseConfig {
+	return &config.DatabaseConfig{
+		Driver:  config.DatabaseDriverSQLite,
+		Primary: config.MySQLConnection{Database: ":memory:"},
+		MySQL:   config.MySQLConfig{Timeout: time.Second},
+		// The in-memory database is freed once no connection is open, keep one idle
+		Pool: config.PoolConfig{MaxOpenConns: 4, MaxIdleConns: 4},
+		Transaction: config.TransactionConfig{
+			MaxRetries:   3,
+			RetryBackoff: time.Millisecond,
+		},
+	}
+}
+
+func openDB(t testing.TB, cfg *config.DatabaseConfig) *database.DB {
+	t.Helper()
+
+	db, err := database.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func migrateDB(t testing.TB, db *database.DB) {
+	t.Helper()
+
+	source, err := migrate.Source(db.Dialect, "")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	migrator, err := migrate.New(db.Primary, db.Dialect, source, time.Second)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+}
+
+// NewKeyring returns a PII keyring with a fresh random key for every id in masterKeyIds,
+// the last one is active. Without ids it has a single key "k1".
+func NewKeyring(t testing.TB, masterKeyIds ...string) *pii.Keyring {
+	t.Helper()
+
+	if len(masterKeyIds) == 0 {
+		masterKeyIds = []string{"k1"}
+	}
+	var masterKeys string
+	for _, id := range masterKeyIds {
+		masterKeys += id + ":" + generateKey(t) + "\n"
+	}
+
+	dir := t.TempDir()
+	masterKeyFile := filepath.Join(dir, "master.keys")
+	indexKeyFile := filepath.Join(dir, "index.key")
+	writeFile(t, masterKeyFile, masterKeys)
+	writeFile(t, indexKeyFile, generateKey(t))
+
+	keyring, err := pii.LoadKeyring(masterKeyFile, indexKeyFile)
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+	return keyring
+}
+
+func generateKey(t testing.TB) string {
+	t.Helper()
+
+	key, err := pii.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+func writeFile(t testing.TB, name string, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
@@ -0,0 +1,15 @@
+// Package migrations ships the schema with the binary, one directory per database driver.
+//
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql, the version is a
+// UTC timestamp (YYYYMMDDhhmmss). Statements are separated by semicolons, so MySQL trigger
+// and procedure bodies with BEGIN ... END blocks can't be used. Postgres function bodies
+// go in dollar quotes, SQLite CREATE TRIGGER ... BEGIN ... END is kept whole.
+//
+// The postgres and sqlite directories start from the schema the mysql one had reached,
+// there was never an older schema to upgrade on either.
+package migrations
+
+import "embed"
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var FS embed.FS
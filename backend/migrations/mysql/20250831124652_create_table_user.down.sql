@@ -1,2 +1 @@
 DROP TABLE IF EXISTS users;
-DROP COLUMN phone_number;
\ No newline at end of file
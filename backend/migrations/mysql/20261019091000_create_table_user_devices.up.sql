@@ -0,0 +1,12 @@
+CREATE TABLE user_devices(
+    id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(512) NOT NULL,
+    first_seen_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    UNIQUE KEY uq_user_devices_fingerprint (user_id, fingerprint),
+    CONSTRAINT fk_user_devices_user FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,12 @@
+CREATE TABLE user_sessions(
+    id CHAR(36) NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(512) NOT NULL,
+    created_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL,
+    INDEX idx_user_sessions_user (user_id, revoked_at),
+    CONSTRAINT fk_user_sessions_user FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
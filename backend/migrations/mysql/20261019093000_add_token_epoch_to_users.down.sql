@@ -0,0 +1,3 @@
+ALTER TABLE users MODIFY COLUMN status ENUM('pending', 'active') DEFAULT 'pending';
+ALTER TABLE users
+DROP COLUMN token_epoch;
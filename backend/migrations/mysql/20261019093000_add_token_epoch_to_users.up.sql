@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN token_epoch INT NOT NULL DEFAULT 0;
+ALTER TABLE users MODIFY COLUMN status ENUM('pending', 'active', 'suspended') DEFAULT 'pending';
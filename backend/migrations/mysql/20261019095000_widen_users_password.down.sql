@@ -0,0 +1 @@
+ALTER TABLE users MODIFY COLUMN password VARCHAR(100) NOT NULL;
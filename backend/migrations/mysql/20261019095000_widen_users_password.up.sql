@@ -0,0 +1 @@
+ALTER TABLE users MODIFY COLUMN password VARCHAR(255) NOT NULL;
@@ -0,0 +1,17 @@
+CREATE TABLE audit_events(
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    action VARCHAR(64) NOT NULL,
+    outcome VARCHAR(16) NOT NULL,
+    actor VARCHAR(64) NOT NULL,
+    actor_id INT NULL,
+    target_id INT NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    metadata JSON NULL,
+    created_at DATETIME(6) NOT NULL,
+    INDEX idx_audit_events_target (target_id, id),
+    INDEX idx_audit_events_actor (actor_id, id),
+    INDEX idx_audit_events_action (action, id),
+    INDEX idx_audit_events_created (created_at)
+);
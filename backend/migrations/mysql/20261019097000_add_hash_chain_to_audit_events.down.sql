@@ -0,0 +1,5 @@
+ALTER TABLE audit_events
+DROP INDEX idx_audit_events_chain,
+DROP COLUMN chain_day,
+DROP COLUMN prev_hash,
+DROP COLUMN hash;
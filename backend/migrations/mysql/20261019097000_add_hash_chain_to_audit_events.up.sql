@@ -0,0 +1,5 @@
+ALTER TABLE audit_events
+ADD COLUMN chain_day DATE NULL,
+ADD COLUMN prev_hash CHAR(64) NULL,
+ADD COLUMN hash CHAR(64) NULL,
+ADD INDEX idx_audit_events_chain (chain_day, id);
@@ -0,0 +1,6 @@
+CREATE TABLE audit_chain_heads(
+    chain_day DATE NOT NULL PRIMARY KEY,
+    last_event_id BIGINT NOT NULL,
+    last_hash CHAR(64) NOT NULL,
+    event_count INT NOT NULL
+);
@@ -0,0 +1,11 @@
+CREATE TABLE audit_checkpoints(
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    chain_day DATE NOT NULL,
+    last_event_id BIGINT NOT NULL,
+    last_hash CHAR(64) NOT NULL,
+    event_count INT NOT NULL,
+    key_id VARCHAR(32) NOT NULL,
+    signature VARCHAR(128) NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    INDEX idx_audit_checkpoints_day (chain_day, id)
+);
@@ -0,0 +1,9 @@
+-- Rows the re-encryption job already migrated have no plaintext left, decrypt them first
+ALTER TABLE users
+    DROP COLUMN pii_key_id,
+    DROP COLUMN pii_data_key,
+    DROP COLUMN email_bidx,
+    DROP COLUMN email_encrypted,
+    DROP COLUMN username_encrypted,
+    MODIFY email VARCHAR(100) NOT NULL,
+    MODIFY username VARCHAR(100) NOT NULL;
@@ -0,0 +1,8 @@
+ALTER TABLE users
+    MODIFY username VARCHAR(100) NULL,
+    MODIFY email VARCHAR(100) NULL,
+    ADD COLUMN username_encrypted TEXT NULL,
+    ADD COLUMN email_encrypted TEXT NULL,
+    ADD COLUMN email_bidx CHAR(64) NULL,
+    ADD COLUMN pii_data_key VARCHAR(255) NULL,
+    ADD COLUMN pii_key_id VARCHAR(64) NULL;
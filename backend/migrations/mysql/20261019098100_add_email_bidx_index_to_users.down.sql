@@ -0,0 +1 @@
+DROP INDEX idx_users_email_bidx ON users;
@@ -0,0 +1 @@
+CREATE UNIQUE INDEX idx_users_email_bidx ON users (email_bidx);
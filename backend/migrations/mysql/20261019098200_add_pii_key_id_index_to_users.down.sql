@@ -0,0 +1 @@
+DROP INDEX idx_users_pii_key_id ON users;
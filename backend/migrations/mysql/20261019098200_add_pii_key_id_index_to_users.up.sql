@@ -0,0 +1 @@
+CREATE INDEX idx_users_pii_key_id ON users (pii_key_id);
@@ -0,0 +1,3 @@
+DROP INDEX idx_webhook_deliveries_due ON webhook_deliveries;
+
+ALTER TABLE webhook_deliveries DROP COLUMN next_attempt_at;
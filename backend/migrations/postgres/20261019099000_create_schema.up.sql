@@ -0,0 +1,129 @@
+-- The schema the mysql migrations had reached when Postgres support was added
+CREATE TABLE users(
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(100) NULL,
+    email VARCHAR(100) NULL,
+    username_encrypted TEXT NULL,
+    email_encrypted TEXT NULL,
+    email_bidx CHAR(64) NULL,
+    pii_data_key VARCHAR(255) NULL,
+    pii_key_id VARCHAR(64) NULL,
+    password VARCHAR(255) NOT NULL,
+    phone_number VARCHAR(15) NULL,
+    status VARCHAR(16) DEFAULT 'pending' CHECK (status IN ('pending', 'active', 'suspended')),
+    role VARCHAR(16) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+    password_reset_required BOOLEAN NOT NULL DEFAULT FALSE,
+    token_epoch INT NOT NULL DEFAULT 0,
+    failed_login_attempts INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP NULL,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_users_email_bidx ON users (email_bidx);
+CREATE INDEX idx_users_pii_key_id ON users (pii_key_id);
+
+CREATE TABLE webhook_subscriptions(
+    id SERIAL PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    events VARCHAR(1024) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE webhook_deliveries(
+    id SERIAL PRIMARY KEY,
+    subscription_id INT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id VARCHAR(64) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'retrying', 'succeeded', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    response_code INT NULL,
+    last_error VARCHAR(1024) NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_webhook_deliveries_subscription ON webhook_deliveries (subscription_id, created_at);
+
+CREATE TABLE user_devices(
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    fingerprint CHAR(64) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(512) NOT NULL,
+    first_seen_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    CONSTRAINT uq_user_devices_fingerprint UNIQUE (user_id, fingerprint)
+);
+
+CREATE TABLE user_sessions(
+    id CHAR(36) NOT NULL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip_address VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(512) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL
+);
+
+CREATE INDEX idx_user_sessions_user ON user_sessions (user_id, revoked_at);
+
+-- metadata is JSON, not JSONB, so the stored text is the text that was hashed
+CREATE TABLE audit_events(
+    id BIGSERIAL PRIMARY KEY,
+    action VARCHAR(64) NOT NULL,
+    outcome VARCHAR(16) NOT NULL,
+    actor VARCHAR(64) NOT NULL,
+    actor_id INT NULL,
+    target_id INT NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    metadata JSON NULL,
+    created_at TIMESTAMP(6) NOT NULL,
+    chain_day DATE NULL,
+    prev_hash CHAR(64) NULL,
+    hash CHAR(64) NULL
+);
+
+CREATE INDEX idx_audit_events_target ON audit_events (target_id, id);
+CREATE INDEX idx_audit_events_actor ON audit_events (actor_id, id);
+CREATE INDEX idx_audit_events_action ON audit_events (action, id);
+CREATE INDEX idx_audit_events_created ON audit_events (created_at);
+CREATE INDEX idx_audit_events_chain ON audit_events (chain_day, id);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only' USING ERRCODE = '45000';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TABLE audit_chain_heads(
+    chain_day DATE NOT NULL PRIMARY KEY,
+    last_event_id BIGINT NOT NULL,
+    last_hash CHAR(64) NOT NULL,
+    event_count INT NOT NULL
+);
+
+CREATE TABLE audit_checkpoints(
+    id BIGSERIAL PRIMARY KEY,
+    chain_day DATE NOT NULL,
+    last_event_id BIGINT NOT NULL,
+    last_hash CHAR(64) NOT NULL,
+    event_count INT NOT NULL,
+    key_id VARCHAR(32) NOT NULL,
+    signature VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP(6) NOT NULL
+);
+
+CREATE INDEX idx_audit_checkpoints_day ON audit_checkpoints (chain_day, id);
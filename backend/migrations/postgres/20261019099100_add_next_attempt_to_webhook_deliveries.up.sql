@@ -0,0 +1,5 @@
+ALTER TABLE webhook_deliveries ADD COLUMN next_attempt_at TIMESTAMP NULL;
+
+UPDATE webhook_deliveries SET next_attempt_at = updated_at WHERE status IN ('pending', 'retrying');
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
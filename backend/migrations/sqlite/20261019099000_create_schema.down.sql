@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS audit_checkpoints;
+DROP TABLE IF EXISTS audit_chain_heads;
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS user_sessions;
+DROP TABLE IF EXISTS user_devices;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_webhook_deliveries_due;
+
+ALTER TABLE webhook_deliveries DROP COLUMN next_attempt_at;
@@ -10,6 +10,8 @@ type AuthManager interface {
 	// Verifify User Create
 	VerifyToken(ctx context.Context, tokenString string) (jwt.MapClaims, error)
 	GenerateTokenVerif(ctx context.Context, email string) (string, error)
-	GenerateAccessToken(ctx context.Context, userId int, email string) (string, error)
-	GenerateRefreshToken(ctx context.Context, userId int) (string, error)
+	GenerateAccessToken(ctx context.Context, userId int, email string, sessionId string, epoch int) (string, error)
+	GenerateRefreshToken(ctx context.Context, userId int, sessionId string, epoch int) (string, error)
+	GenerateDeviceRevokeToken(ctx context.Context, userId int) (string, error)
+	GenerateUnlockToken(ctx context.Context, userId int) (string, error)
 }
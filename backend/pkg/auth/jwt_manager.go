@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/imnzr/user-authentication-go/internal/config"
 )
 
@@ -17,7 +18,7 @@ type jwtManager struct {
 
 func NewJWTManager(cfg config.Config) AuthManager {
 	return &jwtManager{
-		JWTSecretKey:         []byte(cfg.JSONWebToken.JWTSecretKey),
+		JWTSecretKey:         []byte(cfg.JSONWebToken.JWTSecretKey.Value()),
 		accessTokenDuration:  cfg.JSONWebToken.AccessTokenDuration,
 		refreshTokenDuration: cfg.JSONWebToken.RefreshTokenDuration,
 	}
@@ -25,12 +26,14 @@ func NewJWTManager(cfg config.Config) AuthManager {
 
 // VerifyToken implements AuthManager.
 func (j *jwtManager) VerifyToken(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	// Every token carries exp, one without it was issued before expiry was enforced and would
+	// otherwise never expire
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(j.JWTSecretKey), nil
-	})
+	}, jwt.WithExpirationRequired())
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
 	}
@@ -44,32 +47,69 @@ func (j *jwtManager) VerifyToken(ctx context.Context, tokenString string) (jwt.M
 }
 
 // GenerateAccessToken implements AuthManager.
-func (j *jwtManager) GenerateAccessToken(ctx context.Context, userId int, email string) (string, error) {
+func (j *jwtManager) GenerateAccessToken(ctx context.Context, userId int, email string, sessionId string, epoch int) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userId,
-		"email":   email,
-		"expired": time.Now().Add(j.accessTokenDuration).Unix(),
+		"user_id":   userId,
+		"email":     email,
+		"sid":       sessionId,
+		"jti":       uuid.NewString(),
+		"epoch":     epoch,
+		"issued_at": time.Now().Unix(),
+		"exp":       jwt.NewNumericDate(time.Now().Add(j.accessTokenDuration)),
+		"type":      "access",
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(j.JWTSecretKey)
 }
 
 // GenerateRefreshToken implements AuthManager.
-func (j *jwtManager) GenerateRefreshToken(ctx context.Context, userId int) (string, error) {
+func (j *jwtManager) GenerateRefreshToken(ctx context.Context, userId int, sessionId string, epoch int) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userId,
-		"expired": time.Now().Add(j.refreshTokenDuration).Unix(),
-		"type":    "refresh",
+		"user_id":   userId,
+		"sid":       sessionId,
+		"jti":       uuid.NewString(),
+		"epoch":     epoch,
+		"issued_at": time.Now().Unix(),
+		"exp":       jwt.NewNumericDate(time.Now().Add(j.refreshTokenDuration)),
+		"type":      "refresh",
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(j.JWTSecretKey)
 }
 
 // GenerateTokenVerif implements AuthManager.
+// The type keeps an access token, which also carries the email, from verifying an account.
 func (j *jwtManager) GenerateTokenVerif(ctx context.Context, email string) (string, error) {
 	claims := jwt.MapClaims{
-		"email":   email,
-		"expired": time.Now().Add(15 * time.Minute).Unix(),
+		"email": email,
+		"exp":   jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+		"type":  "email_verify",
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(j.JWTSecretKey)
+}
+
+// GenerateDeviceRevokeToken implements AuthManager.
+// The jti lets the link be used once.
+func (j *jwtManager) GenerateDeviceRevokeToken(ctx context.Context, userId int) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userId,
+		"jti":     uuid.NewString(),
+		"exp":     jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+		"type":    "device_revoke",
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(j.JWTSecretKey)
+}
+
+// GenerateUnlockToken implements AuthManager.
+// The jti lets the link be used once.
+func (j *jwtManager) GenerateUnlockToken(ctx context.Context, userId int) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userId,
+		"jti":     uuid.NewString(),
+		"exp":     jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+		"type":    "account_unlock",
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(j.JWTSecretKey)
@@ -0,0 +1,182 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// States, the gauge exports the numeric value
+const (
+	StateClosed   = "closed"
+	StateHalfOpen = "half_open"
+	StateOpen     = "open"
+)
+
+var stateValues = map[string]float64{
+	StateClosed:   0,
+	StateHalfOpen: 1,
+	StateOpen:     2,
+}
+
+// ErrOpen is returned without calling the dependency while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+type Config struct {
+	// Consecutive failures that open the breaker
+	Threshold int
+	// How long the breaker stays open before a single probe call is let through
+	Cooldown time.Duration
+}
+
+// Snapshot is the breaker state reported by health checks
+type Snapshot struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+// Breaker stops calling a dependency after it failed Threshold times in a row, so
+// callers get an answer right away instead of waiting on timeouts
+type Breaker struct {
+	name      string
+	cfg       Config
+	isFailure func(error) bool
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+
+	stateGauge  prometheus.Gauge
+	transitions *prometheus.CounterVec
+	rejected    prometheus.Counter
+}
+
+// New registers the breaker metrics with reg, labelled with name. isFailure decides which
+// errors count against the dependency, e.g. a missing key doesn't.
+func New(name string, cfg Config, isFailure func(error) bool, reg prometheus.Registerer) (*Breaker, error) {
+	if cfg.Threshold <= 0 {
+		return nil, errors.New("circuit breaker threshold must be positive")
+	}
+	if isFailure == nil {
+		isFailure = func(err error) bool { return err != nil }
+	}
+
+	labels := prometheus.Labels{"name": name}
+	b := &Breaker{
+		name:      name,
+		cfg:       cfg,
+		isFailure: isFailure,
+		state:     StateClosed,
+		stateGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "circuit_breaker_state",
+			Help:        "Circuit breaker state, 0 closed, 1 half open, 2 open.",
+			ConstLabels: labels,
+		}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "circuit_breaker_transitions_total",
+			Help:        "Circuit breaker state changes by the state entered.",
+			ConstLabels: labels,
+		}, []string{"state"}),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "circuit_breaker_rejected_total",
+			Help:        "Calls refused without reaching the dependency because the breaker was open.",
+			ConstLabels: labels,
+		}),
+	}
+
+	if reg != nil {
+		for _, c := range []prometheus.Collector{b.stateGauge, b.transitions, b.rejected} {
+			if err := reg.Register(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b, nil
+}
+
+// Do runs fn unless the breaker is open. A nil Breaker always runs fn.
+func (b *Breaker) Do(fn func() error) error {
+	if b == nil {
+		return fn()
+	}
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := fn()
+	b.record(b.isFailure(err))
+	return err
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			b.rejected.Inc()
+			return ErrOpen
+		}
+		b.setState(StateHalfOpen)
+		b.probing = true
+	case StateHalfOpen:
+		// One probe at a time, the rest wait for its result
+		if b.probing {
+			b.rejected.Inc()
+			return ErrOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		if b.state != StateClosed {
+			b.setState(StateClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || (b.state == StateClosed && b.failures >= b.cfg.Threshold) {
+		b.openedAt = time.Now()
+		b.setState(StateOpen)
+	}
+}
+
+// setState must be called with mu held
+func (b *Breaker) setState(state string) {
+	b.state = state
+	b.stateGauge.Set(stateValues[state])
+	b.transitions.WithLabelValues(state).Inc()
+}
+
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := Snapshot{
+		Name:                b.name,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		snapshot.OpenedAt = &openedAt
+	}
+	return snapshot
+}
@@ -0,0 +1,161 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var errDown = errors.New("dependency down")
+
+func newTestBreaker(t *testing.T, cfg Config, isFailure func(error) bool) *Breaker {
+	t.Helper()
+
+	b, err := New("test", cfg, isFailure, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return b
+}
+
+// call runs one call through the breaker and reports whether it reached the dependency
+func call(b *Breaker, result error) (bool, error) {
+	reached := false
+	err := b.Do(func() error {
+		reached = true
+		return result
+	})
+	return reached, err
+}
+
+func assertState(t *testing.T, b *Breaker, state string) {
+	t.Helper()
+
+	if got := b.Snapshot().State; got != state {
+		t.Fatalf("state = %s, want %s", got, state)
+	}
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b := newTestBreaker(t, Config{Threshold: 3, Cooldown: time.Hour}, nil)
+
+	call(b, errDown)
+	call(b, errDown)
+	// A success in between starts the count again
+	call(b, nil)
+	call(b, errDown)
+	call(b, errDown)
+	assertState(t, b, StateClosed)
+	if n := b.Snapshot().ConsecutiveFailures; n != 2 {
+		t.Fatalf("ConsecutiveFailures = %d, want 2", n)
+	}
+
+	if _, err := call(b, errDown); !errors.Is(err, errDown) {
+		t.Fatalf("third failure = %v, want the dependency's error", err)
+	}
+	assertState(t, b, StateOpen)
+	if b.Snapshot().OpenedAt == nil {
+		t.Fatal("an open breaker has no OpenedAt")
+	}
+
+	// While open the dependency isn't called at all
+	if reached, err := call(b, nil); reached || !errors.Is(err, ErrOpen) {
+		t.Fatalf("call while open reached = %v, err = %v, want %v", reached, err, ErrOpen)
+	}
+}
+
+func TestBreakerProbesAfterTheCooldown(t *testing.T) {
+	b := newTestBreaker(t, Config{Threshold: 1, Cooldown: 20 * time.Millisecond}, nil)
+	call(b, errDown)
+	assertState(t, b, StateOpen)
+
+	// A failed probe opens the breaker for another cooldown
+	time.Sleep(30 * time.Millisecond)
+	if reached, _ := call(b, errDown); !reached {
+		t.Fatal("no probe after the cooldown")
+	}
+	assertState(t, b, StateOpen)
+	if reached, _ := call(b, nil); reached {
+		t.Fatal("a call went through right after a failed probe")
+	}
+
+	// A successful probe closes it
+	time.Sleep(30 * time.Millisecond)
+	if reached, err := call(b, nil); !reached || err != nil {
+		t.Fatalf("probe reached = %v, err = %v", reached, err)
+	}
+	assertState(t, b, StateClosed)
+	if b.Snapshot().OpenedAt != nil {
+		t.Fatal("a closed breaker reports OpenedAt")
+	}
+}
+
+func TestBreakerLetsOneProbeThrough(t *testing.T) {
+	b := newTestBreaker(t, Config{Threshold: 1, Cooldown: time.Millisecond}, nil)
+	call(b, errDown)
+	time.Sleep(5 * time.Millisecond)
+
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.Do(func() error {
+			close(probing)
+			<-release
+			return nil
+		})
+	}()
+	<-probing
+
+	assertState(t, b, StateHalfOpen)
+	if reached, err := call(b, nil); reached || !errors.Is(err, ErrOpen) {
+		t.Fatalf("call during the probe reached = %v, err = %v, want %v", reached, err, ErrOpen)
+	}
+	close(release)
+	wg.Wait()
+	assertState(t, b, StateClosed)
+}
+
+func TestBreakerIgnoresErrorsThatAreNotFailures(t *testing.T) {
+	errMissing := errors.New("missing key")
+	b := newTestBreaker(t, Config{Threshold: 1, Cooldown: time.Hour}, func(err error) bool {
+		return err != nil && !errors.Is(err, errMissing)
+	})
+
+	for i := 0; i < 5; i++ {
+		if _, err := call(b, errMissing); !errors.Is(err, errMissing) {
+			t.Fatalf("Do = %v, want %v", err, errMissing)
+		}
+	}
+	assertState(t, b, StateClosed)
+}
+
+func TestNilBreakerAlwaysCalls(t *testing.T) {
+	var b *Breaker
+	if reached, err := call(b, errDown); !reached || !errors.Is(err, errDown) {
+		t.Fatalf("nil breaker reached = %v, err = %v", reached, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("test", Config{Threshold: 0}, nil, nil); err == nil {
+		t.Fatal("New accepted a zero threshold")
+	}
+
+	reg := prometheus.NewRegistry()
+	if _, err := New("redis", Config{Threshold: 1}, nil, reg); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	// Each breaker needs its own name, the metrics would collide otherwise
+	if _, err := New("redis", Config{Threshold: 1}, nil, reg); err == nil {
+		t.Fatal("two breakers registered the same metrics")
+	}
+	if _, err := New("smtp", Config{Threshold: 1}, nil, reg); err != nil {
+		t.Fatalf("New with another name: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+	"go.uber.org/zap"
+)
+
+type Mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+// New returns an SMTP mailer, or a mailer that only logs when SMTP is not configured
+func New(cfg config.MailConfig, logger *zap.Logger) Mailer {
+	if cfg.Host == "" {
+		return &logMailer{logger: logger}
+	}
+	return &smtpMailer{cfg: cfg}
+}
+
+type smtpMailer struct {
+	cfg config.MailConfig
+}
+
+// Send implements Mailer.
+func (m *smtpMailer) Send(ctx context.Context, to string, subject string, body string) error {
+	addr := fmt.Sprintf("%s:%d", m.cfg.Host, m.cfg.Port)
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password.Value(), m.cfg.Host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	msg.WriteString(body)
+
+	if err := smtp.SendMail(addr, auth, m.cfg.From, []string{to}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+type logMailer struct {
+	logger *zap.Logger
+}
+
+// Send implements Mailer.
+func (m *logMailer) Send(ctx context.Context, to string, subject string, body string) error {
+	m.logger.Info("mail not sent, SMTP is not configured",
+		zap.String("to", to),
+		zap.String("subject", subject),
+		zap.String("body", body),
+	)
+	return nil
+}
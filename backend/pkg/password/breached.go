@@ -0,0 +1,145 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// NewFileBreachChecker reads Have I Been Pwned SHA-1 data stored locally, in one of two layouts:
+//   - a directory of range files named by the 5 character hash prefix (ABCDE or ABCDE.txt),
+//     each holding "SUFFIX:COUNT" lines, as served by the range API
+//   - a single file of "HASH:COUNT" lines ordered by hash, searched without loading it in memory
+func NewFileBreachChecker(path string) (BreachChecker, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	if info.IsDir() {
+		return &rangeDirChecker{dir: path}, nil
+	}
+	return &sortedFileChecker{path: path}, nil
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// hashOfLine returns the hash part of a "HASH:COUNT" line
+func hashOfLine(line string) string {
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	return strings.ToUpper(strings.TrimSpace(line))
+}
+
+type rangeDirChecker struct {
+	dir string
+}
+
+// IsBreached implements BreachChecker.
+func (r *rangeDirChecker) IsBreached(password string) (bool, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(r.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(r.dir, prefix))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if hashOfLine(scanner.Text()) == suffix {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+type sortedFileChecker struct {
+	path string
+}
+
+// IsBreached implements BreachChecker.
+func (s *sortedFileChecker) IsBreached(password string) (bool, error) {
+	hash := sha1Hex(password)
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	// Find the smallest offset whose next line is >= hash
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, err := lineAtOrAfter(f, mid)
+		if err != nil {
+			return false, err
+		}
+		if line != "" && hashOfLine(line) < hash {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	line, err := lineAtOrAfter(f, lo)
+	if err != nil {
+		return false, err
+	}
+	return line != "" && hashOfLine(line) == hash, nil
+}
+
+// lineAtOrAfter returns the first complete line starting at or after offset,
+// or an empty string at the end of the file
+func lineAtOrAfter(f *os.File, offset int64) (string, error) {
+	start := offset
+	if offset > 0 {
+		// Start one byte early so a line beginning exactly at offset is kept
+		start = offset - 1
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	reader := bufio.NewReaderSize(f, 256)
+	if offset > 0 {
+		if _, err := reader.ReadString('\n'); err != nil {
+			if err == io.EOF {
+				return "", nil
+			}
+			return "", err
+		}
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
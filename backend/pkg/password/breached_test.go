@@ -0,0 +1,112 @@
+package password
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name string, lines []string) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertBreached(t *testing.T, checker BreachChecker, password string, want bool) {
+	t.Helper()
+
+	got, err := checker.IsBreached(password)
+	if err != nil {
+		t.Fatalf("IsBreached(%q): %v", password, err)
+	}
+	if got != want {
+		t.Fatalf("IsBreached(%q) = %v, want %v", password, got, want)
+	}
+}
+
+func TestSortedFileBreachChecker(t *testing.T) {
+	var breached, lines []string
+	for i := 0; i < 500; i++ {
+		password := fmt.Sprintf("leaked-%d", i)
+		breached = append(breached, password)
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(password), i+1))
+	}
+	sort.Strings(lines)
+	// Lists downloaded on Windows end lines with \r\n, hashes may be lower case
+	lines[10] = strings.ToLower(lines[10]) + "\r"
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	writeTestFile(t, path, lines)
+	checker, err := NewFileBreachChecker(path)
+	if err != nil {
+		t.Fatalf("NewFileBreachChecker: %v", err)
+	}
+
+	// Every line is found, including the first and the last
+	for _, password := range breached {
+		assertBreached(t, checker, password, true)
+	}
+	for i := 0; i < 50; i++ {
+		assertBreached(t, checker, fmt.Sprintf("safe-%d", i), false)
+	}
+}
+
+func TestSortedFileBreachCheckerSmallFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checker, err := NewFileBreachChecker(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBreached(t, checker, "anything", false)
+
+	single := filepath.Join(dir, "single.txt")
+	writeTestFile(t, single, []string{sha1Hex("only") + ":3"})
+	checker, err = NewFileBreachChecker(single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBreached(t, checker, "only", true)
+	assertBreached(t, checker, "other", false)
+}
+
+func TestRangeDirBreachChecker(t *testing.T) {
+	dir := t.TempDir()
+
+	// One range file with the .txt extension, one without, as served by the range API
+	for _, password := range []string{"hunter2", "letmein"} {
+		hash := sha1Hex(password)
+		name := hash[:5]
+		if password == "hunter2" {
+			name += ".txt"
+		}
+		writeTestFile(t, filepath.Join(dir, name), []string{
+			"0000000000000000000000000000000000A:1",
+			hash[5:] + ":42",
+		})
+	}
+
+	checker, err := NewFileBreachChecker(dir)
+	if err != nil {
+		t.Fatalf("NewFileBreachChecker: %v", err)
+	}
+	assertBreached(t, checker, "hunter2", true)
+	assertBreached(t, checker, "letmein", true)
+	// No range file for the prefix
+	assertBreached(t, checker, "tangerine lighthouse", false)
+}
+
+func TestNewFileBreachCheckerMissingList(t *testing.T) {
+	if _, err := NewFileBreachChecker(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("NewFileBreachChecker accepted a missing list")
+	}
+}
@@ -0,0 +1,145 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+)
+
+func testArgon2Config() config.PasswordConfig {
+	return config.PasswordConfig{
+		HashAlgorithm:     AlgorithmArgon2id,
+		Argon2Memory:      64,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}
+}
+
+func newTestHasher(t *testing.T, cfg config.PasswordConfig) Hasher {
+	t.Helper()
+
+	h, err := NewHasher(cfg)
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	return h
+}
+
+func hash(t *testing.T, h Hasher, password string) string {
+	t.Helper()
+
+	encoded, err := h.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	return encoded
+}
+
+func assertVerify(t *testing.T, h Hasher, password string, encoded string, wantMatch bool, wantRehash bool) {
+	t.Helper()
+
+	match, needsRehash, err := h.Verify(password, encoded)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if match != wantMatch || needsRehash != wantRehash {
+		t.Fatalf("Verify(%q) = match %v, rehash %v, want %v, %v", password, match, needsRehash, wantMatch, wantRehash)
+	}
+}
+
+func TestArgon2idHash(t *testing.T) {
+	h := newTestHasher(t, testArgon2Config())
+
+	encoded := hash(t, h, "tangerine lighthouse")
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash = %q, want the PHC format with the configured parameters", encoded)
+	}
+	// Salted, the same password never hashes the same twice
+	if hash(t, h, "tangerine lighthouse") == encoded {
+		t.Fatal("two hashes of the same password are equal")
+	}
+
+	assertVerify(t, h, "tangerine lighthouse", encoded, true, false)
+	assertVerify(t, h, "tangerine lighthousE", encoded, false, false)
+}
+
+func TestBcryptHash(t *testing.T) {
+	h := newTestHasher(t, config.PasswordConfig{HashAlgorithm: AlgorithmBcrypt, BcryptCost: 4})
+
+	encoded := hash(t, h, "tangerine lighthouse")
+	if !strings.HasPrefix(encoded, "$2a$04$") {
+		t.Fatalf("Hash = %q, want bcrypt at cost 4", encoded)
+	}
+	assertVerify(t, h, "tangerine lighthouse", encoded, true, false)
+	assertVerify(t, h, "wrong", encoded, false, false)
+}
+
+func TestRehashWhenParametersChange(t *testing.T) {
+	current := newTestHasher(t, testArgon2Config())
+
+	stronger := testArgon2Config()
+	stronger.Argon2Memory = 128
+	moreIterations := testArgon2Config()
+	moreIterations.Argon2Iterations = 2
+	moreParallel := testArgon2Config()
+	moreParallel.Argon2Parallelism = 2
+
+	for name, cfg := range map[string]config.PasswordConfig{
+		"memory":      stronger,
+		"iterations":  moreIterations,
+		"parallelism": moreParallel,
+		"bcrypt":      {HashAlgorithm: AlgorithmBcrypt, BcryptCost: 4},
+	} {
+		old := hash(t, newTestHasher(t, cfg), "tangerine lighthouse")
+		t.Run(name, func(t *testing.T) {
+			assertVerify(t, current, "tangerine lighthouse", old, true, true)
+			// Only a match is rehashed, the password is needed for it
+			assertVerify(t, current, "wrong", old, false, false)
+		})
+	}
+
+	// Moving from argon2id to bcrypt, or to another bcrypt cost, rehashes too
+	bcrypt4 := newTestHasher(t, config.PasswordConfig{HashAlgorithm: AlgorithmBcrypt, BcryptCost: 4})
+	bcrypt5 := newTestHasher(t, config.PasswordConfig{HashAlgorithm: AlgorithmBcrypt, BcryptCost: 5})
+	assertVerify(t, bcrypt4, "tangerine lighthouse", hash(t, current, "tangerine lighthouse"), true, true)
+	assertVerify(t, bcrypt5, "tangerine lighthouse", hash(t, bcrypt4, "tangerine lighthouse"), true, true)
+}
+
+func TestVerifyRejectsMalformedHashes(t *testing.T) {
+	h := newTestHasher(t, testArgon2Config())
+
+	for _, encoded := range []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=19$m=64,t=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+	} {
+		if match, _, err := h.Verify("tangerine lighthouse", encoded); err == nil || match {
+			t.Fatalf("Verify(%q) = %v, %v, want an error", encoded, match, err)
+		}
+	}
+
+	if _, _, err := h.Verify("x", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5"); err == nil {
+		t.Fatal("Verify accepted an unsupported argon2 version")
+	}
+	if _, _, err := h.Verify("x", "nope"); !errors.Is(err, ErrUnknownHashFormat) {
+		t.Fatalf("Verify = %v, want %v", err, ErrUnknownHashFormat)
+	}
+}
+
+func TestNewHasherRejectsInvalidConfig(t *testing.T) {
+	for name, cfg := range map[string]config.PasswordConfig{
+		"unknown algorithm":     {HashAlgorithm: "md5"},
+		"argon2id without cost": {HashAlgorithm: AlgorithmArgon2id},
+		"bcrypt cost too low":   {HashAlgorithm: AlgorithmBcrypt, BcryptCost: 3},
+		"bcrypt cost too high":  {HashAlgorithm: AlgorithmBcrypt, BcryptCost: 32},
+	} {
+		if _, err := NewHasher(cfg); err == nil {
+			t.Fatalf("NewHasher accepted %s", name)
+		}
+	}
+}
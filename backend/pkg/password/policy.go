@@ -0,0 +1,156 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+)
+
+// Rule names reported in a Violation
+const (
+	RuleRequired        = "required"
+	RuleMinLength       = "min_length"
+	RuleMaxLength       = "max_length"
+	RuleBannedSubstring = "banned_substring"
+	RuleBreached        = "breached"
+)
+
+// bcrypt silently ignores everything past 72 bytes
+const BcryptMaxBytes = 72
+
+// Substrings shorter than this are too common to ban
+const minBannedSubstringLength = 3
+
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a password failed
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password does not meet policy: " + strings.Join(messages, "; ")
+}
+
+type Policy struct {
+	// Minimum length in characters
+	MinLength int
+	// Maximum length in bytes, never more than BcryptMaxBytes
+	MaxLength   int
+	BannedWords []string
+	// Optional, nil skips the breached password check
+	Breached BreachChecker
+}
+
+// Validate checks a password against every rule. personal holds values tied to the
+// account (username, email) that must not appear in the password.
+// It returns a *PolicyError when rules fail, any other error means the check itself failed.
+func (p *Policy) Validate(password string, personal ...string) error {
+	var violations []Violation
+
+	if password == "" {
+		return &PolicyError{Violations: []Violation{{Rule: RuleRequired, Message: "password is required"}}}
+	}
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		})
+	}
+
+	if len(password) > p.maxLength() {
+		violations = append(violations, Violation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("password must be at most %d bytes", p.maxLength()),
+		})
+	}
+
+	lower := strings.ToLower(password)
+	for _, banned := range p.bannedSubstrings(personal) {
+		if strings.Contains(lower, banned) {
+			violations = append(violations, Violation{
+				Rule:    RuleBannedSubstring,
+				Message: "password must not contain your username, email or common words",
+			})
+			break
+		}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return fmt.Errorf("failed to check breached passwords: %w", err)
+		}
+		if breached {
+			violations = append(violations, Violation{
+				Rule:    RuleBreached,
+				Message: "password has appeared in a data breach, choose another one",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func (p *Policy) maxLength() int {
+	if p.MaxLength <= 0 || p.MaxLength > BcryptMaxBytes {
+		return BcryptMaxBytes
+	}
+	return p.MaxLength
+}
+
+func (p *Policy) bannedSubstrings(personal []string) []string {
+	var banned []string
+
+	add := func(s string) {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if len(s) >= minBannedSubstringLength {
+			banned = append(banned, s)
+		}
+	}
+
+	for _, s := range personal {
+		add(s)
+		// Also ban the local part of an email
+		if at := strings.Index(s, "@"); at > 0 {
+			add(s[:at])
+		}
+	}
+	for _, s := range p.BannedWords {
+		add(s)
+	}
+
+	return banned
+}
+
+// NewPolicy builds the policy from configuration, loading the breached password list when set
+func NewPolicy(cfg config.PasswordConfig) (*Policy, error) {
+	policy := &Policy{
+		MinLength:   cfg.MinLength,
+		MaxLength:   cfg.MaxLength,
+		BannedWords: cfg.BannedWords,
+	}
+
+	if cfg.BreachedListPath != "" {
+		checker, err := NewFileBreachChecker(cfg.BreachedListPath)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = checker
+	}
+
+	return policy, nil
+}
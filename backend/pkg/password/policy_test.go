@@ -0,0 +1,117 @@
+package password
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/imnzr/user-authentication-go/internal/config"
+)
+
+// breachedSet is a BreachChecker over a fixed list
+type breachedSet map[string]bool
+
+func (b breachedSet) IsBreached(password string) (bool, error) {
+	return b[password], nil
+}
+
+type failingChecker struct{}
+
+func (failingChecker) IsBreached(password string) (bool, error) {
+	return false, errors.New("list unreadable")
+}
+
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Validate = %v, want a *PolicyError", err)
+	}
+	rules := make([]string, len(policyErr.Violations))
+	for i, v := range policyErr.Violations {
+		rules[i] = v.Rule
+	}
+	return rules
+}
+
+func TestPolicyValidate(t *testing.T) {
+	policy := &Policy{
+		MinLength:   10,
+		MaxLength:   32,
+		BannedWords: []string{"password", "qwerty", "ab"},
+		Breached:    breachedSet{"correct horse battery staple": true},
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		personal []string
+		want     []string
+	}{
+		{"valid", "tangerine lighthouse 42", nil, nil},
+		{"empty", "", nil, []string{RuleRequired}},
+		{"too short", "short1!", nil, []string{RuleMinLength}},
+		// Characters count, not bytes
+		{"multibyte at the minimum", "ñññññññññ1", nil, nil},
+		{"too long", strings.Repeat("x", 33), nil, []string{RuleMaxLength}},
+		{"banned word in any case", "MyPassWord is long", nil, []string{RuleBannedSubstring}},
+		{"banned words shorter than 3 are ignored", "ab tangerine lighthouse", nil, nil},
+		{"username", "hello alice1990 there", []string{"alice1990", "alice@example.com"}, []string{RuleBannedSubstring}},
+		{"email local part", "i am ALICE.S for real", []string{"bob", "alice.s@example.com"}, []string{RuleBannedSubstring}},
+		{"breached", "correct horse battery staple", nil, []string{RuleBreached}},
+		{"every failure at once", "qwerty", nil, []string{RuleMinLength, RuleBannedSubstring}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violatedRules(t, policy.Validate(tt.password, tt.personal...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Validate(%q) violations = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyMaxLengthNeverPassesBcryptLimit(t *testing.T) {
+	for _, maxLength := range []int{0, -1, 100} {
+		policy := &Policy{MinLength: 1, MaxLength: maxLength}
+		if err := policy.Validate(strings.Repeat("x", BcryptMaxBytes)); err != nil {
+			t.Fatalf("MaxLength %d: %d bytes = %v, want valid", maxLength, BcryptMaxBytes, err)
+		}
+		got := violatedRules(t, policy.Validate(strings.Repeat("x", BcryptMaxBytes+1)))
+		if !reflect.DeepEqual(got, []string{RuleMaxLength}) {
+			t.Fatalf("MaxLength %d: %d bytes violations = %v, want [%s]", maxLength, BcryptMaxBytes+1, got, RuleMaxLength)
+		}
+	}
+}
+
+func TestPolicyBreachCheckFailure(t *testing.T) {
+	policy := &Policy{MinLength: 1, Breached: failingChecker{}}
+
+	err := policy.Validate("tangerine lighthouse")
+	var policyErr *PolicyError
+	if err == nil || errors.As(err, &policyErr) {
+		t.Fatalf("Validate = %v, want the checker's error, not a violation", err)
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	if _, err := NewPolicy(config.PasswordConfig{BreachedListPath: "/does/not/exist"}); err == nil {
+		t.Fatal("NewPolicy accepted a missing breached password list")
+	}
+
+	policy, err := NewPolicy(config.PasswordConfig{MinLength: 8, MaxLength: 64, BannedWords: []string{"acme"}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	if policy.Breached != nil {
+		t.Fatal("a breach checker without a list")
+	}
+	if got := violatedRules(t, policy.Validate("acme rocks hard")); !reflect.DeepEqual(got, []string{RuleBannedSubstring}) {
+		t.Fatalf("violations = %v, want the configured banned word", got)
+	}
+}
@@ -0,0 +1,197 @@
+package password
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrHasherBusy is returned, wrapped in a RetryAfterError, when every worker is busy
+// and the queue is full. Callers should answer 503 instead of piling up requests.
+var ErrHasherBusy = errors.New("password hasher is busy, try again later")
+
+// Pool operation labels
+const (
+	opHash   = "hash"
+	opVerify = "verify"
+)
+
+type PoolConfig struct {
+	// Hashes computed at the same time
+	Workers int
+	// Requests allowed to wait for a worker, more are rejected with ErrHasherBusy
+	QueueSize int
+	// Suggested wait returned with ErrHasherBusy
+	RetryAfter time.Duration
+}
+
+type job struct {
+	op       string
+	run      func()
+	enqueued time.Time
+	done     chan struct{}
+}
+
+type poolMetrics struct {
+	wait     *prometheus.HistogramVec
+	duration *prometheus.HistogramVec
+	rejected *prometheus.CounterVec
+}
+
+// PooledHasher runs another Hasher on a fixed number of workers so a burst of
+// sign-ins can't spend every CPU and all the memory argon2id asks for
+type PooledHasher struct {
+	hasher     Hasher
+	jobs       chan job
+	retryAfter time.Duration
+	metrics    poolMetrics
+
+	// Held for reading while a job is queued, Close takes it for writing before closing jobs
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewPooledHasher starts the workers and registers the pool metrics with reg
+func NewPooledHasher(hasher Hasher, cfg PoolConfig, reg prometheus.Registerer) (*PooledHasher, error) {
+	if cfg.Workers <= 0 {
+		return nil, errors.New("password hash pool needs at least one worker")
+	}
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = 0
+	}
+
+	p := &PooledHasher{
+		hasher:     hasher,
+		jobs:       make(chan job, cfg.QueueSize),
+		retryAfter: cfg.RetryAfter,
+		metrics: poolMetrics{
+			wait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "password_hash_pool_wait_seconds",
+				Help:    "Time a password hash or verify waited for a free worker.",
+				Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+			}, []string{"op"}),
+			duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "password_hash_pool_duration_seconds",
+				Help:    "Time spent computing a password hash or verify.",
+				Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+			}, []string{"op"}),
+			rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "password_hash_pool_rejected_total",
+				Help: "Password hash or verify requests rejected because the queue was full.",
+			}, []string{"op"}),
+		},
+	}
+
+	queueDepth := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "password_hash_pool_queue_depth",
+		Help: "Password hash or verify requests waiting for a worker.",
+	}, func() float64 {
+		return float64(len(p.jobs))
+	})
+
+	if reg != nil {
+		for _, c := range []prometheus.Collector{p.metrics.wait, p.metrics.duration, p.metrics.rejected, queueDepth} {
+			if err := reg.Register(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	return p, nil
+}
+
+func (p *PooledHasher) worker() {
+	defer p.wg.Done()
+
+	for j := range p.jobs {
+		start := time.Now()
+		p.metrics.wait.WithLabelValues(j.op).Observe(start.Sub(j.enqueued).Seconds())
+
+		j.run()
+
+		p.metrics.duration.WithLabelValues(j.op).Observe(time.Since(start).Seconds())
+		close(j.done)
+	}
+}
+
+// submit runs fn on a worker and waits for it, failing fast when the queue is full
+func (p *PooledHasher) submit(op string, fn func()) error {
+	j := job{
+		op:       op,
+		run:      fn,
+		enqueued: time.Now(),
+		done:     make(chan struct{}),
+	}
+
+	if !p.enqueue(j) {
+		p.metrics.rejected.WithLabelValues(op).Inc()
+		return &errorpkg.RetryAfterError{Err: ErrHasherBusy, RetryAfter: p.retryAfter}
+	}
+
+	<-j.done
+	return nil
+}
+
+// enqueue never blocks, it reports false when the queue is full or the pool is closed.
+// A request still running at shutdown gets the same answer as a busy pool.
+func (p *PooledHasher) enqueue(j job) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.jobs <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+// Hash implements Hasher.
+func (p *PooledHasher) Hash(password string) (string, error) {
+	var (
+		encoded string
+		err     error
+	)
+	if submitErr := p.submit(opHash, func() {
+		encoded, err = p.hasher.Hash(password)
+	}); submitErr != nil {
+		return "", submitErr
+	}
+	return encoded, err
+}
+
+// Verify implements Hasher.
+func (p *PooledHasher) Verify(password string, encoded string) (bool, bool, error) {
+	var (
+		match, needsRehash bool
+		err                error
+	)
+	if submitErr := p.submit(opVerify, func() {
+		match, needsRehash, err = p.hasher.Verify(password, encoded)
+	}); submitErr != nil {
+		return false, false, submitErr
+	}
+	return match, needsRehash, err
+}
+
+// Close lets queued work finish and stops the workers, later calls get ErrHasherBusy
+func (p *PooledHasher) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,222 @@
+package password
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	errorpkg "github.com/imnzr/user-authentication-go/internal/pkg/error_pkg"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gateHasher blocks every call until the test opens the gate, and tracks how many run at once
+type gateHasher struct {
+	gate    chan struct{}
+	started chan struct{}
+
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func newGateHasher() *gateHasher {
+	return &gateHasher{gate: make(chan struct{}), started: make(chan struct{}, 100)}
+}
+
+func (h *gateHasher) run() {
+	n := h.running.Add(1)
+	for {
+		peak := h.peak.Load()
+		if n <= peak || h.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	h.started <- struct{}{}
+	<-h.gate
+	h.running.Add(-1)
+}
+
+func (h *gateHasher) Hash(password string) (string, error) {
+	h.run()
+	return "hashed:" + password, nil
+}
+
+func (h *gateHasher) Verify(password string, encoded string) (bool, bool, error) {
+	h.run()
+	return encoded == "hashed:"+password, false, nil
+}
+
+func (h *gateHasher) waitStarted(t *testing.T, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-h.started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d of %d calls started", i, n)
+		}
+	}
+}
+
+func newTestPool(t *testing.T, hasher Hasher, cfg PoolConfig, reg prometheus.Registerer) *PooledHasher {
+	t.Helper()
+
+	pool, err := NewPooledHasher(hasher, cfg, reg)
+	if err != nil {
+		t.Fatalf("NewPooledHasher: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func waitForQueue(t *testing.T, pool *PooledHasher, depth int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pool.jobs) != depth {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth %d, want %d", len(pool.jobs), depth)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func assertBusy(t *testing.T, err error, retryAfter time.Duration) {
+	t.Helper()
+
+	var retryErr *errorpkg.RetryAfterError
+	if !errors.Is(err, ErrHasherBusy) || !errors.As(err, &retryErr) {
+		t.Fatalf("err = %v, want %v with a Retry-After", err, ErrHasherBusy)
+	}
+	if retryErr.RetryAfter != retryAfter {
+		t.Fatalf("RetryAfter = %v, want %v", retryErr.RetryAfter, retryAfter)
+	}
+}
+
+func counterValue(t *testing.T, reg *prometheus.Registry, name string, op string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "op" && label.GetValue() == op {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestPoolRejectsWhenTheQueueIsFull(t *testing.T) {
+	hasher := newGateHasher()
+	reg := prometheus.NewRegistry()
+	pool := newTestPool(t, hasher, PoolConfig{Workers: 1, QueueSize: 1, RetryAfter: 2 * time.Second}, reg)
+
+	var wg sync.WaitGroup
+	results := make([]string, 2)
+	for i, password := range []string{"running", "queued"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			encoded, err := pool.Hash(password)
+			if err != nil {
+				t.Errorf("Hash(%q): %v", password, err)
+			}
+			results[i] = encoded
+		}()
+		if i == 0 {
+			hasher.waitStarted(t, 1)
+		}
+	}
+	waitForQueue(t, pool, 1)
+
+	// The worker is busy and the queue is full, the next call is turned away at once
+	start := time.Now()
+	_, err := pool.Hash("rejected")
+	assertBusy(t, err, 2*time.Second)
+	_, _, err = pool.Verify("rejected", "hashed:rejected")
+	assertBusy(t, err, 2*time.Second)
+	if waited := time.Since(start); waited > time.Second {
+		t.Fatalf("rejecting took %v, it must not wait for a worker", waited)
+	}
+	if n := counterValue(t, reg, "password_hash_pool_rejected_total", opHash); n != 1 {
+		t.Fatalf("rejected hashes = %v, want 1", n)
+	}
+	if n := counterValue(t, reg, "password_hash_pool_rejected_total", opVerify); n != 1 {
+		t.Fatalf("rejected verifies = %v, want 1", n)
+	}
+
+	// Queued work still completes
+	close(hasher.gate)
+	wg.Wait()
+	if results[0] != "hashed:running" || results[1] != "hashed:queued" {
+		t.Fatalf("results = %v", results)
+	}
+
+	// With room again calls go through
+	match, _, err := pool.Verify("again", "hashed:again")
+	if err != nil || !match {
+		t.Fatalf("Verify = %v, %v, want a match", match, err)
+	}
+}
+
+func TestPoolBoundsConcurrency(t *testing.T) {
+	hasher := newGateHasher()
+	pool := newTestPool(t, hasher, PoolConfig{Workers: 2, QueueSize: 10}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Hash("x"); err != nil {
+				t.Errorf("Hash: %v", err)
+			}
+		}()
+	}
+	hasher.waitStarted(t, 2)
+	waitForQueue(t, pool, 6)
+	close(hasher.gate)
+	wg.Wait()
+
+	if peak := hasher.peak.Load(); peak != 2 {
+		t.Fatalf("%d hashes ran at once, want the 2 workers", peak)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	hasher := newGateHasher()
+	close(hasher.gate)
+	pool := newTestPool(t, hasher, PoolConfig{Workers: 1, QueueSize: 1, RetryAfter: time.Second}, nil)
+
+	if _, err := pool.Hash("before"); err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	pool.Close()
+	pool.Close()
+
+	_, err := pool.Hash("after")
+	assertBusy(t, err, time.Second)
+}
+
+func TestNewPooledHasher(t *testing.T) {
+	if _, err := NewPooledHasher(newGateHasher(), PoolConfig{Workers: 0}, nil); err == nil {
+		t.Fatal("NewPooledHasher accepted a pool without workers")
+	}
+
+	// The metrics are registered once, a second pool on the same registry is a configuration error
+	reg := prometheus.NewRegistry()
+	newTestPool(t, newGateHasher(), PoolConfig{Workers: 1}, reg)
+	if _, err := NewPooledHasher(newGateHasher(), PoolConfig{Workers: 1}, reg); err == nil {
+		t.Fatal("a second pool registered the same metrics")
+	}
+}
@@ -0,0 +1,240 @@
+package pii
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize is the length of master, blind index and data keys, AES-256
+const KeySize = 32
+
+var (
+	ErrUnknownMasterKey = errors.New("pii data key was wrapped by an unknown master key")
+	ErrDecrypt          = errors.New("failed to decrypt pii value")
+)
+
+// Keyring holds the master keys that wrap per-row data keys and the key used for blind indexes.
+//
+// The master key file has one key per line as "<key-id>:<base64 key>", lines starting with #
+// are ignored. The last key is the active one, older keys stay in the file so rows wrapped
+// by them can still be read until the re-encryption job rewraps them.
+//
+// The blind index key never rotates, changing it would orphan every stored index.
+type Keyring struct {
+	masterKeys map[string][]byte
+	activeId   string
+	indexKey   []byte
+}
+
+// LoadKeyring reads the master key file and the blind index key file
+func LoadKeyring(masterKeyFile string, blindIndexKeyFile string) (*Keyring, error) {
+	if masterKeyFile == "" || blindIndexKeyFile == "" {
+		return nil, errors.New("pii master key file and blind index key file are required")
+	}
+
+	data, err := os.ReadFile(masterKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pii master key file: %w", err)
+	}
+	k := &Keyring{masterKeys: make(map[string][]byte)}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("pii master key file line %d: expected <key-id>:<base64 key>", line)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("pii master key file line %d: %w", line, err)
+		}
+		if _, exists := k.masterKeys[id]; exists {
+			return nil, fmt.Errorf("pii master key file line %d: duplicate key id %q", line, id)
+		}
+		k.masterKeys[id] = key
+		k.activeId = id
+	}
+	if k.activeId == "" {
+		return nil, errors.New("pii master key file has no keys")
+	}
+
+	data, err = os.ReadFile(blindIndexKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pii blind index key file: %w", err)
+	}
+	if k.indexKey, err = decodeKey(string(data)); err != nil {
+		return nil, fmt.Errorf("pii blind index key: %w", err)
+	}
+
+	return k, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("key is not valid base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// GenerateKey returns a random base64 key for the key files
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ActiveKeyId is the master key new data keys are wrapped with
+func (k *Keyring) ActiveKeyId() string {
+	return k.activeId
+}
+
+// BlindIndex returns a keyed hash of the email that can be looked up with equality.
+// Emails are compared case-insensitively, like the plaintext column was.
+func (k *Keyring) BlindIndex(email string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DataKey encrypts the PII fields of one row
+type DataKey struct {
+	aead cipher.AEAD
+	// Data key encrypted with the master key KeyId, stored next to the row
+	Wrapped string
+	KeyId   string
+}
+
+// NewDataKey creates a random data key wrapped with the active master key
+func (k *Keyring) NewDataKey() (*DataKey, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate pii data key: %w", err)
+	}
+	return k.newDataKey(key)
+}
+
+func (k *Keyring) newDataKey(key []byte) (*DataKey, error) {
+	wrapped, err := seal(k.masterKeys[k.activeId], key, wrapAAD(k.activeId))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{aead: aead, Wrapped: wrapped, KeyId: k.activeId}, nil
+}
+
+// OpenDataKey unwraps a stored data key
+func (k *Keyring) OpenDataKey(keyId string, wrapped string) (*DataKey, error) {
+	key, err := k.unwrap(keyId, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{aead: aead, Wrapped: wrapped, KeyId: keyId}, nil
+}
+
+// Rewrap wraps a stored data key with the active master key, the fields it encrypts don't change
+func (k *Keyring) Rewrap(keyId string, wrapped string) (*DataKey, error) {
+	key, err := k.unwrap(keyId, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return k.newDataKey(key)
+}
+
+func (k *Keyring) unwrap(keyId string, wrapped string) ([]byte, error) {
+	masterKey, ok := k.masterKeys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMasterKey, keyId)
+	}
+	return open(masterKey, wrapped, wrapAAD(keyId))
+}
+
+// Encrypt seals a field value. The field name is bound to the ciphertext so values
+// can't be swapped between columns.
+func (d *DataKey) Encrypt(field string, plaintext string) (string, error) {
+	return sealAEAD(d.aead, []byte(plaintext), []byte(field))
+}
+
+func (d *DataKey) Decrypt(field string, ciphertext string) (string, error) {
+	plaintext, err := openAEAD(d.aead, ciphertext, []byte(field))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func wrapAAD(keyId string) []byte {
+	return []byte("pii-data-key:" + keyId)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(key []byte, plaintext []byte, aad []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	return sealAEAD(aead, plaintext, aad)
+}
+
+func open(key []byte, encoded string, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return openAEAD(aead, encoded, aad)
+}
+
+// sealAEAD returns base64(nonce || ciphertext)
+func sealAEAD(aead cipher.AEAD, plaintext []byte, aad []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, aad)), nil
+}
+
+func openAEAD(aead cipher.AEAD, encoded string, aad []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
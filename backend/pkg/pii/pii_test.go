@@ -0,0 +1,197 @@
+package pii
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeKeyFiles writes a master key file with the given lines and a random blind index key
+func writeKeyFiles(t *testing.T, masterKeyLines ...string) (string, string) {
+	t.Helper()
+
+	indexKey, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	dir := t.TempDir()
+	masterKeyFile := filepath.Join(dir, "master.keys")
+	indexKeyFile := filepath.Join(dir, "index.key")
+	if err := os.WriteFile(masterKeyFile, []byte(strings.Join(masterKeyLines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(indexKeyFile, []byte(indexKey+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return masterKeyFile, indexKeyFile
+}
+
+func masterKeyLine(t *testing.T, id string) string {
+	t.Helper()
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return id + ":" + key
+}
+
+// newKeyring returns a keyring with a single random master key k1
+func newKeyring(t *testing.T) *Keyring {
+	t.Helper()
+
+	masterKeyFile, indexKeyFile := writeKeyFiles(t, masterKeyLine(t, "k1"))
+	return loadKeyring(t, masterKeyFile, indexKeyFile)
+}
+
+func loadKeyring(t *testing.T, masterKeyFile string, indexKeyFile string) *Keyring {
+	t.Helper()
+
+	k, err := LoadKeyring(masterKeyFile, indexKeyFile)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	return k
+}
+
+func TestDataKeyRoundTrip(t *testing.T) {
+	k := newKeyring(t)
+
+	key, err := k.NewDataKey()
+	if err != nil {
+		t.Fatalf("NewDataKey: %v", err)
+	}
+	if key.KeyId != "k1" {
+		t.Fatalf("KeyId = %q, want k1", key.KeyId)
+	}
+
+	ciphertext, err := key.Encrypt("email", "alice@example.com")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if strings.Contains(ciphertext, "alice") {
+		t.Fatalf("ciphertext %q contains the plaintext", ciphertext)
+	}
+	again, _ := key.Encrypt("email", "alice@example.com")
+	if again == ciphertext {
+		t.Fatal("encrypting twice gave the same ciphertext")
+	}
+
+	// A later read only has the stored wrapped key
+	opened, err := k.OpenDataKey(key.KeyId, key.Wrapped)
+	if err != nil {
+		t.Fatalf("OpenDataKey: %v", err)
+	}
+	plaintext, err := opened.Decrypt("email", ciphertext)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if plaintext != "alice@example.com" {
+		t.Fatalf("Decrypt = %q, want alice@example.com", plaintext)
+	}
+}
+
+func TestDecryptRejectsTamperedValues(t *testing.T) {
+	k := newKeyring(t)
+	key, _ := k.NewDataKey()
+	ciphertext, _ := key.Encrypt("email", "alice@example.com")
+
+	// The field name is authenticated, a value can't be moved to another column
+	if _, err := key.Decrypt("username", ciphertext); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Decrypt as another field = %v, want %v", err, ErrDecrypt)
+	}
+
+	other, _ := k.NewDataKey()
+	if _, err := other.Decrypt("email", ciphertext); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Decrypt with another row's key = %v, want %v", err, ErrDecrypt)
+	}
+
+	if _, err := key.Decrypt("email", "not base64!"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Decrypt of garbage = %v, want %v", err, ErrDecrypt)
+	}
+}
+
+func TestRotatedMasterKey(t *testing.T) {
+	oldLine := masterKeyLine(t, "k1")
+	masterKeyFile, indexKeyFile := writeKeyFiles(t, oldLine)
+	before := loadKeyring(t, masterKeyFile, indexKeyFile)
+
+	key, _ := before.NewDataKey()
+	ciphertext, _ := key.Encrypt("email", "alice@example.com")
+
+	// Rotation appends the new key, the old one stays readable
+	newLine := masterKeyLine(t, "k2")
+	if err := os.WriteFile(masterKeyFile, []byte("# rotated\n"+oldLine+"\n"+newLine+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	after := loadKeyring(t, masterKeyFile, indexKeyFile)
+	if after.ActiveKeyId() != "k2" {
+		t.Fatalf("ActiveKeyId = %q, want k2", after.ActiveKeyId())
+	}
+	if after.BlindIndex("alice@example.com") != before.BlindIndex("alice@example.com") {
+		t.Fatal("blind index changed with the master key")
+	}
+
+	rewrapped, err := after.Rewrap(key.KeyId, key.Wrapped)
+	if err != nil {
+		t.Fatalf("Rewrap: %v", err)
+	}
+	if rewrapped.KeyId != "k2" || rewrapped.Wrapped == key.Wrapped {
+		t.Fatalf("Rewrap = %q, want the data key wrapped with k2", rewrapped.KeyId)
+	}
+
+	// The data key itself didn't change, so the fields need no re-encryption
+	opened, err := after.OpenDataKey(rewrapped.KeyId, rewrapped.Wrapped)
+	if err != nil {
+		t.Fatalf("OpenDataKey: %v", err)
+	}
+	if plaintext, err := opened.Decrypt("email", ciphertext); err != nil || plaintext != "alice@example.com" {
+		t.Fatalf("Decrypt = %q, %v, want alice@example.com", plaintext, err)
+	}
+
+	// A wrapped key claiming another master key id doesn't open
+	if _, err := after.OpenDataKey("k2", key.Wrapped); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("OpenDataKey with the wrong id = %v, want %v", err, ErrDecrypt)
+	}
+	if _, err := after.OpenDataKey("k9", key.Wrapped); !errors.Is(err, ErrUnknownMasterKey) {
+		t.Fatalf("OpenDataKey with an unknown id = %v, want %v", err, ErrUnknownMasterKey)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	k := newKeyring(t)
+
+	if k.BlindIndex(" Alice@Example.COM ") != k.BlindIndex("alice@example.com") {
+		t.Fatal("blind index depends on case or surrounding spaces")
+	}
+	if k.BlindIndex("alice@example.com") == k.BlindIndex("bob@example.com") {
+		t.Fatal("different emails have the same blind index")
+	}
+
+	other := newKeyring(t)
+	if k.BlindIndex("alice@example.com") == other.BlindIndex("alice@example.com") {
+		t.Fatal("blind index doesn't depend on the key")
+	}
+}
+
+func TestLoadKeyringRejectsBadFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"no keys", []string{"# nothing yet"}},
+		{"missing id", []string{":" + strings.TrimPrefix(masterKeyLine(t, "k1"), "k1:")}},
+		{"short key", []string{"k1:c2hvcnQ="}},
+		{"duplicate id", []string{masterKeyLine(t, "k1"), masterKeyLine(t, "k1")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadKeyring(writeKeyFiles(t, tt.lines...)); err == nil {
+				t.Fatal("LoadKeyring succeeded")
+			}
+		})
+	}
+}
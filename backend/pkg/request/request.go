@@ -11,4 +11,37 @@ type UserCreateRequest struct {
 type UserLoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+
+	// Filled by the handler from the HTTP request
+	IPAddress string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+// Request Forgot Password
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// Request Resend Verification
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+// Request Reset Password
+type ResetPasswordRequest struct {
+	Email    string `json:"email"`
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+// Request Change Password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// Request Webhook Subscription
+type WebhookSubscriptionRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
 }
@@ -0,0 +1,306 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Transports
+const (
+	NetworkUDP = "udp"
+	NetworkTCP = "tcp"
+	NetworkTLS = "tls"
+)
+
+// Severities from RFC 5424
+const (
+	SeverityEmergency = 0
+	SeverityAlert     = 1
+	SeverityCritical  = 2
+	SeverityError     = 3
+	SeverityWarning   = 4
+	SeverityNotice    = 5
+	SeverityInfo      = 6
+	SeverityDebug     = 7
+)
+
+// FacilityAuthPriv is security/authorization messages
+const FacilityAuthPriv = 10
+
+const (
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 5 * time.Second
+	// Wait between reconnects while the collector is down
+	reconnectDelay = 2 * time.Second
+	// Longest MSGID RFC 5424 allows
+	maxMsgIdLength = 32
+)
+
+type Config struct {
+	Network  string
+	Address  string
+	AppName  string
+	Facility int
+	// Messages waiting to be sent, more are dropped
+	BufferSize int
+	// PEM bundle of CAs trusted for TLS, the system pool when empty
+	TLSCAFile             string
+	TLSInsecureSkipVerify bool
+}
+
+type message struct {
+	severity int
+	msgId    string
+	body     []byte
+	time     time.Time
+}
+
+// Writer sends RFC 5424 messages from a bounded buffer on its own goroutine, so a slow
+// or unreachable collector costs dropped messages instead of blocked callers
+type Writer struct {
+	cfg       Config
+	hostname  string
+	procId    string
+	tlsConfig *tls.Config
+
+	queue chan message
+	conn  net.Conn
+
+	sent    prometheus.Counter
+	dropped *prometheus.CounterVec
+
+	// Held for reading while a message is queued, Close takes it for writing before closing queue
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// New starts the sender and registers the writer metrics with reg
+func New(cfg Config, reg prometheus.Registerer) (*Writer, error) {
+	switch cfg.Network {
+	case NetworkUDP, NetworkTCP, NetworkTLS:
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", cfg.Network)
+	}
+	if cfg.Address == "" {
+		return nil, errors.New("syslog address is required")
+	}
+	if cfg.BufferSize <= 0 {
+		return nil, errors.New("syslog buffer size must be positive")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	w := &Writer{
+		cfg:      cfg,
+		hostname: hostname,
+		procId:   strconv.Itoa(os.Getpid()),
+		queue:    make(chan message, cfg.BufferSize),
+		sent: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "syslog_messages_sent_total",
+			Help: "Messages written to the syslog collector.",
+		}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_messages_dropped_total",
+			Help: "Messages dropped because the buffer was full or the collector failed.",
+		}, []string{"reason"}),
+	}
+
+	if cfg.Network == NetworkTLS {
+		w.tlsConfig, err = tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if reg != nil {
+		queueDepth := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "syslog_queue_depth",
+			Help: "Messages waiting to be sent to the syslog collector.",
+		}, func() float64 {
+			return float64(len(w.queue))
+		})
+		for _, c := range []prometheus.Collector{w.sent, w.dropped, queueDepth} {
+			if err := reg.Register(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	w.wg.Add(1)
+	go w.run()
+
+	return w, nil
+}
+
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address: %w", err)
+	}
+
+	config := &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read syslog CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in syslog CA file")
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// Send queues a message and never blocks, it reports false when the message was dropped
+func (w *Writer) Send(severity int, msgId string, body []byte) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		w.dropped.WithLabelValues("closed").Inc()
+		return false
+	}
+
+	select {
+	case w.queue <- message{severity: severity, msgId: msgId, body: body, time: time.Now()}:
+		return true
+	default:
+		w.dropped.WithLabelValues("buffer_full").Inc()
+		return false
+	}
+}
+
+func (w *Writer) run() {
+	defer w.wg.Done()
+	defer func() {
+		if w.conn != nil {
+			w.conn.Close()
+		}
+	}()
+
+	var retryAt time.Time
+	for msg := range w.queue {
+		if w.conn == nil {
+			if time.Now().Before(retryAt) {
+				w.dropped.WithLabelValues("collector_unavailable").Inc()
+				continue
+			}
+			if err := w.connect(); err != nil {
+				retryAt = time.Now().Add(reconnectDelay)
+				w.dropped.WithLabelValues("collector_unavailable").Inc()
+				continue
+			}
+		}
+
+		if err := w.write(w.format(msg)); err != nil {
+			// Stream transports may have been closed by the collector, reconnect once
+			w.conn.Close()
+			w.conn = nil
+			if w.cfg.Network == NetworkUDP || w.connect() != nil || w.write(w.format(msg)) != nil {
+				retryAt = time.Now().Add(reconnectDelay)
+				w.dropped.WithLabelValues("write_failed").Inc()
+				continue
+			}
+		}
+		w.sent.Inc()
+	}
+}
+
+func (w *Writer) connect() error {
+	var (
+		conn net.Conn
+		err  error
+	)
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	switch w.cfg.Network {
+	case NetworkTLS:
+		conn, err = tls.DialWithDialer(dialer, "tcp", w.cfg.Address, w.tlsConfig)
+	default:
+		conn, err = dialer.Dial(w.cfg.Network, w.cfg.Address)
+	}
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *Writer) write(frame []byte) error {
+	if w.conn == nil {
+		return errors.New("syslog connection closed")
+	}
+	if err := w.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	_, err := w.conn.Write(frame)
+	return err
+}
+
+// format builds an RFC 5424 message. Stream transports use octet counting framing (RFC 6587)
+// so payloads may contain newlines.
+func (w *Writer) format(msg message) []byte {
+	priority := w.cfg.Facility*8 + msg.severity
+
+	line := fmt.Sprintf("<%d>1 %s %s %s %s %s - %s",
+		priority,
+		msg.time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		w.hostname,
+		headerField(w.cfg.AppName, 48),
+		w.procId,
+		headerField(msg.msgId, maxMsgIdLength),
+		msg.body,
+	)
+
+	if w.cfg.Network == NetworkUDP {
+		return []byte(line)
+	}
+	return []byte(strconv.Itoa(len(line)) + " " + line)
+}
+
+// headerField makes a value safe for a header field, printable ASCII without spaces
+func headerField(value string, max int) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r > 32 && r < 127 {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	field := b.String()
+	if len(field) > max {
+		field = field[:max]
+	}
+	return field
+}
+
+// Close sends what is already buffered and stops the sender, later messages are dropped
+func (w *Writer) Close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+}
@@ -0,0 +1,273 @@
+package syslog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rfc5424 matches the header the writer produces, the body is the last group
+var rfc5424 = regexp.MustCompile(`^<(\d+)>1 (\S+) (\S+) (\S+) (\d+) (\S+) - (.*)$`)
+
+type frame struct {
+	priority string
+	time     time.Time
+	appName  string
+	msgId    string
+	body     string
+}
+
+func parseFrame(t *testing.T, line string) frame {
+	t.Helper()
+
+	match := rfc5424.FindStringSubmatch(line)
+	if match == nil {
+		t.Fatalf("%q is not an RFC 5424 message", line)
+	}
+	at, err := time.Parse(time.RFC3339Nano, match[2])
+	if err != nil {
+		t.Fatalf("timestamp %q: %v", match[2], err)
+	}
+	return frame{priority: match[1], time: at, appName: match[4], msgId: match[6], body: match[7]}
+}
+
+func newTestWriter(t *testing.T, cfg Config, reg prometheus.Registerer) *Writer {
+	t.Helper()
+
+	if cfg.AppName == "" {
+		cfg.AppName = "auth"
+	}
+	if cfg.Facility == 0 {
+		cfg.Facility = FacilityAuthPriv
+	}
+	if cfg.BufferSize == 0 {
+		cfg.BufferSize = 16
+	}
+	w, err := New(cfg, reg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(w.Close)
+	return w
+}
+
+// tcpCollector hands every octet counted frame to the test, one connection at a time
+type tcpCollector struct {
+	listener net.Listener
+	frames   chan string
+	conns    chan net.Conn
+}
+
+func newTCPCollector(t *testing.T) *tcpCollector {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &tcpCollector{listener: listener, frames: make(chan string, 16), conns: make(chan net.Conn, 4)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			c.conns <- conn
+			go c.read(conn)
+		}
+	}()
+	return c
+}
+
+func (c *tcpCollector) read(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			c.frames <- "bad length " + length
+			return
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return
+		}
+		c.frames <- string(buf)
+	}
+}
+
+func (c *tcpCollector) next(t *testing.T) string {
+	t.Helper()
+
+	select {
+	case f := <-c.frames:
+		return f
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message reached the collector")
+		return ""
+	}
+}
+
+func TestWriterFramesTCPWithOctetCounts(t *testing.T) {
+	collector := newTCPCollector(t)
+	w := newTestWriter(t, Config{Network: NetworkTCP, Address: collector.listener.Addr().String()}, nil)
+
+	before := time.Now().Add(-time.Second)
+	// Bodies may span lines, the length prefix keeps them one message
+	w.Send(SeverityWarning, "account.locked", []byte("first line\nsecond line"))
+	w.Send(SeverityInfo, "auth.login", []byte("ok"))
+
+	first := parseFrameMultiline(t, collector.next(t))
+	// authpriv (10) * 8 + warning (4)
+	if first.priority != "84" || first.appName != "auth" || first.msgId != "account.locked" {
+		t.Fatalf("header = %+v", first)
+	}
+	if first.body != "first line\nsecond line" {
+		t.Fatalf("body = %q", first.body)
+	}
+	if first.time.Before(before) || first.time.Location() != time.UTC {
+		t.Fatalf("timestamp = %v, want now in UTC", first.time)
+	}
+
+	if second := parseFrame(t, collector.next(t)); second.priority != "86" || second.body != "ok" {
+		t.Fatalf("second message = %+v", second)
+	}
+}
+
+// parseFrameMultiline parses a frame whose body contains newlines
+func parseFrameMultiline(t *testing.T, line string) frame {
+	t.Helper()
+
+	head, body, _ := strings.Cut(line, " - ")
+	f := parseFrame(t, head+" - ")
+	f.body = body
+	return f
+}
+
+func TestWriterSendsUDPUnframed(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	w := newTestWriter(t, Config{Network: NetworkUDP, Address: conn.LocalAddr().String()}, nil)
+
+	w.Send(SeverityNotice, "auth.login", []byte("CEF:0|x"))
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no datagram: %v", err)
+	}
+	if f := parseFrame(t, string(buf[:n])); f.priority != "85" || f.body != "CEF:0|x" {
+		t.Fatalf("datagram = %q", buf[:n])
+	}
+}
+
+func TestWriterSanitizesHeaderFields(t *testing.T) {
+	collector := newTCPCollector(t)
+	w := newTestWriter(t, Config{Network: NetworkTCP, Address: collector.listener.Addr().String(), AppName: "user auth"}, nil)
+
+	w.Send(SeverityInfo, strings.Repeat("a", 40), nil)
+	w.Send(SeverityInfo, "  ", nil)
+
+	long := parseFrame(t, collector.next(t))
+	if long.appName != "userauth" || long.msgId != strings.Repeat("a", maxMsgIdLength) {
+		t.Fatalf("header = %+v", long)
+	}
+	if empty := parseFrame(t, collector.next(t)); empty.msgId != "-" {
+		t.Fatalf("MSGID = %q, want the nil value", empty.msgId)
+	}
+}
+
+func TestWriterReconnectsAfterTheCollectorHangsUp(t *testing.T) {
+	collector := newTCPCollector(t)
+	w := newTestWriter(t, Config{Network: NetworkTCP, Address: collector.listener.Addr().String()}, nil)
+
+	w.Send(SeverityInfo, "one", []byte("1"))
+	collector.next(t)
+	(<-collector.conns).Close()
+
+	// A write to a closed stream may still succeed once, keep sending until a new connection shows up
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 2; ; i++ {
+		w.Send(SeverityInfo, "again", []byte(strconv.Itoa(i)))
+		select {
+		case <-collector.conns:
+			if f := parseFrame(t, collector.next(t)); f.msgId != "again" {
+				t.Fatalf("message after reconnecting = %+v", f)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the writer never reconnected")
+		}
+	}
+}
+
+func TestWriterDropsAfterClose(t *testing.T) {
+	collector := newTCPCollector(t)
+	reg := prometheus.NewRegistry()
+	w := newTestWriter(t, Config{Network: NetworkTCP, Address: collector.listener.Addr().String()}, reg)
+
+	w.Send(SeverityInfo, "queued", []byte("before close"))
+	w.Close()
+	// Close sent what was buffered
+	if f := parseFrame(t, collector.next(t)); f.body != "before close" {
+		t.Fatalf("message = %+v", f)
+	}
+
+	if w.Send(SeverityInfo, "late", nil) {
+		t.Fatal("Send accepted a message after Close")
+	}
+	w.Close()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				name += fmt.Sprintf("{%s}", label.GetValue())
+			}
+			counts[name] = metric.GetCounter().GetValue()
+		}
+	}
+	if counts["syslog_messages_sent_total"] != 1 || counts["syslog_messages_dropped_total{closed}"] != 1 {
+		t.Fatalf("metrics = %v", counts)
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	cases := map[string]Config{
+		"network": {Network: "smoke", Address: "127.0.0.1:514", BufferSize: 1},
+		"address": {Network: NetworkUDP, BufferSize: 1},
+		"buffer":  {Network: NetworkUDP, Address: "127.0.0.1:514"},
+		"ca file": {Network: NetworkTLS, Address: "127.0.0.1:6514", BufferSize: 1, TLSCAFile: "/nonexistent/ca.pem"},
+	}
+	for name, cfg := range cases {
+		if _, err := New(cfg, nil); err == nil {
+			t.Fatalf("New accepted a config without a valid %s", name)
+		}
+	}
+}